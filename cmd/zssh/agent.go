@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"github.com/zacscoding/zssh/pkg/agent"
+	"github.com/zacscoding/zssh/pkg/keyring"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// agentSocketName is the default socket of the agent in the workspace.
+const agentSocketName = "agent.sock"
+
+var (
+	agentSocket   string
+	agentKeys     []string
+	agentLifetime time.Duration
+	agentConfirm  bool
+)
+
+var agentKeyOutputColumns = []string{"type", "fingerprint", "comment"}
+
+func init() {
+	agentCmd.PersistentFlags().StringVar(&agentSocket, "socket", "", "the unix socket of the agent(default: {workspace}/agent.sock)")
+	agentStartCmd.Flags().StringSliceVar(&agentKeys, "key", nil, "the names of managed keys to add(default: all keys)")
+	agentStartCmd.Flags().DurationVar(&agentLifetime, "lifetime", 0, "the maximum lifetime of keys in the agent(default: forever)")
+	agentStartCmd.Flags().BoolVar(&agentConfirm, "confirm", false, "confirm each use of the keys on the terminal of the agent")
+
+	agentCmd.AddCommand(agentStartCmd, agentListCmd)
+	rootCmd.AddCommand(agentCmd)
+}
+
+var agentCmd = &cobra.Command{
+	Use:   "agent",
+	Short: "Run the ssh agent which serves keys in the workspace",
+}
+
+var agentStartCmd = &cobra.Command{
+	Use:   "start",
+	Short: "Start the ssh agent on the unix socket until interrupted",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		socket := agentSocketPath()
+		l, err := agent.Listen(socket)
+		if err != nil {
+			return errors.Wrap(err, "listen the agent socket")
+		}
+		defer os.Remove(socket)
+		defer l.Close()
+
+		keys, err := agentStartKeys()
+		if err != nil {
+			return err
+		}
+		a := agent.New(confirmAgentKey)
+		for _, k := range keys {
+			passphrase, err := readKeyPassphrase(k)
+			if err != nil {
+				if isUserCancelError(err) {
+					log.Info().Msg("😎 Good bye")
+					return nil
+				}
+				return errors.Wrapf(err, "read the passphrase of the key(%s)", k.Name)
+			}
+			if err := a.AddKeyFile(keyRing.PrivateKeyPath(k.Name), passphrase, k.Name, agentLifetime, agentConfirm); err != nil {
+				return errors.Wrapf(err, "add the key(%s)", k.Name)
+			}
+		}
+
+		log.Info().Msgf("✅ the agent is listening on %s with #%d keys", socket, len(keys))
+		for _, k := range keys {
+			log.Info().Msgf("  🔹 %s", k.String())
+		}
+		log.Info().Msgf("⚡ use the agent with: export SSH_AUTH_SOCK=%s", socket)
+		fmt.Fprintf(stdout, "SSH_AUTH_SOCK=%s; export SSH_AUTH_SOCK;\n", socket)
+
+		sigs := make(chan os.Signal, 1)
+		signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+		go func() {
+			<-sigs
+			l.Close()
+		}()
+		_ = a.Serve(l)
+		log.Info().Msg("😎 Good bye")
+		return nil
+	},
+}
+
+var agentListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "Get keys in the running agent",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		socket := agentSocketPath()
+		keys, err := agent.List(socket)
+		if err != nil {
+			return errors.Wrapf(err, "list keys of the agent(%s)", socket)
+		}
+		if structuredOutput() {
+			return printOutput(keys, agentKeyOutputColumns)
+		}
+		log.Info().Msgf("⚡ Total keys: #%d", len(keys))
+		for _, k := range keys {
+			log.Info().Msgf("  🔹 %s %s %s", k.Type, k.Fingerprint, k.Comment)
+		}
+		return nil
+	},
+}
+
+// agentStartKeys returns the managed keys of the --key flag or all of them.
+func agentStartKeys() ([]*keyring.Key, error) {
+	if len(agentKeys) == 0 {
+		keys, err := keyRing.FindAll(context.Background())
+		if err != nil {
+			return nil, errors.Wrap(err, "find keys")
+		}
+		return keys, nil
+	}
+	keys := make([]*keyring.Key, 0, len(agentKeys))
+	for _, name := range agentKeys {
+		k, err := findKey(name)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	return keys, nil
+}
+
+// confirmAgentKey asks the user on the terminal of the agent whether the key can be used.
+func confirmAgentKey(comment, fingerprint string) bool {
+	ok, err := confirmPrompt(fmt.Sprintf("allow to use the key(%s) %s?", comment, fingerprint))
+	return err == nil && ok
+}
+
+func agentSocketPath() string {
+	if agentSocket != "" {
+		return expandPath(agentSocket)
+	}
+	return filepath.Join(workspace, agentSocketName)
+}
+
+// findAgentSocket returns the socket of the workspace agent or SSH_AUTH_SOCK which has the given key.
+// It returns an empty string if no agents have it.
+func findAgentSocket(k *keyring.Key) string {
+	for _, socket := range []string{filepath.Join(workspace, agentSocketName), os.Getenv("SSH_AUTH_SOCK")} {
+		if socket == "" {
+			continue
+		}
+		if ok, err := agent.Has(socket, k.PublicKey); err == nil && ok {
+			return socket
+		}
+	}
+	return ""
+}
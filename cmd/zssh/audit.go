@@ -0,0 +1,89 @@
+package main
+
+import (
+	"github.com/rs/zerolog/log"
+	"github.com/zacscoding/zssh/pkg/audit"
+	"github.com/zacscoding/zssh/pkg/host"
+	"github.com/zacscoding/zssh/pkg/ssh"
+	"io"
+	"os/user"
+	"path/filepath"
+	"time"
+)
+
+// execAudit captures the outputs of a command executed by ssh exec for the audit log.
+type execAudit struct {
+	entry  audit.Entry
+	stdout *audit.Capture
+	stderr *audit.Capture
+}
+
+// startExecAudit returns the execAudit of the command if the audit log is enabled, otherwise nil.
+func startExecAudit(info *host.ServerInfo, command string) *execAudit {
+	if !workspaceConfig.Audit.Enabled {
+		return nil
+	}
+	a := &execAudit{
+		entry: audit.Entry{
+			StartedAt: time.Now(),
+			Host:      info.Name,
+			User:      info.User,
+			Command:   command,
+		},
+		stdout: audit.NewCapture(workspaceConfig.Audit.MaxOutput),
+		stderr: audit.NewCapture(workspaceConfig.Audit.MaxOutput),
+	}
+	if u, err := user.Current(); err == nil {
+		a.entry.LocalUser = u.Username
+	}
+	return a
+}
+
+// writers returns the given writers which also write to the captures.
+func (a *execAudit) writers(stdout, stderr io.Writer) (io.Writer, io.Writer) {
+	if a == nil {
+		return stdout, stderr
+	}
+	return io.MultiWriter(stdout, a.stdout), io.MultiWriter(stderr, a.stderr)
+}
+
+// finish writes the entry of the command to the audit log. Failures are logged as warnings
+// so that they do not change the result of the command.
+func (a *execAudit) finish(address string, err error) {
+	if a == nil {
+		return
+	}
+	a.entry.EndedAt = time.Now()
+	a.entry.Address = address
+	a.entry.ExitStatus = ssh.ExitStatus(err)
+	if err != nil {
+		a.entry.Error = err.Error()
+	}
+
+	logger, lerr := audit.New(audit.Options{
+		Path:       auditLogPath(),
+		MaxSize:    int64(workspaceConfig.Audit.MaxSizeMB) * 1024 * 1024,
+		MaxAge:     time.Duration(workspaceConfig.Audit.MaxAge),
+		MaxBackups: workspaceConfig.Audit.MaxBackups,
+		Redact:     workspaceConfig.Audit.Redact,
+	})
+	if lerr == nil {
+		a.entry.Stdout, a.entry.StdoutTruncated = a.stdout.Redact(logger.Redact), a.stdout.Truncated()
+		a.entry.Stderr, a.entry.StderrTruncated = a.stderr.Redact(logger.Redact), a.stderr.Truncated()
+		lerr = logger.Write(&a.entry)
+	}
+	if lerr != nil {
+		log.Warn().Err(lerr).Msgf("failed to write the audit log(%s)", auditLogPath())
+	}
+}
+
+func auditLogPath() string {
+	path := expandPath(workspaceConfig.Audit.Path)
+	if path == "" {
+		path = "audit.jsonl"
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(workspace, path)
+	}
+	return path
+}
@@ -0,0 +1,571 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"github.com/manifoldco/promptui"
+	"github.com/mitchellh/go-homedir"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"github.com/zacscoding/zssh/pkg/backup"
+	"github.com/zacscoding/zssh/pkg/config"
+	"github.com/zacscoding/zssh/pkg/database"
+	"github.com/zacscoding/zssh/pkg/host"
+	"github.com/zacscoding/zssh/pkg/keyring"
+	"gorm.io/gorm"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	backupDir          = "backups"
+	backupFilePrefix   = "zssh-backup-"
+	backupFileExt      = ".tar.gz"
+	backupEncryptedExt = ".enc"
+	backupTimeLayout   = "20060102-150405"
+	backupDBName       = "zssh.db"
+	backupKeysDir      = "keys/"
+	// backupManagedKeysDir has the files of managed keys, which are tracked by the keys table of the database.
+	backupManagedKeysDir = "managed-keys/"
+	// restoredKeysDir is the directory in the workspace of key files of hosts restored from backups.
+	restoredKeysDir = "restored-keys"
+)
+
+const (
+	conflictAsk       = "ask"
+	conflictSkip      = "skip"
+	conflictOverwrite = "overwrite"
+	conflictRename    = "rename"
+)
+
+var (
+	backupEncrypt    bool
+	backupOutputPath string
+	backupOnConflict string
+)
+
+var backupOutputColumns = []string{"name", "size", "encrypted", "modifiedAt"}
+
+func init() {
+	backupCreateCmd.Flags().BoolVarP(&backupEncrypt, "encrypt", "e", false, "encrypt the backup with a passphrase")
+	backupCreateCmd.Flags().StringVar(&backupOutputPath, "out", "", "the path of the backup file(default: {workspace}/backups/zssh-backup-{timestamp}.tar.gz)")
+	backupRestoreCmd.Flags().StringVar(&backupOnConflict, "on-conflict", conflictAsk, "how to merge a host which exists with different values(ask|skip|overwrite|rename)")
+
+	backupCmd.AddCommand(backupCreateCmd, backupListCmd, backupRestoreCmd)
+	rootCmd.AddCommand(backupCmd)
+}
+
+var backupCmd = &cobra.Command{
+	Use:   "backup",
+	Short: "Backup and restore the workspace",
+}
+
+var backupCreateCmd = &cobra.Command{
+	Use:   "create",
+	Short: "Create a backup of hosts, managed keys and key files of hosts",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		tmpDir, err := ioutil.TempDir("", "zssh-backup")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(tmpDir)
+
+		snapshotPath := filepath.Join(tmpDir, backupDBName)
+		if err := database.Snapshot(workspaceDB, snapshotPath); err != nil {
+			return errors.Wrap(err, "snapshot the database")
+		}
+		if workspaceConfig.Store.Backend != config.StoreBackendSQLite {
+			if err := snapshotHosts(snapshotPath); err != nil {
+				return errors.Wrap(err, "copy hosts to the snapshot")
+			}
+		}
+		schemaVersion, err := migrator.CurrentVersion()
+		if err != nil {
+			return errors.Wrap(err, "find the schema version")
+		}
+		entries := []*backup.Entry{{Name: backupDBName, Source: snapshotPath}}
+		keyEntries, err := backupKeyEntries()
+		if err != nil {
+			return err
+		}
+		entries = append(entries, keyEntries...)
+
+		var passphrase string
+		if backupEncrypt {
+			if passphrase, err = readNewPassphrase(); err != nil {
+				if isUserCancelError(err) {
+					log.Info().Msg("😎 Good bye")
+					return nil
+				}
+				return errors.Wrap(err, "read the passphrase")
+			}
+		}
+
+		path := backupOutputPath
+		if path == "" {
+			if err := checkWorkspace(filepath.Join(workspace, backupDir)); err != nil {
+				return err
+			}
+			path = filepath.Join(workspace, backupDir, backupFilePrefix+time.Now().Format(backupTimeLayout)+backupFileExt)
+			if backupEncrypt {
+				path += backupEncryptedExt
+			}
+		}
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err != nil {
+			return errors.Wrap(err, "create the backup file")
+		}
+		defer f.Close()
+		manifest, err := backup.Create(f, schemaVersion, entries, passphrase)
+		if err != nil {
+			os.Remove(path)
+			return errors.Wrap(err, "write the backup")
+		}
+		if !backupEncrypt {
+			log.Warn().Msg("The backup is not encrypted and contains stored passwords and private keys. Keep it safe.")
+		}
+		log.Info().Msgf("✅ success to create a backup with %d key files: %s", len(manifest.Files)-1, path)
+		return nil
+	},
+}
+
+var backupListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List backups in the workspace",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		files, err := ioutil.ReadDir(filepath.Join(workspace, backupDir))
+		if err != nil && !os.IsNotExist(err) {
+			return errors.Wrap(err, "read the backup directory")
+		}
+		type backupOutput struct {
+			Name       string    `json:"name"`
+			Path       string    `json:"path"`
+			Size       int64     `json:"size"`
+			Encrypted  bool      `json:"encrypted"`
+			ModifiedAt time.Time `json:"modifiedAt"`
+		}
+		outputs := []*backupOutput{}
+		for _, f := range files {
+			if f.IsDir() || !strings.HasPrefix(f.Name(), backupFilePrefix) {
+				continue
+			}
+			outputs = append(outputs, &backupOutput{
+				Name:       f.Name(),
+				Path:       filepath.Join(workspace, backupDir, f.Name()),
+				Size:       f.Size(),
+				Encrypted:  strings.HasSuffix(f.Name(), backupEncryptedExt),
+				ModifiedAt: f.ModTime(),
+			})
+		}
+		if structuredOutput() {
+			return printOutput(outputs, backupOutputColumns)
+		}
+		log.Info().Msgf("⚡ Total backups: #%d", len(outputs))
+		for _, o := range outputs {
+			lock := ""
+			if o.Encrypted {
+				lock = " 🔒"
+			}
+			log.Info().Msgf("  🔹 %s (%d bytes)%s", o.Name, o.Size, lock)
+		}
+		return nil
+	},
+}
+
+var backupRestoreCmd = &cobra.Command{
+	Use:   "restore [backup]",
+	Short: "Restore hosts, managed keys and key files from the backup path or name in the workspace",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		resolve, err := newConflictResolver(backupOnConflict)
+		if err != nil {
+			return err
+		}
+		path := args[0]
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			path = filepath.Join(workspace, backupDir, args[0])
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return errors.Wrap(err, "read the backup")
+		}
+		var passphrase string
+		if backup.IsEncrypted(data) {
+			prompt := promptui.Prompt{Label: promptLabel("passphrase"), Mask: '*'}
+			if passphrase, err = prompt.Run(); err != nil {
+				if isUserCancelError(err) {
+					log.Info().Msg("😎 Good bye")
+					return nil
+				}
+				return errors.Wrap(err, "read the passphrase")
+			}
+		}
+
+		tmpDir, err := ioutil.TempDir("", "zssh-restore")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(tmpDir)
+		manifest, err := backup.Extract(bytes.NewReader(data), tmpDir, passphrase)
+		if err != nil {
+			return errors.Wrap(err, "extract the backup")
+		}
+		log.Info().Msgf("✅ verified the backup created at %s", manifest.CreatedAt.Format(time.RFC3339))
+
+		hosts, keys, err := readBackupDatabase(filepath.Join(tmpDir, backupDBName))
+		if err != nil {
+			return err
+		}
+		keyNames, err := restoreManagedKeys(manifest, tmpDir, keys)
+		if err != nil {
+			return err
+		}
+		keyPaths, err := restoreKeyFiles(manifest, tmpDir)
+		if err != nil {
+			return err
+		}
+		for _, info := range hosts {
+			if p, ok := keyPaths[expandPath(info.KeyPath)]; ok {
+				info.KeyPath = p
+			}
+			if name, ok := keyNames[info.KeyName]; ok {
+				info.KeyName = name
+			}
+		}
+
+		result, err := backup.Merge(context.Background(), hostStore, hosts, resolve)
+		if result != nil {
+			for _, item := range []struct {
+				label string
+				names []string
+			}{
+				{"Added", result.Added},
+				{"Overwritten", result.Overwritten},
+				{"Renamed", result.Renamed},
+				{"Skipped", result.Skipped},
+				{"Unchanged", result.Unchanged},
+				{"Dropped aliases", result.DroppedAliases},
+			} {
+				if len(item.names) != 0 {
+					log.Info().Msgf("  🔹 %s: %s", item.label, strings.Join(item.names, ", "))
+				}
+			}
+		}
+		if err != nil {
+			if isUserCancelError(err) {
+				log.Info().Msg("😎 Good bye")
+				return nil
+			}
+			return errors.Wrap(err, "merge hosts")
+		}
+		log.Info().Msgf("✅ success to restore %d hosts", len(hosts))
+		return nil
+	},
+}
+
+// snapshotHosts replaces hosts in the snapshot database with hosts in the store of the workspace,
+// so that a backup contains hosts of a file store.
+func snapshotHosts(dbpath string) error {
+	db, err := database.NewSQLiteDB(dbpath)
+	if err != nil {
+		return err
+	}
+	if sqlDB, err := db.DB(); err == nil {
+		defer sqlDB.Close()
+	}
+	ctx := context.Background()
+	snapshot := host.NewStore(db)
+	existing, err := snapshot.FindAll(ctx)
+	if err != nil {
+		return err
+	}
+	for _, info := range existing {
+		if _, err := snapshot.DeleteByName(ctx, info.Name); err != nil {
+			return err
+		}
+	}
+	if _, err := snapshot.Purge(ctx); err != nil {
+		return err
+	}
+	hosts, err := hostStore.FindAll(ctx)
+	if err != nil {
+		return err
+	}
+	for _, info := range hosts {
+		for i := range info.Aliases {
+			info.Aliases[i].ID = 0
+		}
+		for i := range info.Addresses {
+			info.Addresses[i].ID = 0
+		}
+		for i := range info.Tags {
+			info.Tags[i].ID = 0
+		}
+		if err := snapshot.Save(ctx, info); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// backupKeyEntries returns entries of files of managed keys and key files referenced by hosts.
+func backupKeyEntries() ([]*backup.Entry, error) {
+	keys, err := keyRing.FindAll(context.Background())
+	if err != nil {
+		return nil, errors.Wrap(err, "find keys")
+	}
+	var (
+		entries []*backup.Entry
+		added   = make(map[string]bool)
+	)
+	for _, k := range keys {
+		certPath := keyRing.PrivateKeyPath(k.Name) + "-cert.pub"
+		for _, path := range []string{keyRing.PrivateKeyPath(k.Name), keyRing.PublicKeyPath(k.Name), certPath} {
+			if _, err := os.Stat(path); err != nil {
+				if path != certPath || !os.IsNotExist(err) {
+					log.Warn().Msgf("skip the file(%s) of the key(%s): %v", path, k.Name, err)
+				}
+				continue
+			}
+			added[path] = true
+			entries = append(entries, &backup.Entry{Name: backupManagedKeysDir + filepath.Base(path), Source: path})
+		}
+	}
+
+	hosts, err := hostStore.FindAll(context.Background())
+	if err != nil {
+		return nil, errors.Wrap(err, "find hosts")
+	}
+	for _, info := range hosts {
+		keyPath := expandPath(info.KeyPath)
+		if keyPath == "" || added[keyPath] {
+			continue
+		}
+		if _, err := os.Stat(keyPath); err != nil {
+			log.Warn().Msgf("skip the key file(%s) of the host(%s): %v", keyPath, info.Name, err)
+			continue
+		}
+		added[keyPath] = true
+		entries = append(entries, &backup.Entry{
+			Name:   fmt.Sprintf("%s%d-%s", backupKeysDir, len(entries), filepath.Base(keyPath)),
+			Source: keyPath,
+		})
+	}
+	return entries, nil
+}
+
+// readBackupDatabase reads hosts and managed keys from the database in a backup after migrating it to
+// the latest schema.
+func readBackupDatabase(dbpath string) ([]*host.ServerInfo, []*keyring.Key, error) {
+	db, err := database.NewSQLiteDB(dbpath)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "open the backup database")
+	}
+	if sqlDB, err := db.DB(); err == nil {
+		defer sqlDB.Close()
+	}
+	if _, err := database.NewMigrator(db, dbpath).Migrate(-1); err != nil {
+		return nil, nil, errors.Wrap(err, "migrate the backup database")
+	}
+	hosts, err := host.NewStore(db).FindAll(context.Background())
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "find hosts in the backup")
+	}
+	keys, err := keyring.NewStore(db).FindAll(context.Background())
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "find keys in the backup")
+	}
+	return hosts, keys, nil
+}
+
+// restoreManagedKeys imports managed keys in the backup to the keyring and returns restored names by the names
+// in the backup. A key which exists with the same fingerprint is kept, and a key whose name is used by another
+// key is restored with a new name.
+func restoreManagedKeys(manifest *backup.Manifest, dir string, keys []*keyring.Key) (map[string]string, error) {
+	files := make(map[string]string)
+	for _, f := range manifest.Files {
+		if strings.HasPrefix(f.Name, backupManagedKeysDir) {
+			files[strings.TrimPrefix(f.Name, backupManagedKeysDir)] = filepath.Join(dir, filepath.FromSlash(f.Name))
+		}
+	}
+	ctx := context.Background()
+	names := make(map[string]string)
+	for _, k := range keys {
+		privateKeyPath, ok := files[k.Name]
+		publicKeyPath, pubOK := files[k.Name+".pub"]
+		if !ok || !pubOK {
+			log.Warn().Msgf("skip the key(%s) which has no files in the backup", k.Name)
+			continue
+		}
+		name, exists := k.Name, false
+		for i := 2; ; i++ {
+			existing, err := keyRing.Find(ctx, name)
+			if err == nil && existing.Fingerprint == k.Fingerprint {
+				exists = true
+				break
+			}
+			if err != nil && err != gorm.ErrRecordNotFound {
+				return nil, errors.Wrapf(err, "find the key(%s)", name)
+			}
+			if err == gorm.ErrRecordNotFound && !pathExists(keyRing.PrivateKeyPath(name)) && !pathExists(keyRing.PublicKeyPath(name)) {
+				break
+			}
+			name = fmt.Sprintf("%s-%d", k.Name, i)
+		}
+		names[k.Name] = name
+		if exists {
+			continue
+		}
+
+		privateKey, err := ioutil.ReadFile(privateKeyPath)
+		if err != nil {
+			return nil, err
+		}
+		publicKey, err := ioutil.ReadFile(publicKeyPath)
+		if err != nil {
+			return nil, err
+		}
+		restored := *k
+		restored.Name = name
+		if err := keyRing.Import(ctx, &restored, privateKey, publicKey); err != nil {
+			return nil, errors.Wrapf(err, "restore the key(%s)", k.Name)
+		}
+		if certPath, ok := files[k.Name+"-cert.pub"]; ok {
+			cert, err := ioutil.ReadFile(certPath)
+			if err != nil {
+				return nil, err
+			}
+			if err := ioutil.WriteFile(keyRing.PrivateKeyPath(name)+"-cert.pub", cert, 0644); err != nil {
+				return nil, err
+			}
+		}
+		if name != k.Name {
+			log.Info().Msgf("Restore the key %s as %s because the name is used by another key", k.Name, name)
+		} else {
+			log.Info().Msgf("Restore the key %s", k.Name)
+		}
+	}
+	return names, nil
+}
+
+func pathExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// restoreKeyFiles restores key files in the backup and returns restored paths by the original paths.
+// A key file is restored to the restored keys directory in the workspace unless the original file has the same content.
+func restoreKeyFiles(manifest *backup.Manifest, dir string) (map[string]string, error) {
+	paths := make(map[string]string)
+	for _, f := range manifest.Files {
+		if !strings.HasPrefix(f.Name, backupKeysDir) {
+			continue
+		}
+		b, err := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(f.Name)))
+		if err != nil {
+			return nil, err
+		}
+		if existing, err := ioutil.ReadFile(f.Source); err == nil && sha256.Sum256(existing) == sha256.Sum256(b) {
+			paths[f.Source] = f.Source
+			continue
+		}
+
+		keyDir := filepath.Join(workspace, restoredKeysDir)
+		if err := os.MkdirAll(keyDir, 0700); err != nil {
+			return nil, err
+		}
+		dst := filepath.Join(keyDir, filepath.Base(f.Source))
+		for i := 2; ; i++ {
+			existing, err := ioutil.ReadFile(dst)
+			if os.IsNotExist(err) {
+				if err := ioutil.WriteFile(dst, b, 0600); err != nil {
+					return nil, err
+				}
+				break
+			}
+			if err == nil && sha256.Sum256(existing) == sha256.Sum256(b) {
+				break
+			}
+			dst = filepath.Join(keyDir, fmt.Sprintf("%s.%d", filepath.Base(f.Source), i))
+		}
+		log.Info().Msgf("Restore the key file %s to %s", f.Source, dst)
+		paths[f.Source] = dst
+	}
+	return paths, nil
+}
+
+func newConflictResolver(onConflict string) (backup.Resolver, error) {
+	fixed := func(r backup.Resolution) backup.Resolver {
+		return func(existing, incoming *host.ServerInfo) (backup.Resolution, error) {
+			return r, nil
+		}
+	}
+	switch onConflict {
+	case conflictSkip:
+		return fixed(backup.ResolutionSkip), nil
+	case conflictOverwrite:
+		return fixed(backup.ResolutionOverwrite), nil
+	case conflictRename:
+		return fixed(backup.ResolutionRename), nil
+	case conflictAsk:
+		return func(existing, incoming *host.ServerInfo) (backup.Resolution, error) {
+			log.Info().Msgf("🤔 Conflict of the host(%s)\nexisting: %s\nbackup:   %s",
+				existing.Name, existing.ToJSON(false), incoming.ToJSON(false))
+			p := promptui.Select{
+				Label: promptLabel(fmt.Sprintf("Merge the host(%s)", existing.Name)),
+				Items: []string{conflictSkip, conflictOverwrite, conflictRename},
+			}
+			idx, _, err := p.Run()
+			if err != nil {
+				return backup.ResolutionSkip, err
+			}
+			return []backup.Resolution{backup.ResolutionSkip, backup.ResolutionOverwrite, backup.ResolutionRename}[idx], nil
+		}, nil
+	}
+	return nil, fmt.Errorf("invalid conflict resolution: %s", onConflict)
+}
+
+func readNewPassphrase() (string, error) {
+	prompt := promptui.Prompt{
+		Label: promptLabel("passphrase"),
+		Mask:  '*',
+		Validate: func(input string) error {
+			if len(input) < 8 {
+				return errors.New("passphrase must be at least 8 characters")
+			}
+			return nil
+		},
+	}
+	passphrase, err := prompt.Run()
+	if err != nil {
+		return "", err
+	}
+	confirm := promptui.Prompt{
+		Label: promptLabel("confirm passphrase"),
+		Mask:  '*',
+		Validate: func(input string) error {
+			if input != passphrase {
+				return errors.New("passphrase does not match")
+			}
+			return nil
+		},
+	}
+	if _, err := confirm.Run(); err != nil {
+		return "", err
+	}
+	return passphrase, nil
+}
+
+// expandPath expands "~" of the given path to the home directory.
+func expandPath(path string) string {
+	if expanded, err := homedir.Expand(path); err == nil {
+		return expanded
+	}
+	return path
+}
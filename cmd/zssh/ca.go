@@ -0,0 +1,274 @@
+package main
+
+import (
+	"fmt"
+	"github.com/manifoldco/promptui"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"github.com/zacscoding/zssh/pkg/keyring"
+	"github.com/zacscoding/zssh/pkg/ssh"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// caDir is the directory of the certificate authority in the workspace.
+const caDir = "ca"
+
+var (
+	caType         string
+	caBits         int
+	caComment      string
+	caPassphrase   bool
+	caHostPattern  string
+	caKeyName      string
+	caPrincipals   []string
+	caValidity     time.Duration
+	caKeyID        string
+	caOut          string
+	caHostValidity time.Duration
+)
+
+var (
+	caOutputColumns          = []string{"path", "fingerprint", "publicKey"}
+	certificateOutputColumns = []string{"path", "type", "keyId", "serial", "principals", "validAfter", "validBefore", "ca"}
+)
+
+type caOutput struct {
+	Path        string `json:"path"`
+	Fingerprint string `json:"fingerprint"`
+	PublicKey   string `json:"publicKey"`
+}
+
+func init() {
+	caInitCmd.Flags().StringVarP(&caType, "type", "t", keyring.TypeED25519, "the type of the key(ed25519|rsa|ecdsa)")
+	caInitCmd.Flags().IntVarP(&caBits, "bits", "b", 0, "the number of bits of rsa or ecdsa keys(default: 4096 for rsa, 256 for ecdsa)")
+	caInitCmd.Flags().StringVarP(&caComment, "comment", "C", "", "the comment of the key(default: zssh-ca@hostname)")
+	caInitCmd.Flags().BoolVar(&caPassphrase, "passphrase", false, "protect the private key with a passphrase read from the prompt")
+	caInitCmd.Flags().StringVar(&caHostPattern, "trust-hosts", "*", "the host pattern of the @cert-authority entry added to the known_hosts of the workspace(empty to skip)")
+	caSignUserCmd.Flags().StringVar(&caKeyName, "key", "", "the name of the managed key to sign instead of the public key file")
+	caSignUserCmd.Flags().StringSliceVar(&caPrincipals, "principal", nil, "the user names which the certificate is valid for")
+	caSignUserCmd.Flags().DurationVar(&caValidity, "validity", time.Hour, "the duration which the certificate is valid for from now")
+	caSignUserCmd.Flags().StringVar(&caKeyID, "id", "", "the key id of the certificate(default: the key name or the file name)")
+	caSignUserCmd.Flags().StringVar(&caOut, "out", "", "the certificate file(default: {key}-cert.pub next to the key)")
+	_ = caSignUserCmd.MarkFlagRequired("principal")
+	caSignHostCmd.Flags().StringSliceVar(&caPrincipals, "principal", nil, "the host names or addresses which the certificate is valid for")
+	caSignHostCmd.Flags().DurationVar(&caHostValidity, "validity", 365*24*time.Hour, "the duration which the certificate is valid for from now")
+	caSignHostCmd.Flags().StringVar(&caKeyID, "id", "", "the key id of the certificate(default: the first principal)")
+	caSignHostCmd.Flags().StringVar(&caOut, "out", "", "the certificate file(default: {key}-cert.pub next to the key)")
+	_ = caSignHostCmd.MarkFlagRequired("principal")
+
+	caCmd.AddCommand(caInitCmd, caShowCmd, caSignUserCmd, caSignHostCmd)
+	rootCmd.AddCommand(caCmd)
+}
+
+var caCmd = &cobra.Command{
+	Use:   "ca",
+	Short: "Manage the ssh certificate authority of the workspace",
+}
+
+var caInitCmd = &cobra.Command{
+	Use:   "init",
+	Short: "Create the key of the certificate authority in the workspace",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		opts := keyring.GenerateOptions{
+			Type:    caType,
+			Bits:    caBits,
+			Comment: caComment,
+		}
+		if opts.Comment == "" {
+			opts.Comment = "zssh-ca"
+			if hostname, err := os.Hostname(); err == nil {
+				opts.Comment += "@" + hostname
+			}
+		}
+		if caPassphrase {
+			passphrase, err := readNewPassphrase()
+			if err != nil {
+				if isUserCancelError(err) {
+					log.Info().Msg("😎 Good bye")
+					return nil
+				}
+				return errors.Wrap(err, "read the passphrase")
+			}
+			opts.Passphrase = passphrase
+		}
+		ca := workspaceCA()
+		publicKey, err := ca.Init(&opts)
+		if err != nil {
+			return errors.Wrap(err, "create the certificate authority")
+		}
+		authorizedKey := keyring.AuthorizedKey(publicKey)
+		if caHostPattern != "" {
+			files := knownHostsFiles()
+			if len(files) == 0 {
+				log.Warn().Msg("skip to trust the certificate authority. no known_hosts files in the configuration(knownHosts.files)")
+			} else if err := appendKnownHost(files[0], fmt.Sprintf("@cert-authority %s %s", caHostPattern, authorizedKey)); err != nil {
+				return errors.Wrapf(err, "trust the certificate authority in %s", files[0])
+			} else {
+				log.Info().Msgf("✅ trust host certificates of %s in %s", caHostPattern, files[0])
+			}
+		}
+		if structuredOutput() {
+			return printOutput(newCAOutput(ca, authorizedKey, keyring.Fingerprint(publicKey)), caOutputColumns)
+		}
+		log.Info().Msgf("✅ success to create the certificate authority %s", keyring.Fingerprint(publicKey))
+		logCATrust(ca, authorizedKey)
+		return nil
+	},
+}
+
+var caShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Show the public key of the certificate authority",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ca := workspaceCA()
+		publicKey, err := ca.PublicKey()
+		if err != nil {
+			return errors.Wrap(err, "read the certificate authority")
+		}
+		authorizedKey := keyring.AuthorizedKey(publicKey)
+		if structuredOutput() {
+			return printOutput(newCAOutput(ca, authorizedKey, keyring.Fingerprint(publicKey)), caOutputColumns)
+		}
+		log.Info().Msgf("⚡ Certificate authority: %s", keyring.Fingerprint(publicKey))
+		logCATrust(ca, authorizedKey)
+		return nil
+	},
+}
+
+var caSignUserCmd = &cobra.Command{
+	Use:   "sign-user [public key file]",
+	Short: "Issue a user certificate of the public key or the managed key",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var keyPath, keyID string
+		switch {
+		case caKeyName != "" && len(args) == 0:
+			k, err := findKey(caKeyName)
+			if err != nil {
+				return err
+			}
+			keyPath, keyID = keyRing.PublicKeyPath(k.Name), k.Name
+		case caKeyName == "" && len(args) == 1:
+			keyPath = expandPath(args[0])
+			keyID = strings.TrimSuffix(filepath.Base(keyPath), ".pub")
+		default:
+			return errors.New("either the public key file or --key is required")
+		}
+		if caKeyID != "" {
+			keyID = caKeyID
+		}
+		return signCertificate(keyPath, &keyring.SignOptions{KeyID: keyID, Principals: caPrincipals, Validity: caValidity}, false)
+	},
+}
+
+var caSignHostCmd = &cobra.Command{
+	Use:   "sign-host [public key file]",
+	Short: "Issue a host certificate of the host public key(e.g. ssh_host_ed25519_key.pub)",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		keyID := caKeyID
+		if keyID == "" && len(caPrincipals) > 0 {
+			keyID = caPrincipals[0]
+		}
+		return signCertificate(expandPath(args[0]), &keyring.SignOptions{KeyID: keyID, Principals: caPrincipals, Validity: caHostValidity}, true)
+	},
+}
+
+// signCertificate signs the public key in the given path with the certificate authority of the workspace
+// and writes the certificate to the --out flag or "{key}-cert.pub" next to the public key.
+func signCertificate(keyPath string, opts *keyring.SignOptions, hostCert bool) error {
+	if err := opts.Validate(); err != nil {
+		return errors.Wrap(err, "invalid --principal or --validity")
+	}
+	publicKey, err := keyring.ReadPublicKey(keyPath)
+	if err != nil {
+		return errors.Wrap(err, "read the public key")
+	}
+	ca := workspaceCA()
+	signer, err := ca.Signer("")
+	if err == keyring.ErrPassphraseRequired {
+		prompt := promptui.Prompt{Label: promptLabel("passphrase of the certificate authority"), Mask: '*'}
+		passphrase, perr := prompt.Run()
+		if perr != nil {
+			if isUserCancelError(perr) {
+				log.Info().Msg("😎 Good bye")
+				return nil
+			}
+			return errors.Wrap(perr, "read the passphrase")
+		}
+		signer, err = ca.Signer(passphrase)
+	}
+	if err != nil {
+		return errors.Wrap(err, "read the certificate authority")
+	}
+
+	sign := ca.SignUser
+	if hostCert {
+		sign = ca.SignHost
+	}
+	cert, err := sign(signer, publicKey, opts)
+	if err != nil {
+		return errors.Wrap(err, "sign the public key")
+	}
+	out := caOut
+	if out == "" {
+		out = strings.TrimSuffix(keyPath, ".pub") + "-cert.pub"
+	}
+	if err := keyring.WriteCertificate(out, cert); err != nil {
+		return errors.Wrap(err, "write the certificate")
+	}
+	info := ssh.NewCertificateInfo(out, cert)
+	if structuredOutput() {
+		return printOutput(info, certificateOutputColumns)
+	}
+	log.Info().Msgf("✅ success to issue the certificate %s", out)
+	logCertificate(info)
+	return nil
+}
+
+func workspaceCA() *keyring.CA {
+	return keyring.NewCA(filepath.Join(workspace, caDir))
+}
+
+func newCAOutput(ca *keyring.CA, authorizedKey, fingerprint string) *caOutput {
+	return &caOutput{Path: ca.PublicKeyPath(), Fingerprint: fingerprint, PublicKey: authorizedKey}
+}
+
+// logCATrust logs how to trust the certificate authority of the given public key.
+func logCATrust(ca *keyring.CA, authorizedKey string) {
+	log.Info().Msgf("  🔹 public key: %s", ca.PublicKeyPath())
+	log.Info().Msgf("  🔹 trust user certificates in authorized_keys: cert-authority %s", authorizedKey)
+	log.Info().Msgf("  🔹 trust user certificates in sshd_config: TrustedUserCAKeys %s", ca.PublicKeyPath())
+	log.Info().Msgf("  🔹 trust host certificates in known_hosts: @cert-authority * %s", authorizedKey)
+}
+
+// appendKnownHost appends the given line to the known_hosts file unless it exists.
+func appendKnownHost(path, line string) error {
+	b, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for _, l := range strings.Split(string(b), "\n") {
+		if strings.TrimSpace(l) == line {
+			return nil
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if len(b) > 0 && b[len(b)-1] != '\n' {
+		line = "\n" + line
+	}
+	_, err = f.WriteString(line + "\n")
+	return err
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/rs/zerolog/log"
+	"github.com/zacscoding/zssh/pkg/host"
+	"github.com/zacscoding/zssh/pkg/ssh"
+	"strings"
+	"time"
+)
+
+// certificateDetail is the details of the certificate of a host with its status for the user of the host.
+type certificateDetail struct {
+	*ssh.CertificateInfo
+	// Status is "valid" or the reason why the certificate is invalid.
+	Status string `json:"status"`
+}
+
+// hostDetail is a host with its certificate printed by 'host get'.
+type hostDetail struct {
+	info        *host.ServerInfo
+	certificate *certificateDetail
+}
+
+func (d *hostDetail) MarshalJSON() ([]byte, error) {
+	b, err := json.Marshal(d.info)
+	if err != nil || d.certificate == nil {
+		return b, err
+	}
+	cert, err := json.Marshal(d.certificate)
+	if err != nil {
+		return nil, err
+	}
+	// appends the certificate to the fields of the host to keep the order of them.
+	b = bytes.TrimSuffix(bytes.TrimSpace(b), []byte("}"))
+	return append(append(append(b, []byte(`,"certificate":`)...), cert...), '}'), nil
+}
+
+// hostCertificate returns the details of the certificate used to log in to the given host,
+// or nil if the host does not use a certificate. The given host is not changed.
+func hostCertificate(info *host.ServerInfo) (*certificateDetail, error) {
+	login := *info
+	applyHostConfig(&login)
+	if login.KeyName != "" {
+		login.KeyPath = keyRing.PrivateKeyPath(login.KeyName)
+	}
+	certPath := ssh.CertificatePath(&login)
+	if certPath == "" {
+		return nil, nil
+	}
+	cert, err := ssh.ReadCertificate(certPath)
+	if err != nil {
+		return nil, err
+	}
+	detail := certificateDetail{CertificateInfo: ssh.NewCertificateInfo(certPath, cert), Status: "valid"}
+	if err := ssh.ValidateCertificate(cert, login.User, time.Now()); err != nil {
+		detail.Status = err.Error()
+	}
+	return &detail, nil
+}
+
+// logCertificate logs the details of the given certificate.
+func logCertificate(cert *ssh.CertificateInfo) {
+	log.Info().Msgf("⚡ Certificate: %s", cert.Path)
+	log.Info().Msgf("  🔹 type: %s", cert.Type)
+	log.Info().Msgf("  🔹 key id: %s", cert.KeyID)
+	log.Info().Msgf("  🔹 serial: %d", cert.Serial)
+	log.Info().Msgf("  🔹 principals: %s", strings.Join(cert.Principals, ","))
+	log.Info().Msgf("  🔹 valid: %s", formatCertValidity(cert.ValidAfter, cert.ValidBefore))
+	log.Info().Msgf("  🔹 ca: %s", cert.CA)
+	log.Info().Msgf("  🔹 extensions: %s", strings.Join(cert.Extensions, ","))
+}
+
+// formatCertValidity formats the validity period of a certificate, where the zero time is the infinity.
+func formatCertValidity(after, before time.Time) string {
+	from, to := "any time", "forever"
+	if !after.IsZero() {
+		from = after.Format(time.RFC3339)
+	}
+	if !before.IsZero() {
+		to = before.Format(time.RFC3339)
+	}
+	return "from " + from + " to " + to
+}
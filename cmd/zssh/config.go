@@ -0,0 +1,78 @@
+package main
+
+import (
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"github.com/zacscoding/zssh/pkg/config"
+)
+
+var configOutputColumns = []string{"key", "value"}
+
+func init() {
+	configCmd.AddCommand(configGetCmd, configSetCmd, configListCmd)
+	rootCmd.AddCommand(configCmd)
+}
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Handle the workspace configuration",
+}
+
+var configGetCmd = &cobra.Command{
+	Use:   "get [key]",
+	Short: "Get a configuration value",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		v, err := workspaceConfig.Get(args[0])
+		if err != nil {
+			return err
+		}
+		if structuredOutput() {
+			return printOutput(&configOutput{Key: args[0], Value: v}, configOutputColumns)
+		}
+		log.Info().Msgf("%s: %s", args[0], v)
+		return nil
+	},
+}
+
+var configSetCmd = &cobra.Command{
+	Use:   "set [key] [value]",
+	Short: "Set a configuration value (e.g. 'zssh config set hosts.web.port 2222')",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := config.Set(workspace, args[0], args[1]); err != nil {
+			return errors.Wrapf(err, "set the config(%s)", args[0])
+		}
+		log.Info().Msgf("✅ success to set %s: %s", args[0], args[1])
+		return nil
+	},
+}
+
+var configListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List configuration values",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		values, err := workspaceConfig.Values()
+		if err != nil {
+			return errors.Wrap(err, "read config values")
+		}
+		var outputs []*configOutput
+		for _, k := range config.Keys(values) {
+			outputs = append(outputs, &configOutput{Key: k, Value: values[k]})
+		}
+		if structuredOutput() {
+			return printOutput(outputs, configOutputColumns)
+		}
+		log.Info().Msgf("⚡ Configuration of %s", workspace)
+		for _, o := range outputs {
+			log.Info().Msgf("  🔹 %s: %s", o.Key, o.Value)
+		}
+		return nil
+	},
+}
+
+type configOutput struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
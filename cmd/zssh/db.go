@@ -0,0 +1,73 @@
+package main
+
+import (
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"time"
+)
+
+var (
+	dbMigrateTarget int
+)
+
+var migrationOutputColumns = []string{"version", "name", "applied", "appliedAt"}
+
+func init() {
+	dbMigrateCmd.Flags().IntVar(&dbMigrateTarget, "to", -1, "the target version to migrate(default: latest). rolls back if lower than current version")
+
+	dbCmd.AddCommand(dbMigrateCmd, dbStatusCmd)
+	rootCmd.AddCommand(dbCmd)
+}
+
+var dbCmd = &cobra.Command{
+	Use:   "db",
+	Short: "Handle the workspace database",
+}
+
+var dbMigrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Migrate the database schema",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		backupPath, err := migrator.Migrate(dbMigrateTarget)
+		if err != nil {
+			return errors.Wrap(err, "migrate the database")
+		}
+		current, err := migrator.CurrentVersion()
+		if err != nil {
+			return errors.Wrap(err, "find the current version")
+		}
+		if backupPath != "" {
+			log.Info().Msgf("Backup the database to %s", backupPath)
+		}
+		log.Info().Msgf("✅ Current version: v%d", current)
+		return nil
+	},
+}
+
+var dbStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Get status of the database migrations",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		statuses, err := migrator.Status()
+		if err != nil {
+			return errors.Wrap(err, "find migrations")
+		}
+		if structuredOutput() {
+			return printOutput(statuses, migrationOutputColumns)
+		}
+		current, err := migrator.CurrentVersion()
+		if err != nil {
+			return errors.Wrap(err, "find the current version")
+		}
+		log.Info().Msgf("⚡ Current version: v%d, latest version: v%d", current, migrator.LatestVersion())
+		for _, status := range statuses {
+			if status.Applied {
+				log.Info().Msgf("  ✅ v%d %s (applied at %s)", status.Version, status.Name, status.AppliedAt.Format(time.RFC3339))
+			} else {
+				log.Info().Msgf("  🔸 v%d %s (pending)", status.Version, status.Name)
+			}
+		}
+		return nil
+	},
+}
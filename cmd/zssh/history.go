@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"github.com/zacscoding/zssh/pkg/history"
+	"github.com/zacscoding/zssh/pkg/host"
+	"github.com/zacscoding/zssh/pkg/ssh"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	historyHostName   string
+	historyType       string
+	historySince      string
+	historyUntil      string
+	historyFailedOnly bool
+	historyLimit      int
+)
+
+func init() {
+	historyCmd.Flags().StringVarP(&historyHostName, "name", "n", "", "the host name of identifier")
+	historyCmd.Flags().StringVarP(&historyType, "type", "t", "", "the connection type(shell|exec)")
+	historyCmd.Flags().StringVar(&historySince, "since", "", "show connections since the duration ago(e.g. 24h) or the date(e.g. 2006-01-02)")
+	historyCmd.Flags().StringVar(&historyUntil, "until", "", "show connections until the duration ago(e.g. 24h) or the date(e.g. 2006-01-02)")
+	historyCmd.Flags().BoolVar(&historyFailedOnly, "failed", false, "show failed connections only")
+	historyCmd.Flags().IntVarP(&historyLimit, "limit", "l", 50, "the maximum number of connections to show(0 is unlimited)")
+
+	rootCmd.AddCommand(historyCmd)
+}
+
+var historyCmd = &cobra.Command{
+	Use:   "history",
+	Short: "Get connection history",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		filter := history.Filter{
+			HostName:   historyHostName,
+			Type:       historyType,
+			FailedOnly: historyFailedOnly,
+			Limit:      historyLimit,
+		}
+		switch historyType {
+		case "", history.TypeShell, history.TypeExec:
+		default:
+			return fmt.Errorf("invalid connection type: %s", historyType)
+		}
+		var err error
+		if filter.Since, err = parseTimeFlag(historySince); err != nil {
+			return errors.Wrap(err, "parse since")
+		}
+		if filter.Until, err = parseTimeFlag(historyUntil); err != nil {
+			return errors.Wrap(err, "parse until")
+		}
+
+		connections, err := historyStore.Find(context.Background(), &filter)
+		if err != nil {
+			return errors.Wrap(err, "find connections")
+		}
+		if structuredOutput() {
+			return printOutput(connections, connectionOutputColumns)
+		}
+		log.Info().Msgf("⚡ Total connections: #%d", len(connections))
+		for _, c := range connections {
+			if c.Succeeded() {
+				log.Info().Msgf("  🔹 %s", c.String())
+			} else {
+				log.Info().Msgf("  🔸 %s", c.String())
+			}
+		}
+		return nil
+	},
+}
+
+// parseTimeFlag parses the given value as a duration ago from now or a date.
+// It returns zero time if the value is empty.
+func parseTimeFlag(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	for _, layout := range []string{"2006-01-02", time.RFC3339} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid duration or date: %s", value)
+}
+
+// startConnection saves a new connection record to the given host and returns it with an ioCounter
+// to count bytes transferred in the connection.
+func startConnection(info *host.ServerInfo, connType, command string) (*history.Connection, *ioCounter) {
+	c := history.Connection{
+		ServerInfoID: info.ID,
+		HostName:     info.Name,
+		Type:         connType,
+		Command:      command,
+		StartedAt:    time.Now(),
+	}
+	if err := historyStore.Save(context.Background(), &c); err != nil {
+		log.Warn().Err(err).Msg("failed to save the connection history")
+	}
+	return &c, new(ioCounter)
+}
+
+// finishConnection updates the given connection record with the result of the connection.
+func finishConnection(c *history.Connection, counter *ioCounter, err error) {
+	now := time.Now()
+	c.EndedAt = &now
+	c.ExitStatus = ssh.ExitStatus(err)
+	if err != nil && c.ExitStatus == -1 {
+		c.Error = err.Error()
+	}
+	c.BytesSent = atomic.LoadInt64(&counter.sent)
+	c.BytesReceived = atomic.LoadInt64(&counter.received)
+	if err := historyStore.Update(context.Background(), c); err != nil {
+		log.Warn().Err(err).Msg("failed to update the connection history")
+	}
+}
+
+// ioCounter counts bytes read from stdin and written to stdout, stderr of a connection.
+type ioCounter struct {
+	sent     int64
+	received int64
+}
+
+func (c *ioCounter) reader(r io.Reader) io.Reader {
+	return &countingReader{r: r, n: &c.sent}
+}
+
+func (c *ioCounter) writer(w io.Writer) io.Writer {
+	return &countingWriter{w: w, n: &c.received}
+}
+
+type countingReader struct {
+	r io.Reader
+	n *int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	atomic.AddInt64(cr.n, int64(n))
+	return n, err
+}
+
+type countingWriter struct {
+	w io.Writer
+	n *int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	atomic.AddInt64(cw.n, int64(n))
+	return n, err
+}
@@ -9,29 +9,65 @@ import (
 	"github.com/spf13/cobra"
 	"github.com/zacscoding/zssh/pkg/host"
 	"gorm.io/gorm"
-	"os"
+	"net"
 	"strconv"
-)
-
-const (
-	defaultHostPort = 22
+	"strings"
+	"time"
 )
 
 var (
 	hostName        string
 	hostUser        string
 	hostAddress     string
-	hostPort        = defaultHostPort
+	hostPort        int
 	hostPassword    string
 	hostKeyPath     string
+	hostKeyName     string
+	hostCertPath    string
 	hostDescription string
+	hostAliases     string
+	hostAddresses   string
+	hostTags        string
+)
+
+var (
+	hostQueryName          string
+	hostQueryCIDR          string
+	hostQueryUser          string
+	hostQueryTags          []string
+	hostQueryCreatedAfter  string
+	hostQueryCreatedBefore string
+	hostQueryUpdatedAfter  string
+	hostQueryUpdatedBefore string
+	hostQuerySort          string
+	hostQueryLimit         int
+	hostQueryOffset        int
+	hostQueryCursor        string
 )
 
+var hostRevertTo int
+
 func init() {
 	hostGetCmd.PersistentFlags().StringVarP(&hostName, "name", "n", "", "the host name of identifier")
 	hostDeleteCmd.PersistentFlags().StringVarP(&hostName, "name", "n", "", "the host name of identifier")
 
-	hostCmd.AddCommand(hostAddCmd, hostSelectCmd, hostActiveCmd, hostGetCmd, hostGetsCmd, hostUpdateCmd, hostDeleteCmd)
+	hostGetsCmd.Flags().StringVarP(&hostQueryName, "name", "n", "", "the glob pattern of host names(e.g. 'web-*')")
+	hostGetsCmd.Flags().StringVar(&hostQueryCIDR, "cidr", "", "the network of host addresses(e.g. 10.0.0.0/8)")
+	hostGetsCmd.Flags().StringVarP(&hostQueryUser, "user", "u", "", "the user of hosts")
+	hostGetsCmd.Flags().StringSliceVarP(&hostQueryTags, "tag", "t", nil, "the tags which hosts have all of")
+	hostGetsCmd.Flags().StringVar(&hostQueryCreatedAfter, "created-after", "", "hosts created after the duration ago(e.g. 24h) or the date(e.g. 2006-01-02)")
+	hostGetsCmd.Flags().StringVar(&hostQueryCreatedBefore, "created-before", "", "hosts created before the duration ago(e.g. 24h) or the date(e.g. 2006-01-02)")
+	hostGetsCmd.Flags().StringVar(&hostQueryUpdatedAfter, "updated-after", "", "hosts updated after the duration ago(e.g. 24h) or the date(e.g. 2006-01-02)")
+	hostGetsCmd.Flags().StringVar(&hostQueryUpdatedBefore, "updated-before", "", "hosts updated before the duration ago(e.g. 24h) or the date(e.g. 2006-01-02)")
+	hostGetsCmd.Flags().StringVar(&hostQuerySort, "sort", host.SortByID, "the field to sort by, prefixed with '-' for the descending order("+strings.Join(host.SortFields(), "|")+")")
+	hostGetsCmd.Flags().IntVarP(&hostQueryLimit, "limit", "l", 0, "the maximum number of hosts to show(0 is unlimited)")
+	hostGetsCmd.Flags().IntVar(&hostQueryOffset, "offset", 0, "the number of hosts to skip")
+	hostGetsCmd.Flags().StringVar(&hostQueryCursor, "cursor", "", "the cursor of the next page printed by the previous page")
+
+	hostRevertCmd.Flags().IntVar(&hostRevertTo, "to", 0, "the revision to revert to(see 'zssh host history')")
+
+	hostCmd.AddCommand(hostAddCmd, hostSelectCmd, hostActiveCmd, hostGetCmd, hostGetsCmd, hostUpdateCmd, hostDeleteCmd,
+		hostStatsCmd, hostTrashCmd, hostRestoreCmd, hostPurgeCmd, hostHistoryCmd, hostRevertCmd)
 	rootCmd.AddCommand(hostCmd)
 }
 
@@ -44,6 +80,9 @@ var hostAddCmd = &cobra.Command{
 	Use:   "add",
 	Short: "Adds a new host info",
 	RunE: func(cmd *cobra.Command, args []string) error {
+		hostUser = workspaceConfig.User
+		hostPort = workspaceConfig.Port
+		hostKeyPath = workspaceConfig.KeyPath
 		if err := readHostPrompt(); err != nil {
 			if isUserCancelError(err) {
 				log.Info().Msg("😎 Good bye")
@@ -51,6 +90,10 @@ var hostAddCmd = &cobra.Command{
 			}
 			return errors.Wrap(err, "read server info")
 		}
+		addresses, err := parseAddresses(hostAddresses)
+		if err != nil {
+			return errors.Wrap(err, "parse the addresses")
+		}
 		h := host.ServerInfo{
 			Name:        hostName,
 			User:        hostUser,
@@ -58,7 +101,12 @@ var hostAddCmd = &cobra.Command{
 			Port:        hostPort,
 			Password:    hostPassword,
 			KeyPath:     hostKeyPath,
+			KeyName:     hostKeyName,
+			CertPath:    hostCertPath,
 			Description: hostDescription,
+			Aliases:     parseAliases(hostAliases),
+			Addresses:   addresses,
+			Tags:        parseTags(hostTags),
 		}
 		if err := hostStore.Save(context.Background(), &h); err != nil {
 			return errors.Wrap(err, "save the host")
@@ -100,6 +148,9 @@ var hostActiveCmd = &cobra.Command{
 			}
 			return errors.Wrap(err, "find the activated host")
 		}
+		if structuredOutput() {
+			return printOutput(info, hostOutputColumns)
+		}
 		log.Info().Msgf("✅ Active host: %s", info.String())
 		return nil
 	},
@@ -118,23 +169,74 @@ var hostGetCmd = &cobra.Command{
 			}
 			return errors.Wrapf(err, "find the host(%s)", hostname)
 		}
+		cert, err := hostCertificate(info)
+		if err != nil {
+			return errors.Wrapf(err, "read the certificate of the host(%s)", hostname)
+		}
+		if structuredOutput() {
+			return printOutput(&hostDetail{info: info, certificate: cert}, hostOutputColumns)
+		}
 		log.Info().Msg(info.ToJSON(true))
+		if cert != nil {
+			logCertificate(cert.CertificateInfo)
+			if cert.Status != "valid" {
+				log.Warn().Msgf("  🔸 status: %s", cert.Status)
+			} else {
+				log.Info().Msgf("  🔹 status: %s", cert.Status)
+			}
+		}
 		return nil
 	},
 }
 
 var hostGetsCmd = &cobra.Command{
 	Use:   "gets",
-	Short: "Get host all",
+	Short: "Get hosts matched by the flags",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		hosts, err := hostStore.FindAll(context.Background())
+		q, err := hostQuery()
 		if err != nil {
-			return errors.Wrap(err, "find all hosts")
+			return err
 		}
-		log.Info().Msgf("⚡ Total hosts: #%d", len(hosts))
-		for _, info := range hosts {
+		page, err := hostStore.Find(context.Background(), q)
+		if err != nil {
+			return errors.Wrap(err, "find hosts")
+		}
+		if structuredOutput() {
+			if page.NextCursor != "" {
+				fmt.Fprintf(stderr, "next cursor: %s\n", page.NextCursor)
+			}
+			return printOutput(page.Hosts, hostOutputColumns)
+		}
+		if int64(len(page.Hosts)) == page.Total {
+			log.Info().Msgf("⚡ Total hosts: #%d", page.Total)
+		} else {
+			log.Info().Msgf("⚡ Total hosts: #%d (#%d shown)", page.Total, len(page.Hosts))
+		}
+		for _, info := range page.Hosts {
 			log.Info().Msgf("  🔹 %s", info.ToJSON(false))
 		}
+		if page.NextCursor != "" {
+			log.Info().Msgf("⚡ Next page: --cursor %s", page.NextCursor)
+		}
+		return nil
+	},
+}
+
+var hostStatsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "Get usage statistics of hosts",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		stats, err := historyStore.Stats(context.Background())
+		if err != nil {
+			return errors.Wrap(err, "find usage statistics")
+		}
+		if structuredOutput() {
+			return printOutput(stats, statsOutputColumns)
+		}
+		log.Info().Msgf("⚡ Total used hosts: #%d", len(stats))
+		for _, st := range stats {
+			log.Info().Msgf("  🔹 %s", st.String())
+		}
 		return nil
 	},
 }
@@ -149,7 +251,7 @@ var hostUpdateCmd = &cobra.Command{
 				log.Info().Msg("😎 Good bye")
 				return nil
 			}
-			errors.Wrap(err, "select the host")
+			return errors.Wrap(err, "select the host")
 		}
 
 		hostName = info.Name
@@ -158,7 +260,12 @@ var hostUpdateCmd = &cobra.Command{
 		hostPort = info.Port
 		hostPassword = info.Password
 		hostKeyPath = info.KeyPath
+		hostKeyName = info.KeyName
+		hostCertPath = info.CertPath
 		hostDescription = info.Description
+		hostAliases = strings.Join(info.AliasNames(), ",")
+		hostAddresses = strings.Join(info.Endpoints()[1:], ",")
+		hostTags = strings.Join(info.TagNames(), ",")
 
 		if err := readHostPrompt(); err != nil {
 			if isUserCancelError(err) {
@@ -167,6 +274,10 @@ var hostUpdateCmd = &cobra.Command{
 			}
 			return errors.Wrap(err, "read server info")
 		}
+		addresses, err := parseAddresses(hostAddresses)
+		if err != nil {
+			return errors.Wrap(err, "parse the addresses")
+		}
 		update := host.ServerInfo{
 			ID:          info.ID,
 			Name:        hostName,
@@ -175,7 +286,12 @@ var hostUpdateCmd = &cobra.Command{
 			Port:        hostPort,
 			Password:    hostPassword,
 			KeyPath:     hostKeyPath,
+			KeyName:     hostKeyName,
+			CertPath:    hostCertPath,
 			Description: hostDescription,
+			Aliases:     parseAliases(hostAliases),
+			Addresses:   addresses,
+			Tags:        parseTags(hostTags),
 		}
 		if _, err := hostStore.Update(context.Background(), &update); err != nil {
 			return errors.Wrap(err, "update the host")
@@ -195,81 +311,156 @@ var hostDeleteCmd = &cobra.Command{
 				log.Info().Msg("😎 Good bye")
 				return nil
 			}
-			errors.Wrap(err, "select the host")
+			return errors.Wrap(err, "select the host")
 		}
 
-		ok, err := confirmPrompt(fmt.Sprintf("remove %s?", info.String()))
-		if err != nil {
-			if isUserCancelError(err) {
-				log.Info().Msg("😎 Good bye")
+		if workspaceConfig.ConfirmDelete {
+			ok, err := confirmPrompt(fmt.Sprintf("remove %s?", info.String()))
+			if err != nil {
+				if isUserCancelError(err) {
+					log.Info().Msg("😎 Good bye")
+					return nil
+				}
+				return errors.Wrap(err, "confirm to delete")
+			}
+			if !ok {
+				log.Info().Msgf("Cancel to delete the host(%s)", info.String())
 				return nil
 			}
-			errors.Wrap(err, "confirm to delete")
-		}
-		if !ok {
-			log.Info().Msgf("Cancel to delete the host(%s)", info.String())
-			return nil
 		}
 
 		deleted, err := hostStore.DeleteByName(context.Background(), info.Name)
 		if err != nil {
-			return errors.Wrapf(err, "delete the host(%s)", hostName)
+			return errors.Wrapf(err, "delete the host(%s)", info.Name)
 		}
 		if deleted == 0 {
-			return errors.Wrapf(err, "host(%s) not found", hostName)
+			return fmt.Errorf("host(%s) not found", info.Name)
 		}
-		log.Info().Msgf("Success to delete the host(%s)", hostName)
+		log.Info().Msgf("Success to move the host(%s) to the trash. Restore it by 'zssh host restore %s'", info.Name, info.Name)
 		return nil
 	},
 }
 
-func selectHostPrompt() (*host.ServerInfo, error) {
-	ctx := context.Background()
-	hosts, err := hostStore.FindAll(ctx)
-	if err != nil {
-		log.Error().Msgf("failed to find hosts. reason: %v", err)
-		os.Exit(1)
-	}
-	if len(hosts) == 0 {
-		log.Error().Msg("empty hosts")
-		os.Exit(1)
-	}
-
-	var hostNames []string
-	for _, info := range hosts {
-		hostNames = append(hostNames, info.Name)
-	}
+var hostTrashCmd = &cobra.Command{
+	Use:   "trash",
+	Short: "Get hosts in the trash",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		servers, err := hostStore.FindTrash(context.Background())
+		if err != nil {
+			return errors.Wrap(err, "find hosts in the trash")
+		}
+		if structuredOutput() {
+			return printOutput(servers, trashOutputColumns)
+		}
+		log.Info().Msgf("⚡ Total hosts in the trash: #%d", len(servers))
+		for _, info := range servers {
+			log.Info().Msgf("  🔹 %s (deleted at %s)", info.String(), info.DeletedAt.Time.Format(time.RFC3339))
+		}
+		return nil
+	},
+}
 
-	p := promptui.Select{
-		Label: "Select host",
-		Items: hostNames,
-		Size:  10,
-	}
+var hostRestoreCmd = &cobra.Command{
+	Use:   "restore [name]",
+	Short: "Restore the host from the trash",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		info, err := hostStore.Restore(context.Background(), args[0])
+		if err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return errors.Wrapf(err, "host(%s) not found in the trash", args[0])
+			}
+			return errors.Wrapf(err, "restore the host(%s)", args[0])
+		}
+		log.Info().Msgf("✅ success to restore the host\n%s", info.ToJSON(true))
+		return nil
+	},
+}
 
-	_, selected, err := p.Run()
-	if err != nil {
-		os.Exit(1)
-	}
+var hostPurgeCmd = &cobra.Command{
+	Use:   "purge [names...]",
+	Short: "Delete hosts in the trash permanently. All hosts in the trash are purged if no names are given",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if workspaceConfig.ConfirmDelete {
+			target := "all hosts in the trash"
+			if len(args) != 0 {
+				target = strings.Join(args, ", ")
+			}
+			ok, err := confirmPrompt(fmt.Sprintf("purge %s permanently?", target))
+			if err != nil {
+				if isUserCancelError(err) {
+					log.Info().Msg("😎 Good bye")
+					return nil
+				}
+				return errors.Wrap(err, "confirm to purge")
+			}
+			if !ok {
+				log.Info().Msg("Cancel to purge hosts")
+				return nil
+			}
+		}
+		purged, err := hostStore.Purge(context.Background(), args...)
+		if err != nil {
+			return errors.Wrap(err, "purge hosts")
+		}
+		log.Info().Msgf("✅ Purged hosts: #%d", purged)
+		return nil
+	},
+}
 
-	var (
-		selectedHostName = selected
-		selectedHost     *host.ServerInfo
-	)
+var hostHistoryCmd = &cobra.Command{
+	Use:   "history [name]",
+	Short: "Get revisions of the host",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		revisions, err := hostStore.FindRevisions(context.Background(), args[0])
+		if err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return errors.Wrapf(err, "host(%s) not found", args[0])
+			}
+			return errors.Wrapf(err, "find revisions of the host(%s)", args[0])
+		}
+		if structuredOutput() {
+			return printOutput(revisions, revisionOutputColumns)
+		}
+		log.Info().Msgf("⚡ Total revisions: #%d", len(revisions))
+		for _, r := range revisions {
+			actor := r.Actor
+			if actor == "" {
+				actor = "-"
+			}
+			log.Info().Msgf("  🔹 #%d %s by %s at %s %s", r.Rev, r.Action, actor, r.CreatedAt.Format(time.RFC3339), r.Changes.String())
+		}
+		return nil
+	},
+}
 
-	for _, info := range hosts {
-		if info.Name == selectedHostName {
-			selectedHost = info
-			break
+var hostRevertCmd = &cobra.Command{
+	Use:   "revert [name]",
+	Short: "Revert the host to the revision",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if hostRevertTo <= 0 {
+			return errors.New("--to is required")
 		}
-	}
-	return selectedHost, nil
+		info, err := hostStore.Revert(context.Background(), args[0], hostRevertTo)
+		if err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return errors.Wrapf(err, "host(%s) not found", args[0])
+			}
+			return errors.Wrapf(err, "revert the host(%s)", args[0])
+		}
+		log.Info().Msgf("✅ success to revert the host to the revision %d\n%s", hostRevertTo, info.ToJSON(true))
+		return nil
+	},
 }
 
 func readHostPrompt() error {
 	inputs := []struct {
-		label  string
-		valueP interface{}
-		mask   rune
+		label    string
+		valueP   interface{}
+		mask     rune
+		validate promptui.ValidateFunc
 	}{
 		{label: "name", valueP: &hostName},
 		{label: "user", valueP: &hostUser},
@@ -277,16 +468,25 @@ func readHostPrompt() error {
 		{label: "port", valueP: &hostPort},
 		{label: "password", valueP: &hostPassword, mask: '*'},
 		{label: "keypath", valueP: &hostKeyPath},
+		{label: "key(managed key name used instead of the keypath)", valueP: &hostKeyName, validate: validateKeyName},
+		{label: "certpath(default: {keypath}-cert.pub if exists)", valueP: &hostCertPath},
 		{label: "description", valueP: &hostDescription},
+		{label: "aliases(comma separated)", valueP: &hostAliases},
+		{label: "alternate addresses(comma separated address[:port])", valueP: &hostAddresses, validate: func(input string) error {
+			_, err := parseAddresses(input)
+			return err
+		}},
+		{label: "tags(comma separated)", valueP: &hostTags},
 	}
 
 	for _, input := range inputs {
 		switch p := input.valueP.(type) {
 		case *string:
 			prompt := promptui.Prompt{
-				Label:   input.label,
-				Mask:    input.mask,
-				Default: *p,
+				Label:    promptLabel(input.label),
+				Mask:     input.mask,
+				Default:  *p,
+				Validate: input.validate,
 			}
 			result, err := prompt.Run()
 			if err != nil {
@@ -295,7 +495,7 @@ func readHostPrompt() error {
 			*p = result
 		case *int:
 			prompt := promptui.Prompt{
-				Label:   input.label,
+				Label:   promptLabel(input.label),
 				Mask:    input.mask,
 				Default: strconv.Itoa(*p),
 				Validate: func(input string) error {
@@ -317,3 +517,89 @@ func readHostPrompt() error {
 	}
 	return nil
 }
+
+// splitList splits the given comma separated value and drops empty elements.
+func splitList(value string) []string {
+	var values []string
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+func parseAliases(value string) []host.ServerAlias {
+	var aliases []host.ServerAlias
+	for _, name := range splitList(value) {
+		aliases = append(aliases, host.ServerAlias{Name: name})
+	}
+	return aliases
+}
+
+// parseTags parses the given comma separated tags without duplicates.
+func parseTags(value string) []host.ServerTag {
+	var (
+		tags []host.ServerTag
+		seen = make(map[string]bool)
+	)
+	for _, name := range splitList(value) {
+		if !seen[name] {
+			seen[name] = true
+			tags = append(tags, host.ServerTag{Name: name})
+		}
+	}
+	return tags
+}
+
+// hostQuery returns the host.Query of the flags of the gets command.
+func hostQuery() (*host.Query, error) {
+	q := host.Query{
+		Name:   hostQueryName,
+		CIDR:   hostQueryCIDR,
+		User:   hostQueryUser,
+		Tags:   hostQueryTags,
+		SortBy: strings.TrimPrefix(hostQuerySort, "-"),
+		Desc:   strings.HasPrefix(hostQuerySort, "-"),
+		Limit:  hostQueryLimit,
+		Offset: hostQueryOffset,
+		Cursor: hostQueryCursor,
+	}
+	for _, t := range []struct {
+		value string
+		p     *time.Time
+	}{
+		{hostQueryCreatedAfter, &q.CreatedAfter},
+		{hostQueryCreatedBefore, &q.CreatedBefore},
+		{hostQueryUpdatedAfter, &q.UpdatedAfter},
+		{hostQueryUpdatedBefore, &q.UpdatedBefore},
+	} {
+		v, err := parseTimeFlag(t.value)
+		if err != nil {
+			return nil, err
+		}
+		*t.p = v
+	}
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+	return &q, nil
+}
+
+// parseAddresses parses the given comma separated "address[:port]" values to host.ServerAddress.
+func parseAddresses(value string) ([]host.ServerAddress, error) {
+	var addresses []host.ServerAddress
+	for i, v := range splitList(value) {
+		addr := host.ServerAddress{Seq: i, Address: v}
+		if h, p, err := net.SplitHostPort(v); err == nil {
+			port, err := strconv.Atoi(p)
+			if err != nil {
+				return nil, fmt.Errorf("invalid port in %s", v)
+			}
+			addr.Address = h
+			addr.Port = port
+		}
+		addresses = append(addresses, addr)
+	}
+	return addresses, nil
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/manifoldco/promptui"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"github.com/zacscoding/zssh/pkg/host"
+	"github.com/zacscoding/zssh/pkg/inventory"
+	"strings"
+)
+
+const (
+	syncStrategyAsk    = "ask"
+	syncStrategyLocal  = "local"
+	syncStrategyRemote = "remote"
+)
+
+var (
+	syncRemote   string
+	syncStrategy string
+)
+
+func init() {
+	syncInventoryCmd.Flags().StringVar(&syncRemote, "remote", "", "the local path or file url of the remote inventory repository")
+	syncInventoryCmd.Flags().StringVar(&syncStrategy, "strategy", syncStrategyAsk, "how to resolve conflicts of fields(ask|local|remote)")
+
+	rootCmd.AddCommand(syncInventoryCmd)
+}
+
+var syncInventoryCmd = &cobra.Command{
+	Use:   "sync-inventory",
+	Short: "Synchronize non-secret host data with the git repository of the inventory",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		resolve, err := newInventoryResolver(syncStrategy)
+		if err != nil {
+			return err
+		}
+		repo, err := inventory.Init(workspace)
+		if err != nil {
+			return errors.Wrap(err, "initialize the inventory")
+		}
+		if syncRemote != "" {
+			if err := repo.SetRemote(syncRemote); err != nil {
+				return errors.Wrap(err, "set the remote")
+			}
+		}
+
+		store := hostStore
+		if syncStore, ok := hostStore.(*inventory.SyncStore); ok {
+			store = syncStore.Store
+		}
+		result, err := repo.Sync(context.Background(), store, resolve)
+		if err != nil {
+			if isUserCancelError(err) {
+				log.Info().Msg("😎 Good bye")
+				return nil
+			}
+			return errors.Wrap(err, "sync the inventory")
+		}
+
+		for _, item := range []struct {
+			label string
+			names []string
+		}{
+			{"Added", result.Added},
+			{"Updated", result.Updated},
+			{"Deleted", result.Deleted},
+		} {
+			if len(item.names) != 0 {
+				log.Info().Msgf("  🔹 %s: %s", item.label, strings.Join(item.names, ", "))
+			}
+		}
+		log.Info().Msgf("✅ success to sync the inventory(%s). committed: %v, merged: %v, pushed: %v",
+			repo.Dir(), result.Committed, result.Merged, result.Pushed)
+		return nil
+	},
+}
+
+// newSyncStore wraps the given store to commit changes to the inventory if the inventory is initialized.
+func newSyncStore(store host.Store) (host.Store, error) {
+	repo, err := inventory.Open(workspace)
+	if err != nil {
+		if err == inventory.ErrNotInitialized {
+			return store, nil
+		}
+		return nil, err
+	}
+	return inventory.NewSyncStore(store, repo, func(err error) {
+		log.Warn().Err(err).Msg("failed to commit the inventory")
+	}), nil
+}
+
+func newInventoryResolver(strategy string) (inventory.Resolver, error) {
+	switch strategy {
+	case syncStrategyLocal:
+		return func(c *inventory.Conflict) (inventory.Side, error) {
+			return inventory.SideLocal, nil
+		}, nil
+	case syncStrategyRemote:
+		return func(c *inventory.Conflict) (inventory.Side, error) {
+			return inventory.SideRemote, nil
+		}, nil
+	case syncStrategyAsk:
+		return func(c *inventory.Conflict) (inventory.Side, error) {
+			p := promptui.Select{
+				Label: promptLabel(fmt.Sprintf("Conflict of %s in the host(%s)", c.Field, c.Host)),
+				Items: []string{
+					fmt.Sprintf("local: %q", c.Local),
+					fmt.Sprintf("remote: %q", c.Remote),
+				},
+			}
+			idx, _, err := p.Run()
+			if err != nil {
+				return inventory.SideLocal, err
+			}
+			return []inventory.Side{inventory.SideLocal, inventory.SideRemote}[idx], nil
+		}, nil
+	}
+	return nil, fmt.Errorf("invalid strategy: %s", strategy)
+}
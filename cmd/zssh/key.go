@@ -0,0 +1,553 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/manifoldco/promptui"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"github.com/zacscoding/zssh/pkg/host"
+	"github.com/zacscoding/zssh/pkg/keyring"
+	"github.com/zacscoding/zssh/pkg/ssh"
+	"gorm.io/gorm"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// keysDir is the directory of managed keys in the workspace.
+	keysDir = "keys"
+	// rotationsDir is the directory of state files of key rotations in the workspace.
+	rotationsDir = "rotations"
+)
+
+var (
+	keyType       string
+	keyBits       int
+	keyComment    string
+	keyPassphrase bool
+	keyForce      bool
+
+	keyInstallHost   string
+	keyInstallName   string
+	keyInstallSwitch bool
+
+	keyRotateFrom     string
+	keyRotateTo       string
+	keyRotateTags     []string
+	keyRotateParallel int
+	keyRotateState    string
+)
+
+var (
+	keyOutputColumns      = []string{"id", "name", "type", "bits", "fingerprint", "comment", "encrypted", "createdAt"}
+	rotationOutputColumns = []string{"host", "step", "error", "updatedAt"}
+)
+
+func init() {
+	keyGenerateCmd.Flags().StringVarP(&keyType, "type", "t", keyring.TypeED25519, "the type of the key(ed25519|rsa|ecdsa)")
+	keyGenerateCmd.Flags().IntVarP(&keyBits, "bits", "b", 0, "the number of bits of rsa or ecdsa keys(default: 4096 for rsa, 256 for ecdsa)")
+	keyGenerateCmd.Flags().StringVarP(&keyComment, "comment", "C", "", "the comment of the key(default: user@hostname)")
+	keyGenerateCmd.Flags().BoolVar(&keyPassphrase, "passphrase", false, "protect the private key with a passphrase read from the prompt")
+	keyDeleteCmd.Flags().BoolVarP(&keyForce, "force", "f", false, "delete the key even if hosts use it")
+	keyInstallCmd.Flags().StringVarP(&keyInstallHost, "name", "n", "", "the host name of identifier(default: the active host)")
+	keyInstallCmd.Flags().StringVar(&keyInstallName, "key", "", "the name of the managed key to install")
+	keyInstallCmd.Flags().BoolVar(&keyInstallSwitch, "switch", false, "switch the host to the key and clear the stored password after the key login is verified")
+	_ = keyInstallCmd.MarkFlagRequired("key")
+	keyRotateCmd.Flags().StringVar(&keyRotateFrom, "from", "", "the name of the managed key to rotate")
+	keyRotateCmd.Flags().StringVar(&keyRotateTo, "to", "", "the name of the new managed key")
+	keyRotateCmd.Flags().StringSliceVarP(&keyRotateTags, "tag", "t", nil, "rotate only hosts which have all the tags")
+	keyRotateCmd.Flags().IntVar(&keyRotateParallel, "parallel", 5, "the number of hosts to rotate at the same time")
+	keyRotateCmd.Flags().StringVar(&keyRotateState, "state", "", "the state file to resume the rotation(default: {workspace}/rotations/{from}-{to}.json)")
+	_ = keyRotateCmd.MarkFlagRequired("from")
+	_ = keyRotateCmd.MarkFlagRequired("to")
+
+	keyCmd.AddCommand(keyGenerateCmd, keyListCmd, keyShowCmd, keyDeleteCmd, keyInstallCmd, keyRotateCmd)
+	rootCmd.AddCommand(keyCmd)
+}
+
+var keyCmd = &cobra.Command{
+	Use:   "key",
+	Short: "Manage ssh keys in the workspace",
+}
+
+var keyGenerateCmd = &cobra.Command{
+	Use:   "generate [name]",
+	Short: "Generate a new key pair in the workspace",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		opts := keyring.GenerateOptions{
+			Name:    args[0],
+			Type:    keyType,
+			Bits:    keyBits,
+			Comment: keyComment,
+		}
+		if opts.Comment == "" {
+			opts.Comment = defaultKeyComment()
+		}
+		if keyPassphrase {
+			passphrase, err := readNewPassphrase()
+			if err != nil {
+				if isUserCancelError(err) {
+					log.Info().Msg("😎 Good bye")
+					return nil
+				}
+				return errors.Wrap(err, "read the passphrase")
+			}
+			opts.Passphrase = passphrase
+		}
+		k, err := keyRing.Generate(context.Background(), &opts)
+		if err != nil {
+			return errors.Wrapf(err, "generate the key(%s)", args[0])
+		}
+		if structuredOutput() {
+			return printOutput(k, keyOutputColumns)
+		}
+		log.Info().Msgf("✅ success to generate the key %s", k.String())
+		log.Info().Msgf("  🔹 private key: %s", keyRing.PrivateKeyPath(k.Name))
+		log.Info().Msgf("  🔹 public key: %s", keyRing.PublicKeyPath(k.Name))
+		return nil
+	},
+}
+
+var keyListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "Get keys in the workspace",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		keys, err := keyRing.FindAll(context.Background())
+		if err != nil {
+			return errors.Wrap(err, "find keys")
+		}
+		if structuredOutput() {
+			return printOutput(keys, keyOutputColumns)
+		}
+		log.Info().Msgf("⚡ Total keys: #%d", len(keys))
+		for _, k := range keys {
+			log.Info().Msgf("  🔹 %s", k.String())
+		}
+		return nil
+	},
+}
+
+var keyShowCmd = &cobra.Command{
+	Use:   "show [name]",
+	Short: "Show the key and its public key",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		k, err := findKey(args[0])
+		if err != nil {
+			return err
+		}
+		if structuredOutput() {
+			return printOutput(k, append(keyOutputColumns, "publicKey"))
+		}
+		log.Info().Msg(k.ToJSON(true))
+		hosts, err := keyHosts(k.Name)
+		if err != nil {
+			return err
+		}
+		log.Info().Msgf("⚡ Hosts using the key: %s", strings.Join(hosts, ", "))
+		return nil
+	},
+}
+
+var keyDeleteCmd = &cobra.Command{
+	Use:   "delete [name]",
+	Short: "Delete the key and its files",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		k, err := findKey(args[0])
+		if err != nil {
+			return err
+		}
+		hosts, err := keyHosts(k.Name)
+		if err != nil {
+			return err
+		}
+		if len(hosts) != 0 && !keyForce {
+			return fmt.Errorf("the key(%s) is used by hosts: %s. delete with --force to delete anyway", k.Name, strings.Join(hosts, ", "))
+		}
+		if workspaceConfig.ConfirmDelete {
+			ok, err := confirmPrompt(fmt.Sprintf("remove the key %s?", k.String()))
+			if err != nil {
+				if isUserCancelError(err) {
+					log.Info().Msg("😎 Good bye")
+					return nil
+				}
+				return errors.Wrap(err, "confirm to delete")
+			}
+			if !ok {
+				log.Info().Msgf("Cancel to delete the key(%s)", k.Name)
+				return nil
+			}
+		}
+		if err := keyRing.Delete(context.Background(), k.Name); err != nil {
+			return errors.Wrapf(err, "delete the key(%s)", k.Name)
+		}
+		log.Info().Msgf("Success to delete the key(%s)", k.Name)
+		return nil
+	},
+}
+
+var keyInstallCmd = &cobra.Command{
+	Use:   "install",
+	Short: "Install the public key of the managed key to authorized_keys of the remote host",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		info, err := getServerInfoOrActive(keyInstallHost)
+		if err != nil {
+			return errors.Wrapf(err, "find the host(%s)", keyInstallHost)
+		}
+		k, err := findKey(keyInstallName)
+		if err != nil {
+			return err
+		}
+		passphrase, err := readKeyPassphrase(k)
+		if err != nil {
+			if isUserCancelError(err) {
+				log.Info().Msg("😎 Good bye")
+				return nil
+			}
+			return errors.Wrap(err, "read the passphrase")
+		}
+
+		cli, err := hostLogin(info)
+		if err != nil {
+			return errors.Wrapf(err, "connect to the host(%s)", info.Name)
+		}
+		added, err := installKey(cli, k)
+		if err != nil {
+			return errors.Wrapf(err, "install the key(%s) to the host(%s)", k.Name, info.Name)
+		}
+		if added {
+			log.Info().Msgf("✅ installed the key(%s) to %s", k.Name, info.String())
+		} else {
+			log.Info().Msgf("✅ the key(%s) is already installed to %s", k.Name, info.String())
+		}
+		if err := verifyKeyLogin(info, k, passphrase); err != nil {
+			return errors.Wrapf(err, "verify the login with the key(%s)", k.Name)
+		}
+		log.Info().Msgf("✅ verified the login with the key(%s)", k.Name)
+
+		if !keyInstallSwitch {
+			return nil
+		}
+		// reloads the host to save it without values applied by the workspace configuration.
+		update, err := hostStore.FindByName(context.Background(), info.Name)
+		if err != nil {
+			return errors.Wrapf(err, "find the host(%s)", info.Name)
+		}
+		update.KeyName = k.Name
+		update.KeyPath = ""
+		update.Password = ""
+		if _, err := hostStore.Update(context.Background(), update); err != nil {
+			return errors.Wrapf(err, "update the host(%s)", info.Name)
+		}
+		log.Info().Msgf("✅ switched the host(%s) to the key(%s) and cleared the password", info.Name, k.Name)
+		return nil
+	},
+}
+
+var keyRotateCmd = &cobra.Command{
+	Use:   "rotate",
+	Short: "Rotate the managed key of hosts to a new key",
+	Long: `Rotate the managed key of hosts to a new key. For each host using the old key, the new key is installed,
+the login with the new key is verified, the old key is removed from authorized_keys and the host is switched to
+the new key. The state of each host is saved to the state file, so running the same command again resumes
+hosts failed in the middle from their last completed step.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if keyRotateFrom == keyRotateTo {
+			return errors.New("--from and --to must be different keys")
+		}
+		if keyRotateParallel < 1 {
+			return errors.New("--parallel must be positive")
+		}
+		from, err := findKey(keyRotateFrom)
+		if err != nil {
+			return err
+		}
+		to, err := findKey(keyRotateTo)
+		if err != nil {
+			return err
+		}
+		statePath := keyRotateState
+		if statePath == "" {
+			statePath = filepath.Join(workspace, rotationsDir, fmt.Sprintf("%s-%s.json", from.Name, to.Name))
+		}
+		rotation, err := keyring.LoadRotation(statePath, from.Name, to.Name)
+		if err != nil {
+			return errors.Wrap(err, "load the rotation state")
+		}
+
+		page, err := hostStore.Find(context.Background(), &host.Query{Tags: keyRotateTags})
+		if err != nil {
+			return errors.Wrap(err, "find hosts")
+		}
+		var hosts []*host.ServerInfo
+		for _, info := range page.Hosts {
+			if info.KeyName == from.Name {
+				hosts = append(hosts, info)
+			}
+		}
+		if len(hosts) == 0 {
+			log.Info().Msgf("⚡ No hosts use the key(%s)", from.Name)
+			return nil
+		}
+
+		passphrases := make(map[string]string)
+		for _, k := range []*keyring.Key{from, to} {
+			if passphrases[k.Name], err = readKeyPassphrase(k); err != nil {
+				if isUserCancelError(err) {
+					log.Info().Msg("😎 Good bye")
+					return nil
+				}
+				return errors.Wrap(err, "read the passphrase")
+			}
+		}
+
+		log.Info().Msgf("⚡ Rotate the key(%s) to the key(%s) of #%d hosts. state: %s", from.Name, to.Name, len(hosts), statePath)
+		var (
+			wg  sync.WaitGroup
+			sem = make(chan struct{}, keyRotateParallel)
+		)
+		for _, info := range hosts {
+			wg.Add(1)
+			sem <- struct{}{}
+			go func(info *host.ServerInfo) {
+				defer wg.Done()
+				defer func() { <-sem }()
+				if err := rotateHostKey(rotation, info, from, to, passphrases); err != nil {
+					log.Warn().Msgf("  🔸 %s: %v", info.Name, err)
+					return
+				}
+				log.Info().Msgf("  🔹 %s: done", info.Name)
+			}(info)
+		}
+		wg.Wait()
+
+		results := rotation.Results()
+		failed := 0
+		for _, h := range results {
+			if !h.Done() {
+				failed++
+			}
+		}
+		if structuredOutput() {
+			if err := printOutput(results, rotationOutputColumns); err != nil {
+				return err
+			}
+		} else {
+			log.Info().Msgf("⚡ Total hosts: #%d (#%d failed)", len(results), failed)
+			for _, h := range results {
+				if h.Done() {
+					log.Info().Msgf("  🔹 %s: %s", h.Name, h.Step)
+				} else {
+					log.Info().Msgf("  🔸 %s: %s (%s)", h.Name, h.Step, h.Error)
+				}
+			}
+		}
+		if failed != 0 {
+			return fmt.Errorf("failed to rotate the key of %d hosts. run the same command again to resume them", failed)
+		}
+		log.Info().Msgf("✅ success to rotate the key(%s) to the key(%s)", from.Name, to.Name)
+		return nil
+	},
+}
+
+// rotateHostKey rotates the key of the host from the key to the other key from the last completed step
+// in the rotation. Each step is recorded to the rotation.
+func rotateHostKey(rotation *keyring.Rotation, info *host.ServerInfo, from, to *keyring.Key, passphrases map[string]string) error {
+	state := rotation.Host(info.Name)
+	for _, step := range []struct {
+		name   string
+		action string
+		run    func() error
+	}{
+		{keyring.StepInstalled, "install the new key", func() error {
+			cli, err := keyLogin(info, from, passphrases[from.Name])
+			if err != nil {
+				return err
+			}
+			_, err = installKey(cli, to)
+			return err
+		}},
+		{keyring.StepVerified, "verify the login with the new key", func() error {
+			return verifyKeyLogin(info, to, passphrases[to.Name])
+		}},
+		{keyring.StepRemoved, "remove the old key", func() error {
+			cli, err := keyLogin(info, to, passphrases[to.Name])
+			if err != nil {
+				return err
+			}
+			defer cli.Close()
+			_, err = cli.RemoveAuthorizedKey(from.PublicKey)
+			return err
+		}},
+		{keyring.StepDone, "switch the host to the new key", func() error {
+			update, err := hostStore.FindByName(context.Background(), info.Name)
+			if err != nil {
+				return err
+			}
+			update.KeyName = to.Name
+			update.KeyPath = ""
+			// the password of a host using a managed key is the passphrase of the old key.
+			update.Password = ""
+			_, err = hostStore.Update(context.Background(), update)
+			return err
+		}},
+	} {
+		if state.Completed(step.name) {
+			continue
+		}
+		err := step.run()
+		if err != nil {
+			err = errors.Wrap(err, step.action)
+		}
+		if recordErr := rotation.Record(info.Name, step.name, err); recordErr != nil {
+			return errors.Wrap(recordErr, "save the rotation state")
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hostLogin connects to the host with the credentials of the host.
+func hostLogin(info *host.ServerInfo) (*ssh.Client, error) {
+	login := *info
+	hostConfig := applyHostConfig(&login)
+	agentSocket, err := resolveHostKey(&login)
+	if err != nil {
+		return nil, err
+	}
+	return ssh.NewClient(&ssh.ClientParams{
+		ServerInfo:     &login,
+		ConnectTimeout: time.Duration(hostConfig.ConnectTimeout),
+		AuthTimeout:    time.Duration(hostConfig.AuthTimeout),
+		KnownHosts:     knownHostsFiles(),
+		StrictHostKey:  workspaceConfig.KnownHosts.Strict,
+		AgentSocket:    agentSocket,
+	})
+}
+
+// keyLogin connects to the host with the given managed key instead of the credentials of the host.
+func keyLogin(info *host.ServerInfo, k *keyring.Key, passphrase string) (*ssh.Client, error) {
+	login := *info
+	hostConfig := applyHostConfig(&login)
+	login.KeyName = k.Name
+	login.KeyPath = keyRing.PrivateKeyPath(k.Name)
+	login.CertPath = ""
+	login.Password = passphrase
+	return ssh.NewClient(&ssh.ClientParams{
+		ServerInfo:     &login,
+		ConnectTimeout: time.Duration(hostConfig.ConnectTimeout),
+		AuthTimeout:    time.Duration(hostConfig.AuthTimeout),
+		KnownHosts:     knownHostsFiles(),
+		StrictHostKey:  workspaceConfig.KnownHosts.Strict,
+	})
+}
+
+// installKey adds the public key of the given key to the host logging in with the given client.
+// It returns false if the key is already installed.
+func installKey(cli *ssh.Client, k *keyring.Key) (bool, error) {
+	defer cli.Close()
+	return cli.AddAuthorizedKey(k.PublicKey)
+}
+
+// verifyKeyLogin logs in to the host with the given key and runs a command.
+func verifyKeyLogin(info *host.ServerInfo, k *keyring.Key, passphrase string) error {
+	cli, err := keyLogin(info, k, passphrase)
+	if err != nil {
+		return err
+	}
+	defer cli.Close()
+	_, err = cli.Output("true")
+	return err
+}
+
+// readKeyPassphrase reads the passphrase of the given key from the prompt if it is encrypted.
+func readKeyPassphrase(k *keyring.Key) (string, error) {
+	if !k.Encrypted {
+		return "", nil
+	}
+	prompt := promptui.Prompt{Label: promptLabel(fmt.Sprintf("passphrase of the key(%s)", k.Name)), Mask: '*'}
+	return prompt.Run()
+}
+
+func findKey(name string) (*keyring.Key, error) {
+	k, err := keyRing.Find(context.Background(), name)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("key(%s) not found", name)
+		}
+		return nil, errors.Wrapf(err, "find the key(%s)", name)
+	}
+	return k, nil
+}
+
+// keyHosts returns names of hosts which use the managed key of the given name.
+func keyHosts(name string) ([]string, error) {
+	hosts, err := hostStore.FindAll(context.Background())
+	if err != nil {
+		return nil, errors.Wrap(err, "find hosts")
+	}
+	var names []string
+	for _, info := range hosts {
+		if info.KeyName == name {
+			names = append(names, info.Name)
+		}
+	}
+	return names, nil
+}
+
+// validateKeyName validates the managed key name input of a host, which can be empty.
+func validateKeyName(input string) error {
+	if input == "" {
+		return nil
+	}
+	if _, err := keyRing.Find(context.Background(), input); err != nil {
+		return fmt.Errorf("key(%s) not found", input)
+	}
+	return nil
+}
+
+// resolveHostKey sets the key path of the given host to the private key of its managed key.
+// If the key is encrypted and the host does not have the passphrase, it returns the socket of the agent
+// which has the key, or reads the passphrase from the prompt if no agents have it.
+func resolveHostKey(info *host.ServerInfo) (string, error) {
+	if info.KeyName == "" {
+		return "", nil
+	}
+	k, err := findKey(info.KeyName)
+	if err != nil {
+		return "", err
+	}
+	info.KeyPath = keyRing.PrivateKeyPath(k.Name)
+	if info.Password == "" && k.Encrypted {
+		if socket := findAgentSocket(k); socket != "" {
+			return socket, nil
+		}
+		passphrase, err := readKeyPassphrase(k)
+		if err != nil {
+			return "", errors.Wrap(err, "read the passphrase")
+		}
+		info.Password = passphrase
+	}
+	return "", nil
+}
+
+func defaultKeyComment() string {
+	name := "zssh"
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+	if hostname, err := os.Hostname(); err == nil {
+		name += "@" + hostname
+	}
+	return name
+}
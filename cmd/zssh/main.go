@@ -8,15 +8,33 @@ import (
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
+	"github.com/zacscoding/zssh/pkg/config"
 	"github.com/zacscoding/zssh/pkg/database"
+	"github.com/zacscoding/zssh/pkg/history"
 	"github.com/zacscoding/zssh/pkg/host"
+	"github.com/zacscoding/zssh/pkg/keyring"
+	"github.com/zacscoding/zssh/pkg/profile"
+	"gorm.io/gorm"
 	"io"
 	"os"
 	"path/filepath"
 	"time"
 )
 
-var workspace string
+const (
+	envProfile = "ZSSH_PROFILE"
+)
+
+var (
+	workspace     string
+	profileName   string
+	activeProfile string
+	profiles      *profile.Registry
+
+	workspaceConfig *config.Config
+	workspaceDB     *gorm.DB
+	migrator        *database.Migrator
+)
 
 var (
 	commit  = "HEAD"
@@ -29,23 +47,53 @@ var (
 	stderr io.Writer = os.Stderr
 )
 
-var hostStore host.Store
+var (
+	hostStore    host.Store
+	historyStore history.Store
+	keyRing      *keyring.Keyring
+)
 
 var rootCmd = &cobra.Command{
 	Use:     "zssh",
 	Short:   "SSH Command line utilities :)",
 	Version: fmt.Sprintf("%s (%s)", version, commit),
-	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
 		stdin = cmd.InOrStdin()
 		stdout = cmd.OutOrStdout()
-		stderr = cmd.OutOrStderr()
-		log.Logger = log.Output(zerolog.ConsoleWriter{Out: stdout, TimeFormat: time.RFC3339})
+		stderr = cmd.ErrOrStderr()
+		if err := initialize(cmd); err != nil {
+			return err
+		}
+		if outputFormat == "" {
+			outputFormat = workspaceConfig.Output
+		}
+		if outputTemplate == "" {
+			outputTemplate = workspaceConfig.OutputTemplate
+		}
+		// keeps stdout for the document of the output format.
+		logOut := stdout
+		if structuredOutput() {
+			logOut = stderr
+		}
+		if workspaceConfig.Log.Format == config.LogFormatJSON {
+			log.Logger = zerolog.New(logOut).With().Timestamp().Logger()
+		} else {
+			log.Logger = log.Output(zerolog.ConsoleWriter{Out: logOut, TimeFormat: time.RFC3339})
+		}
+		if err := validateOutputFlags(); err != nil {
+			return err
+		}
+		// db commands handle migrations by themselves, and profile commands do not use the workspace.
+		if cmd.HasParent() && (cmd.Parent() == dbCmd || cmd.Parent() == profileCmd) {
+			return nil
+		}
+		return migrateDatabase()
 	},
 }
 
 func init() {
 	rootCmd.PersistentFlags().StringVar(&workspace, "workspace", "", "workspace path(default: $HOME/.zssh)")
-	cobra.OnInitialize(onInitialize)
+	rootCmd.PersistentFlags().StringVarP(&profileName, "profile", "p", "", "the profile name of the workspace(default: $"+envProfile+" or the current profile)")
 }
 
 func main() {
@@ -55,26 +103,92 @@ func main() {
 	os.Exit(0)
 }
 
-func onInitialize() {
+// initialize loads the profile, the configuration and the stores of the workspace. Profile commands
+// only load profiles with the default configuration, so that they can fix a missing current profile.
+func initialize(cmd *cobra.Command) error {
+	rootDir, err := getDefaultWorkspace()
+	if err != nil {
+		return err
+	}
+	profiles, err = profile.Load(rootDir)
+	if err != nil {
+		return errors.Wrap(err, "load profiles")
+	}
+	if cmd.HasParent() && cmd.Parent() == profileCmd {
+		if p, err := resolveProfile(); err == nil && workspace == "" {
+			activeProfile = p.Name
+		}
+		workspaceConfig = config.Default()
+		return nil
+	}
 	if workspace == "" {
-		p, err := getDefaultWorkspace()
+		p, err := resolveProfile()
 		if err != nil {
-			panic(err)
+			return errors.Wrap(err, "resolve the profile. see 'zssh profile list'")
 		}
-		workspace = p
+		activeProfile = p.Name
+		workspace = p.Workspace
 	}
 	if err := checkWorkspace(workspace); err != nil {
-		panic(err)
+		return errors.Wrap(err, "check the workspace")
+	}
+
+	workspaceConfig, err = config.Load(workspace)
+	if err != nil {
+		return errors.Wrap(err, "load the configuration")
+	}
+
+	dbpath := filepath.Join(workspace, "zssh.db")
+	db, err := database.NewSQLiteDBWithRetry(dbpath,
+		workspaceConfig.Database.OpenRetries, time.Duration(workspaceConfig.Database.RetryInterval))
+	if err != nil {
+		return errors.Wrap(err, "open the database")
+	}
+	workspaceDB = db
+	migrator = database.NewMigrator(db, dbpath)
+	store, err := newHostStore(db)
+	if err != nil {
+		return errors.Wrap(err, "create the host store")
 	}
+	hostStore, err = newSyncStore(store)
+	if err != nil {
+		return errors.Wrap(err, "create the host store")
+	}
+	historyStore = history.NewStore(db)
+	keyRing = keyring.NewKeyring(filepath.Join(workspace, keysDir), keyring.NewStore(db))
+	return nil
+}
+
+// newHostStore creates the host.Store of the backend in the workspace configuration.
+func newHostStore(db *gorm.DB) (host.Store, error) {
+	switch workspaceConfig.Store.Backend {
+	case config.StoreBackendJSON, config.StoreBackendTOML:
+		return host.NewFileStore(workspaceConfig.StorePath(workspace))
+	default:
+		return host.NewStore(db), nil
+	}
+}
 
-	db, err := database.NewSQLiteDB(filepath.Join(workspace, "zssh.db"))
+// migrateDatabase applies pending migrations to the workspace database.
+func migrateDatabase() error {
+	if err := migrator.Check(); err != nil {
+		return err
+	}
+	pending, err := migrator.Pending()
 	if err != nil {
-		panic(err)
+		return errors.Wrap(err, "check migrations")
 	}
-	if err := db.Migrator().AutoMigrate(new(host.ServerInfo), new(host.ActiveServerInfo)); err != nil {
-		panic(err)
+	if !pending {
+		return nil
 	}
-	hostStore = host.NewStore(db)
+	backupPath, err := migrator.Migrate(-1)
+	if err != nil {
+		return errors.Wrap(err, "migrate the database")
+	}
+	if backupPath != "" {
+		log.Info().Msgf("✅ database is upgraded to v%d (backup: %s)", migrator.LatestVersion(), backupPath)
+	}
+	return nil
 }
 
 func checkWorkspace(configPath string) error {
@@ -92,6 +206,22 @@ func checkWorkspace(configPath string) error {
 	return nil
 }
 
+// resolveProfile returns the profile given by the flag, the environment variable or the current profile in order.
+func resolveProfile() (*profile.Profile, error) {
+	name := profileName
+	if name == "" {
+		name = os.Getenv(envProfile)
+	}
+	if name == "" {
+		name = profiles.CurrentName()
+	}
+	p, err := profiles.Find(name)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %s", err, name)
+	}
+	return p, nil
+}
+
 func getDefaultWorkspace() (string, error) {
 	home, err := homedir.Dir()
 	if err != nil {
@@ -100,9 +230,17 @@ func getDefaultWorkspace() (string, error) {
 	return filepath.Join(home, ".zssh"), nil
 }
 
+// promptLabel prefixes the given label with the active profile if it is not the default profile.
+func promptLabel(label string) string {
+	if activeProfile == "" || activeProfile == profile.DefaultName {
+		return label
+	}
+	return fmt.Sprintf("[%s] %s", activeProfile, label)
+}
+
 func confirmPrompt(label string) (bool, error) {
 	prompt := promptui.Prompt{
-		Label: label + " [yN]",
+		Label: promptLabel(label + " [yN]"),
 		Validate: func(input string) error {
 			switch input {
 			case "y", "N":
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"github.com/zacscoding/zssh/pkg/mux"
+	"github.com/zacscoding/zssh/pkg/ssh"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+const (
+	// muxSocketName is the socket of the mux daemon in the workspace.
+	muxSocketName = "mux.sock"
+	// muxLogName is the log file of the mux daemon started in the background.
+	muxLogName = "mux.log"
+)
+
+var (
+	muxIdleTimeout time.Duration
+	muxForeground  bool
+)
+
+var muxHostOutputColumns = []string{"name", "address", "sessions", "connectedAt", "lastUsedAt", "reconnects"}
+
+func init() {
+	muxStartCmd.Flags().DurationVar(&muxIdleTimeout, "idle", 0, "close connections to hosts without sessions for the duration(default: mux.idleTimeout of the configuration)")
+	muxStartCmd.Flags().BoolVar(&muxForeground, "foreground", false, "run the daemon in the foreground")
+
+	muxCmd.AddCommand(muxStartCmd, muxStatusCmd, muxStopCmd)
+	rootCmd.AddCommand(muxCmd)
+}
+
+var muxCmd = &cobra.Command{
+	Use:   "mux",
+	Short: "Run the daemon which shares connections to hosts between zssh commands",
+}
+
+var muxStartCmd = &cobra.Command{
+	Use:   "start",
+	Short: "Start the mux daemon in the background",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if muxIdleTimeout <= 0 {
+			muxIdleTimeout = time.Duration(workspaceConfig.Mux.IdleTimeout)
+		}
+		if muxForeground {
+			return runMuxDaemon()
+		}
+		return startMuxDaemon()
+	},
+}
+
+var muxStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Get connections of the mux daemon",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		status, err := mux.ReadStatus(muxSocketPath())
+		if err != nil {
+			return errors.Wrapf(err, "get the status of the mux daemon(%s)", muxSocketPath())
+		}
+		if structuredOutput() {
+			return printOutput(status.Hosts, muxHostOutputColumns)
+		}
+		log.Info().Msgf("⚡ the mux daemon(pid: %d) is running since %s", status.PID, status.StartedAt.Format(time.RFC3339))
+		log.Info().Msgf("⚡ Total connections: #%d", len(status.Hosts))
+		for _, h := range status.Hosts {
+			log.Info().Msgf("  🔹 %s", h.String())
+		}
+		return nil
+	},
+}
+
+var muxStopCmd = &cobra.Command{
+	Use:   "stop",
+	Short: "Stop the mux daemon and close its connections",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := mux.Stop(muxSocketPath()); err != nil {
+			return errors.Wrapf(err, "stop the mux daemon(%s)", muxSocketPath())
+		}
+		log.Info().Msg("✅ the mux daemon is stopped")
+		return nil
+	},
+}
+
+// startMuxDaemon starts this command with --foreground in the background and waits until it is ready.
+func startMuxDaemon() error {
+	socket := muxSocketPath()
+	if status, err := mux.ReadStatus(socket); err == nil {
+		return fmt.Errorf("the mux daemon(pid: %d) is already running on %s", status.PID, socket)
+	}
+	executable, err := os.Executable()
+	if err != nil {
+		return errors.Wrap(err, "find the executable")
+	}
+	logPath := filepath.Join(workspace, muxLogName)
+	logFile, err := os.OpenFile(logPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return errors.Wrap(err, "open the log of the mux daemon")
+	}
+	defer logFile.Close()
+
+	daemon := exec.Command(executable, "mux", "start", "--foreground",
+		"--workspace", workspace, "--idle", muxIdleTimeout.String())
+	daemon.Stdout = logFile
+	daemon.Stderr = logFile
+	daemon.SysProcAttr = detachedProcAttr()
+	if err := daemon.Start(); err != nil {
+		return errors.Wrap(err, "start the mux daemon")
+	}
+	exited := make(chan error, 1)
+	go func() {
+		exited <- daemon.Wait()
+	}()
+
+	deadline := time.After(10 * time.Second)
+	for {
+		select {
+		case err := <-exited:
+			return fmt.Errorf("the mux daemon exited: %v. see %s", err, logPath)
+		case <-deadline:
+			return fmt.Errorf("the mux daemon is not ready. see %s", logPath)
+		case <-time.After(100 * time.Millisecond):
+		}
+		if status, err := mux.ReadStatus(socket); err == nil {
+			log.Info().Msgf("✅ the mux daemon(pid: %d) is listening on %s", status.PID, socket)
+			log.Info().Msgf("  🔹 idle timeout: %s", muxIdleTimeout)
+			log.Info().Msgf("  🔹 log: %s", logPath)
+			return nil
+		}
+	}
+}
+
+// runMuxDaemon serves the mux daemon until it is stopped or interrupted.
+func runMuxDaemon() error {
+	socket := muxSocketPath()
+	l, err := mux.Listen(socket)
+	if err != nil {
+		return errors.Wrap(err, "listen the mux socket")
+	}
+	defer os.Remove(socket)
+
+	server, err := mux.NewServer(mux.Options{Dial: muxDial, IdleTimeout: muxIdleTimeout})
+	if err != nil {
+		l.Close()
+		return errors.Wrap(err, "create the mux daemon")
+	}
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		select {
+		case <-sigs:
+			server.Close()
+		case <-server.Done():
+		}
+	}()
+	log.Info().Msgf("✅ the mux daemon(pid: %d) is listening on %s", os.Getpid(), socket)
+	if err := server.Serve(l); err != nil {
+		return errors.Wrap(err, "serve the mux daemon")
+	}
+	log.Info().Msg("😎 Good bye")
+	return nil
+}
+
+// muxDial connects to the host for the mux daemon. Encrypted keys must be in an agent because
+// the daemon can not read passphrases. The connection sends keepalives of the configuration, so that
+// the daemon reconnects to the host if it is lost.
+func muxDial(name string) (*ssh.Client, error) {
+	info, err := getServerInfoOrActive(name)
+	if err != nil {
+		log.Warn().Err(err).Msgf("failed to find the host(%s)", name)
+		return nil, err
+	}
+	hostConfig := applyHostConfig(info)
+	if info.KeyName != "" && info.Password == "" {
+		k, err := findKey(info.KeyName)
+		if err != nil {
+			return nil, err
+		}
+		if k.Encrypted && findAgentSocket(k) == "" {
+			err := fmt.Errorf("the key(%s) is encrypted and not in an agent", k.Name)
+			log.Warn().Err(err).Msgf("skip to connect to the host(%s)", name)
+			return nil, err
+		}
+	}
+	agentSocket, err := resolveHostKey(info)
+	if err != nil {
+		return nil, err
+	}
+	cli, err := ssh.NewClient(&ssh.ClientParams{
+		ServerInfo:         info,
+		ConnectTimeout:     time.Duration(hostConfig.ConnectTimeout),
+		AuthTimeout:        time.Duration(hostConfig.AuthTimeout),
+		KnownHosts:         knownHostsFiles(),
+		StrictHostKey:      workspaceConfig.KnownHosts.Strict,
+		AgentSocket:        agentSocket,
+		KeepAliveInterval:  time.Duration(hostConfig.KeepAliveInterval),
+		KeepAliveMaxMissed: workspaceConfig.KeepAlive.MaxMissed,
+	})
+	if err != nil {
+		log.Warn().Err(err).Msgf("failed to connect to the host(%s)", name)
+		return nil, err
+	}
+	log.Info().Msgf("⚡ connected to %s", cli.ServerInfo.String())
+	return cli, nil
+}
+
+func muxSocketPath() string {
+	return filepath.Join(workspace, muxSocketName)
+}
+
+// clientMuxSocket returns the socket of the mux daemon which clients use, or empty if it is disabled.
+func clientMuxSocket() string {
+	if !workspaceConfig.Mux.Enabled {
+		return ""
+	}
+	return muxSocketPath()
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/zacscoding/zssh/pkg/config"
+	"gopkg.in/yaml.v3"
+	"reflect"
+	"strings"
+	"text/tabwriter"
+	"text/template"
+)
+
+const (
+	outputFormatTable    = config.OutputFormatTable
+	outputFormatJSON     = config.OutputFormatJSON
+	outputFormatYAML     = config.OutputFormatYAML
+	outputFormatCSV      = config.OutputFormatCSV
+	outputFormatTemplate = config.OutputFormatTemplate
+)
+
+var (
+	outputFormat   string
+	outputTemplate string
+)
+
+// columns of each type displayed in the table and csv output formats.
+var (
+	hostOutputColumns       = []string{"id", "name", "user", "address", "port", "aliases", "addresses", "tags", "keypath", "keyName", "certPath", "description", "lastConnectedAt"}
+	connectionOutputColumns = []string{"id", "host", "address", "type", "command", "exitStatus", "error", "bytesSent", "bytesReceived", "startedAt", "endedAt"}
+	statsOutputColumns      = []string{"host", "connections", "failures", "lastConnectedAt"}
+	trashOutputColumns      = []string{"id", "name", "user", "address", "port", "aliases", "tags", "deletedAt"}
+	revisionOutputColumns   = []string{"rev", "action", "actor", "changes", "createdAt"}
+)
+
+func init() {
+	rootCmd.PersistentFlags().StringVarP(&outputFormat, "output", "o", "", "output format(table|json|yaml|csv|template)")
+	rootCmd.PersistentFlags().StringVar(&outputTemplate, "template", "", "go text/template applied to each item with '--output template' (e.g. '{{.name}}')(default: outputTemplate of the configuration)")
+}
+
+// structuredOutput returns a true if an output format is given, otherwise false.
+// Commands print human readable logs if false.
+func structuredOutput() bool {
+	return outputFormat != ""
+}
+
+func validateOutputFlags() error {
+	switch outputFormat {
+	case "", outputFormatTable, outputFormatJSON, outputFormatYAML, outputFormatCSV:
+		return nil
+	case outputFormatTemplate:
+		if outputTemplate == "" {
+			return errors.New("--template is required with '--output template'")
+		}
+		return nil
+	}
+	return fmt.Errorf("invalid output format: %s", outputFormat)
+}
+
+// printOutput writes the given value which is a single item or a slice of items to stdout in the output format.
+// Items are encoded with their json field names, so columns are the json field names to display
+// in the table and csv output formats.
+func printOutput(v interface{}, columns []string) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return errors.Wrap(err, "marshal the output")
+	}
+	if rv := reflect.ValueOf(v); rv.Kind() == reflect.Slice && rv.IsNil() {
+		b = []byte("[]")
+	}
+
+	switch outputFormat {
+	case outputFormatJSON:
+		var buf bytes.Buffer
+		if err := json.Indent(&buf, b, "", "  "); err != nil {
+			return err
+		}
+		buf.WriteByte('\n')
+		_, err = stdout.Write(buf.Bytes())
+		return err
+	case outputFormatYAML:
+		// decodes json to yaml.Node to keep the order of fields.
+		var node yaml.Node
+		if err := yaml.Unmarshal(b, &node); err != nil {
+			return errors.Wrap(err, "convert the output to yaml")
+		}
+		resetYAMLStyle(&node)
+		out, err := yaml.Marshal(&node)
+		if err != nil {
+			return errors.Wrap(err, "marshal the output to yaml")
+		}
+		_, err = stdout.Write(out)
+		return err
+	}
+
+	items, err := outputItems(v, b)
+	if err != nil {
+		return err
+	}
+	switch outputFormat {
+	case outputFormatTable:
+		w := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+		headers := make([]string, len(columns))
+		for i, column := range columns {
+			headers[i] = strings.ToUpper(column)
+		}
+		fmt.Fprintln(w, strings.Join(headers, "\t"))
+		for _, item := range items {
+			fmt.Fprintln(w, strings.Join(outputRow(item, columns), "\t"))
+		}
+		return w.Flush()
+	case outputFormatCSV:
+		w := csv.NewWriter(stdout)
+		if err := w.Write(columns); err != nil {
+			return err
+		}
+		for _, item := range items {
+			if err := w.Write(outputRow(item, columns)); err != nil {
+				return err
+			}
+		}
+		w.Flush()
+		return w.Error()
+	case outputFormatTemplate:
+		tpl, err := template.New("output").Funcs(template.FuncMap{
+			"join": func(v interface{}, sep string) string {
+				return strings.Join(strings.Split(formatOutputValue(v), ","), sep)
+			},
+			"json": func(v interface{}) (string, error) {
+				b, err := json.Marshal(v)
+				return string(b), err
+			},
+		}).Parse(outputTemplate)
+		if err != nil {
+			return errors.Wrap(err, "parse the template")
+		}
+		for _, item := range items {
+			if err := tpl.Execute(stdout, item); err != nil {
+				return errors.Wrap(err, "execute the template")
+			}
+			fmt.Fprintln(stdout)
+		}
+		return nil
+	}
+	return fmt.Errorf("invalid output format: %s", outputFormat)
+}
+
+// outputItems decodes the given json of v to the generic maps.
+func outputItems(v interface{}, b []byte) ([]map[string]interface{}, error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice {
+		b = append(append([]byte{'['}, b...), ']')
+	}
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	var items []map[string]interface{}
+	if err := d.Decode(&items); err != nil {
+		return nil, errors.Wrap(err, "decode the output")
+	}
+	return items, nil
+}
+
+func outputRow(item map[string]interface{}, columns []string) []string {
+	row := make([]string, len(columns))
+	for i, column := range columns {
+		row[i] = formatOutputValue(item[column])
+	}
+	return row
+}
+
+func formatOutputValue(v interface{}) string {
+	switch value := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	case json.Number:
+		return value.String()
+	case []interface{}:
+		values := make([]string, len(value))
+		for i, elt := range value {
+			values[i] = formatOutputValue(elt)
+		}
+		return strings.Join(values, ",")
+	case map[string]interface{}:
+		b, _ := json.Marshal(value)
+		return string(b)
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+func resetYAMLStyle(node *yaml.Node) {
+	node.Style = 0
+	for _, n := range node.Content {
+		resetYAMLStyle(n)
+	}
+}
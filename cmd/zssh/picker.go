@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"github.com/manifoldco/promptui"
+	"github.com/pkg/errors"
+	"github.com/zacscoding/zssh/pkg/history"
+	"github.com/zacscoding/zssh/pkg/host"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const (
+	hostPickerSize = 10
+)
+
+var hostPickerTemplates = &promptui.SelectTemplates{
+	Label:    "{{ . }}",
+	Active:   "▸ {{ .Name | cyan }} {{ .User | faint }}{{ \"@\" | faint }}{{ .Address | faint }}",
+	Inactive: "  {{ .Name }} {{ .User | faint }}{{ \"@\" | faint }}{{ .Address | faint }}",
+	Selected: "✅ {{ .Name | cyan }}",
+	Details: `
+--------- Host ----------
+{{ "Name:" | faint }}	{{ .Name }}
+{{ "Aliases:" | faint }}	{{ join .AliasNames ", " }}
+{{ "User:" | faint }}	{{ .User }}
+{{ "Address:" | faint }}	{{ .Address }}:{{ .Port }}
+{{ "Alternates:" | faint }}	{{ join (alternates .ServerInfo) ", " }}
+{{ "Tags:" | faint }}	{{ join .TagNames ", " }}
+{{ "KeyPath:" | faint }}	{{ .KeyPath }}
+{{ "Key:" | faint }}	{{ .KeyName }}
+{{ "Description:" | faint }}	{{ .Description }}
+{{ "Connections:" | faint }}	{{ .Connections }}
+{{ "Last connected:" | faint }}	{{ if .LastUsedAt }}{{ .LastUsedAt.Format "2006-01-02 15:04:05" }} ({{ .LastAddress }}){{ else }}never{{ end }}`,
+	FuncMap: hostPickerFuncMap(),
+}
+
+// hostPickerItem is a host displayed in the host picker with its usage.
+type hostPickerItem struct {
+	*host.ServerInfo
+	Connections int64
+	LastUsedAt  *time.Time
+}
+
+// selectHostPrompt displays a fuzzy-searching picker of all hosts ordered by recent usage
+// and returns the selected host.
+func selectHostPrompt() (*host.ServerInfo, error) {
+	ctx := context.Background()
+	hosts, err := hostStore.FindAll(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "find hosts")
+	}
+	if len(hosts) == 0 {
+		return nil, errors.New("empty hosts")
+	}
+	stats, err := historyStore.Stats(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "find usage statistics")
+	}
+	items := newHostPickerItems(hosts, stats)
+
+	p := promptui.Select{
+		Label:     promptLabel("Select host (type / to search)"),
+		Items:     items,
+		Size:      hostPickerSize,
+		Templates: hostPickerTemplates,
+		Searcher: func(input string, index int) bool {
+			return fuzzyMatch(input, hostSearchText(items[index].ServerInfo))
+		},
+	}
+
+	idx, _, err := p.Run()
+	if err != nil {
+		return nil, err
+	}
+	return items[idx].ServerInfo, nil
+}
+
+// newHostPickerItems creates hostPickerItem from the given hosts and usage statistics
+// and sorts them by recent usage.
+func newHostPickerItems(hosts []*host.ServerInfo, stats []*history.Stats) []*hostPickerItem {
+	statsByID := make(map[uint]*history.Stats, len(stats))
+	for _, st := range stats {
+		statsByID[st.ServerInfoID] = st
+	}
+
+	items := make([]*hostPickerItem, len(hosts))
+	for i, info := range hosts {
+		item := hostPickerItem{ServerInfo: info, LastUsedAt: info.LastConnectedAt}
+		if st, ok := statsByID[info.ID]; ok {
+			item.Connections = st.Connections
+			lastConnectedAt := st.LastConnectedAt
+			item.LastUsedAt = &lastConnectedAt
+		}
+		items[i] = &item
+	}
+	sortByRecentUsage(items)
+	return items
+}
+
+func hostPickerFuncMap() map[string]interface{} {
+	funcs := make(map[string]interface{}, len(promptui.FuncMap)+2)
+	for k, v := range promptui.FuncMap {
+		funcs[k] = v
+	}
+	funcs["join"] = strings.Join
+	funcs["alternates"] = func(info *host.ServerInfo) []string {
+		return info.Endpoints()[1:]
+	}
+	return funcs
+}
+
+// sortByRecentUsage sorts the given items by the last used time in descending order.
+// Items never used follow them in name order.
+func sortByRecentUsage(items []*hostPickerItem) {
+	sort.SliceStable(items, func(i, j int) bool {
+		ti, tj := items[i].LastUsedAt, items[j].LastUsedAt
+		switch {
+		case ti != nil && tj != nil:
+			if !ti.Equal(*tj) {
+				return ti.After(*tj)
+			}
+		case ti != nil:
+			return true
+		case tj != nil:
+			return false
+		}
+		if items[i].Connections != items[j].Connections {
+			return items[i].Connections > items[j].Connections
+		}
+		return items[i].Name < items[j].Name
+	})
+}
+
+// hostSearchText returns a text of the given host to be matched by the picker.
+func hostSearchText(info *host.ServerInfo) string {
+	fields := []string{info.Name, info.User, info.Address, info.Description}
+	fields = append(fields, info.AliasNames()...)
+	fields = append(fields, info.Endpoints()[1:]...)
+	fields = append(fields, info.TagNames()...)
+	return strings.Join(fields, " ")
+}
+
+// fuzzyMatch returns true if all characters of the given pattern appear in the text in order, ignoring case
+// and spaces of the pattern.
+func fuzzyMatch(pattern, text string) bool {
+	text = strings.ToLower(text)
+	for _, r := range strings.ToLower(pattern) {
+		if unicode.IsSpace(r) {
+			continue
+		}
+		idx := strings.IndexRune(text, r)
+		if idx < 0 {
+			return false
+		}
+		text = text[idx+len(string(r)):]
+	}
+	return true
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"github.com/zacscoding/zssh/pkg/profile"
+)
+
+var (
+	profileWorkspace string
+)
+
+var profileOutputColumns = []string{"name", "workspace", "current"}
+
+func init() {
+	profileCreateCmd.Flags().StringVar(&profileWorkspace, "path", "", "workspace path of the profile(default: $HOME/.zssh/profiles/{name})")
+
+	profileCmd.AddCommand(profileListCmd, profileUseCmd, profileCreateCmd)
+	rootCmd.AddCommand(profileCmd)
+}
+
+var profileCmd = &cobra.Command{
+	Use:   "profile",
+	Short: "Handle named workspaces",
+}
+
+var profileListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List profiles",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		type profileOutput struct {
+			*profile.Profile
+			Current bool `json:"current"`
+		}
+		var outputs []*profileOutput
+		for _, p := range profiles.List() {
+			outputs = append(outputs, &profileOutput{Profile: p, Current: p.Name == activeProfile})
+		}
+		if structuredOutput() {
+			return printOutput(outputs, profileOutputColumns)
+		}
+		log.Info().Msgf("⚡ Total profiles: #%d", len(outputs))
+		for _, o := range outputs {
+			if o.Current {
+				log.Info().Msgf("  ✅ %s (%s)", o.Name, o.Workspace)
+			} else {
+				log.Info().Msgf("  🔹 %s (%s)", o.Name, o.Workspace)
+			}
+		}
+		return nil
+	},
+}
+
+var profileUseCmd = &cobra.Command{
+	Use:   "use [name]",
+	Short: "Set the current profile",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := profiles.Use(args[0]); err != nil {
+			return errors.Wrapf(err, "use the profile(%s)", args[0])
+		}
+		if err := profiles.Save(); err != nil {
+			return errors.Wrap(err, "save profiles")
+		}
+		log.Info().Msgf("✅ Current profile: %s", args[0])
+		return nil
+	},
+}
+
+var profileCreateCmd = &cobra.Command{
+	Use:   "create [name]",
+	Short: "Create a new profile",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		p, err := profiles.Create(args[0], profileWorkspace)
+		if err != nil {
+			return errors.Wrapf(err, "create the profile(%s)", args[0])
+		}
+		if err := checkWorkspace(p.Workspace); err != nil {
+			return errors.Wrap(err, "check the workspace")
+		}
+		if err := profiles.Save(); err != nil {
+			return errors.Wrap(err, "save profiles")
+		}
+		log.Info().Msgf("✅ success to create a profile %s (%s)", p.Name, p.Workspace)
+		log.Info().Msgf("Switch to the profile with 'zssh profile use %s'", p.Name)
+		return nil
+	},
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"github.com/zacscoding/zssh/pkg/config"
+	"github.com/zacscoding/zssh/pkg/host"
+	"github.com/zacscoding/zssh/pkg/recording"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+var (
+	recordingsHostName  string
+	recordingsSpeed     float64
+	recordingsIdleLimit time.Duration
+)
+
+var recordingOutputColumns = []string{"name", "host", "title", "startedAt", "duration", "width", "height", "size"}
+
+func init() {
+	recordingsListCmd.Flags().StringVarP(&recordingsHostName, "name", "n", "", "the host name of recordings")
+	recordingsPlayCmd.Flags().Float64VarP(&recordingsSpeed, "speed", "s", 1, "the playback speed multiplier(e.g. 2 is twice as fast)")
+	recordingsPlayCmd.Flags().DurationVar(&recordingsIdleLimit, "idle-limit", 0, "the maximum wait between outputs(e.g. 2s, default: no limit)")
+
+	recordingsCmd.AddCommand(recordingsListCmd, recordingsPlayCmd)
+	rootCmd.AddCommand(recordingsCmd)
+}
+
+var recordingsCmd = &cobra.Command{
+	Use:   "recordings",
+	Short: "Manage recordings of shell sessions",
+}
+
+var recordingsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "Get recordings of shell sessions",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		infos, err := recording.List(recordingsDir(), recordingsHostName)
+		if err != nil {
+			return errors.Wrap(err, "find recordings")
+		}
+		if structuredOutput() {
+			return printOutput(infos, recordingOutputColumns)
+		}
+		log.Info().Msgf("⚡ Total recordings: #%d", len(infos))
+		for _, info := range infos {
+			log.Info().Msgf("  🔹 %s", info.String())
+		}
+		return nil
+	},
+}
+
+var recordingsPlayCmd = &cobra.Command{
+	Use:   "play [name or file]",
+	Short: "Replay the recording in the terminal",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path := recording.Resolve(recordingsDir(), args[0])
+		cast, err := recording.Read(path)
+		if err != nil {
+			return errors.Wrap(err, "read the recording")
+		}
+		if recordingsSpeed <= 0 {
+			return errors.Errorf("invalid speed: %v", recordingsSpeed)
+		}
+		log.Info().Msgf("⚡ play %s(%dx%d) for %s", path, cast.Header.Width, cast.Header.Height,
+			time.Duration(float64(cast.Duration())/recordingsSpeed).Round(time.Second))
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		err = recording.Play(ctx, stdout, cast, &recording.PlayOptions{Speed: recordingsSpeed, IdleLimit: recordingsIdleLimit})
+		if err != nil && err != context.Canceled {
+			return errors.Wrap(err, "play the recording")
+		}
+		log.Info().Msg("😎 Good bye")
+		return nil
+	},
+}
+
+// newSessionRecorder returns the recorder of the shell session of the host if the --record flag is given
+// or the configuration records the host. It returns nil if the session is not recorded.
+func newSessionRecorder(info *host.ServerInfo, hostConfig *config.HostConfig) (*recording.Recorder, error) {
+	if !sshRecord && !hostConfig.Record {
+		return nil, nil
+	}
+	path := recording.FileName(recordingsDir(), info.Name, time.Now())
+	recorder, err := recording.NewRecorder(path, info.String(), map[string]string{"TERM": hostConfig.TerminalType})
+	if err != nil {
+		return nil, err
+	}
+	log.Info().Msgf("⚡ recording the session to %s", path)
+	return recorder, nil
+}
+
+// closeSessionRecorder closes the recorder if not nil, and removes the file if the shell was not opened.
+func closeSessionRecorder(recorder *recording.Recorder, opened bool) {
+	if recorder == nil {
+		return
+	}
+	err := recorder.Close()
+	if !opened {
+		os.Remove(recorder.Path)
+		return
+	}
+	if err != nil {
+		log.Warn().Err(err).Msgf("failed to record the session to %s", recorder.Path)
+		return
+	}
+	log.Info().Msgf("✅ recorded the session to %s", recorder.Path)
+}
+
+func recordingsDir() string {
+	dir := expandPath(workspaceConfig.Recording.Dir)
+	if dir == "" {
+		dir = "recordings"
+	}
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(workspace, dir)
+	}
+	return dir
+}
@@ -6,10 +6,14 @@ import (
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
+	"github.com/zacscoding/zssh/pkg/config"
+	"github.com/zacscoding/zssh/pkg/history"
 	"github.com/zacscoding/zssh/pkg/host"
 	"github.com/zacscoding/zssh/pkg/ssh"
 	"gorm.io/gorm"
 	"os"
+	"path/filepath"
+	"time"
 )
 
 var (
@@ -17,12 +21,27 @@ var (
 )
 
 var (
-	sshHostName string
+	sshHostName     string
+	sshSelectHost   bool
+	sshForwardAgent bool
+	sshRecord       bool
+
+	sshConnectTimeout time.Duration
+	sshAuthTimeout    time.Duration
+	sshExecTimeout    time.Duration
 )
 
 func init() {
-	sshShellCmd.PersistentFlags().StringVarP(&hostName, "name", "n", "", "the host name of identifier")
-	sshExecCmd.PersistentFlags().StringVarP(&hostName, "name", "n", "", "the host name of identifier")
+	sshShellCmd.PersistentFlags().StringVarP(&sshHostName, "name", "n", "", "the host name of identifier")
+	sshShellCmd.PersistentFlags().BoolVarP(&sshSelectHost, "select", "s", false, "select the host to connect with the picker")
+	sshShellCmd.PersistentFlags().BoolVar(&sshRecord, "record", false, "record the session in asciicast v2 format to the recordings of the workspace")
+	sshExecCmd.PersistentFlags().StringVarP(&sshHostName, "name", "n", "", "the host name of identifier")
+	sshShellCmd.PersistentFlags().BoolVarP(&sshForwardAgent, "forward-agent", "A", false, "forward the local ssh agent(SSH_AUTH_SOCK) to the host")
+	sshExecCmd.PersistentFlags().BoolVarP(&sshForwardAgent, "forward-agent", "A", false, "forward the local ssh agent(SSH_AUTH_SOCK) to the host")
+
+	sshCmd.PersistentFlags().DurationVar(&sshConnectTimeout, "connect-timeout", 0, "the timeout to connect to each address of the host(default: connectTimeout of the configuration)")
+	sshCmd.PersistentFlags().DurationVar(&sshAuthTimeout, "auth-timeout", 0, "the timeout of the ssh handshake and the authentication(default: authTimeout of the configuration)")
+	sshExecCmd.Flags().DurationVar(&sshExecTimeout, "timeout", 0, "send SIGTERM to the command and close the session if it does not exit in the timeout(default: no timeout)")
 
 	sshCmd.AddCommand(sshShellCmd, sshExecCmd)
 	rootCmd.AddCommand(sshCmd)
@@ -37,21 +56,73 @@ var sshShellCmd = &cobra.Command{
 	Use:   "shell",
 	Short: "Open the remote shell",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		info, err := getServerInfoOrActive(sshHostName)
-		if err != nil {
-			return errors.Wrapf(err, "find the host(%s)", sshHostName)
+		var (
+			info *host.ServerInfo
+			err  error
+		)
+		if sshSelectHost {
+			info, err = selectHostPrompt()
+			if err != nil {
+				if isUserCancelError(err) {
+					log.Info().Msg("😎 Good bye")
+					return nil
+				}
+				return errors.Wrap(err, "select the host")
+			}
+		} else {
+			info, err = getServerInfoOrActive(sshHostName)
+			if err != nil {
+				return errors.Wrapf(err, "find the host(%s)", sshHostName)
+			}
 		}
 
-		cli, err := ssh.NewClient(&ssh.ClientParams{
-			ServerInfo: info,
-			StdIn:      os.Stdin,
-			Stdout:     os.Stdout,
-			Stderr:     os.Stderr,
-		})
+		hostConfig := applyHostConfig(info)
+		agentSocket, err := resolveHostKey(info)
+		if err != nil {
+			return errors.Wrapf(err, "resolve the key of the host(%s)", info.Name)
+		}
+		forwardAgent, err := agentForwarding(info, hostConfig)
 		if err != nil {
+			return err
+		}
+		recorder, err := newSessionRecorder(info, hostConfig)
+		if err != nil {
+			return errors.Wrap(err, "create the recording")
+		}
+		params := ssh.ClientParams{
+			ServerInfo:         info,
+			TerminalType:       hostConfig.TerminalType,
+			TerminalSpeed:      workspaceConfig.Terminal.Speed,
+			ConnectTimeout:     time.Duration(hostConfig.ConnectTimeout),
+			AuthTimeout:        time.Duration(hostConfig.AuthTimeout),
+			KnownHosts:         knownHostsFiles(),
+			StrictHostKey:      workspaceConfig.KnownHosts.Strict,
+			ForwardAgent:       forwardAgent,
+			AgentSocket:        agentSocket,
+			MuxSocket:          clientMuxSocket(),
+			KeepAliveInterval:  time.Duration(hostConfig.KeepAliveInterval),
+			KeepAliveMaxMissed: workspaceConfig.KeepAlive.MaxMissed,
+		}
+		if recorder != nil {
+			params.Recorder = recorder
+		}
+		conn, counter := startConnection(info, history.TypeShell, "")
+		params.StdIn = counter.reader(os.Stdin)
+		params.Stdout = counter.writer(os.Stdout)
+		params.Stderr = counter.writer(os.Stderr)
+		cli, err := ssh.NewClient(&params)
+		if err != nil {
+			finishConnection(conn, counter, err)
+			closeSessionRecorder(recorder, false)
 			return errors.Wrap(err, "create the ssh client")
 		}
-		if err := cli.OpenShell(); err != nil {
+		conn.Address = cli.Address
+		recordConnectedAddress(cli)
+		err = cli.OpenShell()
+		finishConnection(conn, counter, err)
+		closeSessionRecorder(recorder, true)
+		// the exit status of the shell is recorded in the history, and is not an error of zssh.
+		if err != nil && ssh.ExitStatus(err) == -1 {
 			return errors.Wrap(err, "open the shell")
 		}
 		log.Info().Msg("😎 Good bye")
@@ -69,18 +140,55 @@ var sshExecCmd = &cobra.Command{
 			return errors.Wrapf(err, "find the host(%s)", sshHostName)
 		}
 
+		hostConfig := applyHostConfig(info)
+		agentSocket, err := resolveHostKey(info)
+		if err != nil {
+			return errors.Wrapf(err, "resolve the key of the host(%s)", info.Name)
+		}
+		forwardAgent, err := agentForwarding(info, hostConfig)
+		if err != nil {
+			return err
+		}
+		conn, counter := startConnection(info, history.TypeExec, args[0])
+		execAudit := startExecAudit(info, args[0])
+		execStdout, execStderr := execAudit.writers(counter.writer(stdout), counter.writer(stderr))
 		cli, err := ssh.NewClient(&ssh.ClientParams{
-			ServerInfo: info,
-			StdIn:      stdin,
-			Stdout:     stdout,
-			Stderr:     stderr,
+			ServerInfo:         info,
+			StdIn:              counter.reader(stdin),
+			Stdout:             execStdout,
+			Stderr:             execStderr,
+			ConnectTimeout:     time.Duration(hostConfig.ConnectTimeout),
+			AuthTimeout:        time.Duration(hostConfig.AuthTimeout),
+			KnownHosts:         knownHostsFiles(),
+			StrictHostKey:      workspaceConfig.KnownHosts.Strict,
+			ForwardAgent:       forwardAgent,
+			AgentSocket:        agentSocket,
+			MuxSocket:          clientMuxSocket(),
+			KeepAliveInterval:  time.Duration(hostConfig.KeepAliveInterval),
+			KeepAliveMaxMissed: workspaceConfig.KeepAlive.MaxMissed,
 		})
 		if err != nil {
+			finishConnection(conn, counter, err)
+			execAudit.finish("", err)
 			return errors.Wrap(err, "create the ssh client")
 		}
+		conn.Address = cli.Address
+		recordConnectedAddress(cli)
 
+		ctx := context.Background()
+		if sshExecTimeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, sshExecTimeout)
+			defer cancel()
+		}
 		log.Info().Msgf("⚡ %s: %s", cli.ServerInfo.String(), args[0])
-		if err := cli.Run(args[0]); err != nil {
+		err = cli.RunContext(ctx, args[0])
+		if err == context.DeadlineExceeded {
+			err = fmt.Errorf("the command timed out after %s", sshExecTimeout)
+		}
+		finishConnection(conn, counter, err)
+		execAudit.finish(cli.Address, err)
+		if err != nil {
 			return errors.Wrap(err, "execute the command")
 		}
 		return nil
@@ -108,3 +216,68 @@ func getServerInfoOrActive(hostname string) (*host.ServerInfo, error) {
 	}
 	return info, nil
 }
+
+// applyHostConfig fills empty user, port and key path of the given host with the workspace configuration
+// and returns the configuration of the host with the timeouts of the flags.
+func applyHostConfig(info *host.ServerInfo) *config.HostConfig {
+	hostConfig := workspaceConfig.Host(info.Name)
+	if info.User == "" {
+		info.User = hostConfig.User
+	}
+	if info.Port == 0 {
+		info.Port = hostConfig.Port
+	}
+	if info.KeyPath == "" && info.KeyName == "" && info.Password == "" {
+		info.KeyPath = expandPath(hostConfig.KeyPath)
+	}
+	info.CertPath = expandPath(info.CertPath)
+	if sshConnectTimeout > 0 {
+		hostConfig.ConnectTimeout = config.Duration(sshConnectTimeout)
+	}
+	if sshAuthTimeout > 0 {
+		hostConfig.AuthTimeout = config.Duration(sshAuthTimeout)
+	}
+	return hostConfig
+}
+
+// agentForwarding returns true if the local agent is forwarded to the given host by the -A flag
+// or the configuration. It returns an error if the flag is given for the host with an untrusted tag.
+func agentForwarding(info *host.ServerInfo, hostConfig *config.HostConfig) (bool, error) {
+	if !sshForwardAgent && !hostConfig.ForwardAgent {
+		return false, nil
+	}
+	for _, tag := range workspaceConfig.Agent.UntrustedTags {
+		if !info.HasTags(tag) {
+			continue
+		}
+		if sshForwardAgent {
+			return false, fmt.Errorf("agent forwarding is forbidden for the host(%s) tagged %s", info.Name, tag)
+		}
+		log.Warn().Msgf("skip the agent forwarding of the configuration. the host(%s) is tagged %s", info.Name, tag)
+		return false, nil
+	}
+	log.Warn().Msgf("agent forwarding is enabled. users with root on the host(%s) can use your keys while connected", info.Name)
+	return true, nil
+}
+
+// knownHostsFiles returns the known_hosts files of the workspace configuration.
+func knownHostsFiles() []string {
+	files := make([]string, 0, len(workspaceConfig.KnownHosts.Files))
+	for _, file := range workspaceConfig.KnownHosts.Files {
+		file = expandPath(file)
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(workspace, file)
+		}
+		files = append(files, file)
+	}
+	return files
+}
+
+// recordConnectedAddress saves the address which the given client connected to as the last connection of the host.
+func recordConnectedAddress(cli *ssh.Client) {
+	if err := hostStore.UpdateLastConnection(context.Background(), cli.ServerInfo.ID, cli.Address); err != nil {
+		log.Warn().Err(err).Msgf("failed to record the connected address(%s)", cli.Address)
+		return
+	}
+	cli.ServerInfo.LastAddress = cli.Address
+}
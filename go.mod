@@ -3,13 +3,15 @@ module github.com/zacscoding/zssh
 go 1.16
 
 require (
+	github.com/BurntSushi/toml v1.2.1
 	github.com/manifoldco/promptui v0.9.0
 	github.com/mitchellh/go-homedir v1.0.0
 	github.com/pkg/errors v0.9.1
 	github.com/rs/zerolog v1.26.0
 	github.com/shiena/ansicolor v0.0.0-20200904210342-c7312218db18
 	github.com/spf13/cobra v1.2.1
-	golang.org/x/crypto v0.0.0-20200622213623-75b288015ac9
+	golang.org/x/crypto v0.14.0
+	gopkg.in/yaml.v3 v3.0.1
 	gorm.io/driver/sqlite v1.2.3
 	gorm.io/gorm v1.22.2
 )
@@ -0,0 +1,257 @@
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ErrDenied is returned if the use of a key is not confirmed.
+var ErrDenied = errors.New("agent: the use of the key is denied")
+
+// ConfirmFunc asks whether the key of the given comment and fingerprint can be used to sign.
+type ConfirmFunc func(comment, fingerprint string) bool
+
+// Key is a key in an agent.
+type Key struct {
+	Type        string `json:"type"`
+	Fingerprint string `json:"fingerprint"`
+	Comment     string `json:"comment"`
+}
+
+// Agent is an ssh agent which keeps keys in memory. Keys added with the confirmation are used to sign
+// only if the ConfirmFunc allows it, and keys with a lifetime are removed after it.
+type Agent struct {
+	agent.ExtendedAgent
+
+	confirm ConfirmFunc
+	// confirmMu serializes confirmations.
+	confirmMu sync.Mutex
+	mu        sync.Mutex
+	// confirmKeys are the public keys which require the confirmation.
+	confirmKeys map[string]bool
+}
+
+// New creates a new empty Agent. Keys which require the confirmation are always denied if confirm is nil.
+func New(confirm ConfirmFunc) *Agent {
+	return &Agent{
+		ExtendedAgent: agent.NewKeyring().(agent.ExtendedAgent),
+		confirm:       confirm,
+		confirmKeys:   make(map[string]bool),
+	}
+}
+
+// AddKeyFile adds the private key in the given path, which is decrypted with the passphrase if not empty.
+// The certificate "{path}-cert.pub" is added with the key if exists. Zero lifetime means forever.
+func (a *Agent) AddKeyFile(path, passphrase, comment string, lifetime time.Duration, confirm bool) error {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var privateKey interface{}
+	if passphrase == "" {
+		privateKey, err = ssh.ParseRawPrivateKey(b)
+	} else {
+		privateKey, err = ssh.ParseRawPrivateKeyWithPassphrase(b, []byte(passphrase))
+	}
+	if err != nil {
+		return err
+	}
+	key := agent.AddedKey{
+		PrivateKey:       privateKey,
+		Comment:          comment,
+		LifetimeSecs:     uint32(lifetime / time.Second),
+		ConfirmBeforeUse: confirm,
+	}
+	if cb, err := ioutil.ReadFile(path + "-cert.pub"); err == nil {
+		publicKey, _, _, _, err := ssh.ParseAuthorizedKey(cb)
+		if err != nil {
+			return fmt.Errorf("parse the certificate of %s: %v", path, err)
+		}
+		if cert, ok := publicKey.(*ssh.Certificate); ok {
+			key.Certificate = cert
+		}
+	}
+	return a.Add(key)
+}
+
+// Add adds the key to the Agent, which requires the confirmation to sign if ConfirmBeforeUse is set.
+func (a *Agent) Add(key agent.AddedKey) error {
+	signer, err := ssh.NewSignerFromKey(key.PrivateKey)
+	if err != nil {
+		return err
+	}
+	if err := a.ExtendedAgent.Add(key); err != nil {
+		return err
+	}
+	publicKeys := []ssh.PublicKey{signer.PublicKey()}
+	if key.Certificate != nil {
+		publicKeys = append(publicKeys, key.Certificate)
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, publicKey := range publicKeys {
+		if key.ConfirmBeforeUse {
+			a.confirmKeys[string(publicKey.Marshal())] = true
+		} else {
+			delete(a.confirmKeys, string(publicKey.Marshal()))
+		}
+	}
+	return nil
+}
+
+// Sign signs the data with the key after the confirmation if required.
+func (a *Agent) Sign(key ssh.PublicKey, data []byte) (*ssh.Signature, error) {
+	return a.SignWithFlags(key, data, 0)
+}
+
+// SignWithFlags signs the data with the key and the flags after the confirmation if required.
+func (a *Agent) SignWithFlags(key ssh.PublicKey, data []byte, flags agent.SignatureFlags) (*ssh.Signature, error) {
+	if err := a.confirmUse(key); err != nil {
+		return nil, err
+	}
+	return a.ExtendedAgent.SignWithFlags(key, data, flags)
+}
+
+// confirmUse asks the ConfirmFunc if the given key requires the confirmation.
+func (a *Agent) confirmUse(key ssh.PublicKey) error {
+	a.mu.Lock()
+	required := a.confirmKeys[string(key.Marshal())]
+	a.mu.Unlock()
+	if !required {
+		return nil
+	}
+	if a.confirm == nil {
+		return ErrDenied
+	}
+	comment := ""
+	if keys, err := a.ExtendedAgent.List(); err == nil {
+		for _, k := range keys {
+			if string(k.Marshal()) == string(key.Marshal()) {
+				comment = k.Comment
+			}
+		}
+	}
+	a.confirmMu.Lock()
+	defer a.confirmMu.Unlock()
+	if !a.confirm(comment, ssh.FingerprintSHA256(key)) {
+		return ErrDenied
+	}
+	return nil
+}
+
+// Keys returns the keys in the Agent.
+func (a *Agent) Keys() ([]*Key, error) {
+	keys, err := a.ExtendedAgent.List()
+	if err != nil {
+		return nil, err
+	}
+	return newKeys(keys), nil
+}
+
+// Serve serves agent requests of connections accepted by the given listener until it is closed.
+func (a *Agent) Serve(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go func() {
+			defer conn.Close()
+			_ = agent.ServeAgent(a, conn)
+		}()
+	}
+}
+
+// Listen listens on the unix socket of the given path which only the user can access.
+// A stale socket is removed, and it returns an error if an agent is listening on it.
+func Listen(socket string) (net.Listener, error) {
+	if conn, err := net.Dial("unix", socket); err == nil {
+		conn.Close()
+		return nil, fmt.Errorf("an agent is already listening on %s", socket)
+	}
+	if err := os.Remove(socket); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(socket), 0700); err != nil {
+		return nil, err
+	}
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(socket, 0600); err != nil {
+		l.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// List returns the keys in the agent listening on the given socket.
+func List(socket string) ([]*Key, error) {
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	keys, err := agent.NewClient(conn).List()
+	if err != nil {
+		return nil, err
+	}
+	return newKeys(keys), nil
+}
+
+// Has returns true if the agent listening on the given socket has the public key in the authorized_keys
+// format or a certificate of it.
+func Has(socket, authorizedKey string) (bool, error) {
+	publicKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(authorizedKey))
+	if err != nil {
+		return false, err
+	}
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+	keys, err := agent.NewClient(conn).List()
+	if err != nil {
+		return false, err
+	}
+	for _, k := range keys {
+		if matchKey(k, publicKey) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// matchKey returns true if the key of the agent is the public key or a certificate of it.
+func matchKey(k *agent.Key, publicKey ssh.PublicKey) bool {
+	want := string(publicKey.Marshal())
+	if string(k.Marshal()) == want {
+		return true
+	}
+	parsed, err := ssh.ParsePublicKey(k.Marshal())
+	if err != nil {
+		return false
+	}
+	if cert, ok := parsed.(*ssh.Certificate); ok {
+		return string(cert.Key.Marshal()) == want
+	}
+	return false
+}
+
+func newKeys(keys []*agent.Key) []*Key {
+	result := make([]*Key, 0, len(keys))
+	for _, k := range keys {
+		result = append(result, &Key{Type: k.Type(), Fingerprint: ssh.FingerprintSHA256(k), Comment: k.Comment})
+	}
+	return result
+}
@@ -0,0 +1,301 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Redacted replaces secrets in entries.
+const Redacted = "[REDACTED]"
+
+const backupTimeFormat = "2006-01-02T15-04-05.000"
+
+// redactLookahead is the bytes which a Capture keeps after its limit, so that secrets across the limit
+// are redacted before the output is truncated.
+const redactLookahead = 4 * 1024
+
+// Entry is a line of the audit log of an executed command.
+type Entry struct {
+	StartedAt  time.Time `json:"startedAt"`
+	EndedAt    time.Time `json:"endedAt"`
+	Host       string    `json:"host"`
+	Address    string    `json:"address"`
+	User       string    `json:"user"`
+	LocalUser  string    `json:"localUser"`
+	Command    string    `json:"command"`
+	ExitStatus int       `json:"exitStatus"`
+	Error      string    `json:"error,omitempty"`
+	Stdout     string    `json:"stdout"`
+	Stderr     string    `json:"stderr"`
+	// StdoutTruncated and StderrTruncated are true if the output exceeded the limit of the Logger.
+	StdoutTruncated bool `json:"stdoutTruncated,omitempty"`
+	StderrTruncated bool `json:"stderrTruncated,omitempty"`
+}
+
+// Options are options of the Logger.
+type Options struct {
+	// Path is the path of the active log file.
+	Path string
+	// MaxSize is the bytes of the active file to rotate. Zero means no rotation.
+	MaxSize int64
+	// MaxAge rotates the active file once its first entry is older than it, and removes rotated files
+	// which are older than it. Zero means no limit.
+	MaxAge time.Duration
+	// MaxBackups is the maximum number of rotated files to keep. Zero means no limit.
+	MaxBackups int
+	// Redact are patterns of secrets replaced with Redacted in commands and outputs.
+	// Only the first group is replaced if a pattern has groups.
+	Redact []string
+}
+
+// Logger appends entries to the audit log as JSON lines.
+type Logger struct {
+	mu     sync.Mutex
+	opts   Options
+	redact []*regexp.Regexp
+	// startedAt is the time of the first entry of the active file, which is zero if it is not read yet.
+	startedAt time.Time
+}
+
+// New returns a new Logger of the given options. It returns an error if a redact pattern is invalid.
+func New(opts Options) (*Logger, error) {
+	redact, err := CompilePatterns(opts.Redact)
+	if err != nil {
+		return nil, err
+	}
+	return &Logger{opts: opts, redact: redact}, nil
+}
+
+// CompilePatterns compiles the redact patterns.
+func CompilePatterns(patterns []string) ([]*regexp.Regexp, error) {
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redact pattern %s: %v", p, err)
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled, nil
+}
+
+// Write redacts the entry and appends it to the log, rotating the file by MaxSize and MaxAge.
+func (l *Logger) Write(e *Entry) error {
+	redacted := *e
+	redacted.Command = l.Redact(e.Command)
+	redacted.Stdout = l.Redact(e.Stdout)
+	redacted.Stderr = l.Redact(e.Stderr)
+	redacted.Error = l.Redact(e.Error)
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	// keeps shell operators such as "&&" and ">" readable in the log.
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(&redacted); err != nil {
+		return err
+	}
+	b := buf.Bytes()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.rotateIfNeeded(int64(len(b))); err != nil {
+		return fmt.Errorf("rotate %s: %v", l.opts.Path, err)
+	}
+	if err := os.MkdirAll(filepath.Dir(l.opts.Path), 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(l.opts.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Redact replaces secrets which match the redact patterns in the given string.
+func (l *Logger) Redact(s string) string {
+	for _, re := range l.redact {
+		if re.NumSubexp() == 0 {
+			s = re.ReplaceAllLiteralString(s, Redacted)
+			continue
+		}
+		var b strings.Builder
+		last := 0
+		for _, loc := range re.FindAllStringSubmatchIndex(s, -1) {
+			if loc[2] < 0 {
+				continue
+			}
+			b.WriteString(s[last:loc[2]])
+			b.WriteString(Redacted)
+			last = loc[3]
+		}
+		b.WriteString(s[last:])
+		s = b.String()
+	}
+	return s
+}
+
+// rotateIfNeeded renames the active file to a backup if writing n bytes exceeds MaxSize or its first entry
+// is older than MaxAge, and removes backups by MaxAge and MaxBackups.
+func (l *Logger) rotateIfNeeded(n int64) error {
+	if l.opts.MaxSize <= 0 && l.opts.MaxAge <= 0 {
+		return nil
+	}
+	stat, err := os.Stat(l.opts.Path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			l.startedAt = time.Time{}
+			return nil
+		}
+		return err
+	}
+	if stat.Size() == 0 {
+		return nil
+	}
+	rotate := l.opts.MaxSize > 0 && stat.Size()+n > l.opts.MaxSize
+	if !rotate && l.opts.MaxAge > 0 {
+		startedAt, err := l.activeStartedAt(stat)
+		if err != nil {
+			return err
+		}
+		rotate = time.Since(startedAt) > l.opts.MaxAge
+	}
+	if !rotate {
+		return nil
+	}
+	if err := os.Rename(l.opts.Path, l.backupPath(time.Now())); err != nil {
+		return err
+	}
+	l.startedAt = time.Time{}
+	return l.removeBackups()
+}
+
+// activeStartedAt returns the time of the first entry of the active file. The modification time of the file
+// is used if the first line is not an entry.
+func (l *Logger) activeStartedAt(stat os.FileInfo) (time.Time, error) {
+	if !l.startedAt.IsZero() {
+		return l.startedAt, nil
+	}
+	f, err := os.Open(l.opts.Path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer f.Close()
+	line, err := bufio.NewReader(f).ReadBytes('\n')
+	if err != nil && len(line) == 0 {
+		return time.Time{}, err
+	}
+	var e Entry
+	if err := json.Unmarshal(line, &e); err != nil || e.StartedAt.IsZero() {
+		return stat.ModTime(), nil
+	}
+	l.startedAt = e.StartedAt
+	return l.startedAt, nil
+}
+
+func (l *Logger) backupPath(t time.Time) string {
+	ext := filepath.Ext(l.opts.Path)
+	return strings.TrimSuffix(l.opts.Path, ext) + "-" + t.Format(backupTimeFormat) + ext
+}
+
+// Backups returns rotated files of the log sorted by the rotated time, newest first.
+func (l *Logger) Backups() ([]string, error) {
+	ext := filepath.Ext(l.opts.Path)
+	prefix := strings.TrimSuffix(l.opts.Path, ext) + "-"
+	paths, err := filepath.Glob(prefix + "*" + ext)
+	if err != nil {
+		return nil, err
+	}
+	var backups []string
+	for _, path := range paths {
+		ts := strings.TrimSuffix(strings.TrimPrefix(path, prefix), ext)
+		if _, err := time.Parse(backupTimeFormat, ts); err == nil {
+			backups = append(backups, path)
+		}
+	}
+	// the time format is sorted lexically.
+	sort.Sort(sort.Reverse(sort.StringSlice(backups)))
+	return backups, nil
+}
+
+func (l *Logger) removeBackups() error {
+	backups, err := l.Backups()
+	if err != nil {
+		return err
+	}
+	for i, path := range backups {
+		remove := l.opts.MaxBackups > 0 && i >= l.opts.MaxBackups
+		if !remove && l.opts.MaxAge > 0 {
+			if stat, err := os.Stat(path); err == nil && time.Since(stat.ModTime()) > l.opts.MaxAge {
+				remove = true
+			}
+		}
+		if remove {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Capture is a writer which keeps the written bytes up to the limit. The bytes should be redacted
+// by Redact before they are written to the log.
+type Capture struct {
+	limit     int
+	buf       []byte
+	truncated bool
+}
+
+// NewCapture returns a new Capture which keeps at most limit bytes. Zero limit keeps nothing.
+func NewCapture(limit int) *Capture {
+	return &Capture{limit: limit}
+}
+
+func (c *Capture) Write(p []byte) (int, error) {
+	if len(c.buf)+len(p) > c.limit {
+		c.truncated = true
+	}
+	remaining := c.limit + redactLookahead - len(c.buf)
+	if remaining < len(p) {
+		if remaining > 0 {
+			c.buf = append(c.buf, p[:remaining]...)
+		}
+		return len(p), nil
+	}
+	c.buf = append(c.buf, p...)
+	return len(p), nil
+}
+
+// Redact returns the kept bytes redacted by the given function. If the written bytes exceeded the limit,
+// they are redacted before they are truncated to the limit, and the last incomplete line is dropped
+// because a secret across the lookahead may not be matched by the patterns.
+func (c *Capture) Redact(redact func(string) string) string {
+	s := redact(string(c.buf))
+	if !c.truncated {
+		return s
+	}
+	if len(s) > c.limit {
+		s = s[:c.limit]
+	}
+	if i := strings.LastIndexByte(s, '\n'); i >= 0 {
+		return s[:i+1]
+	}
+	return ""
+}
+
+// Truncated returns true if the written bytes exceeded the limit.
+func (c *Capture) Truncated() bool {
+	return c.truncated
+}
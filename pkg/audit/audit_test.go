@@ -0,0 +1,257 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestLogger(t *testing.T, opts Options) *Logger {
+	t.Helper()
+	opts.Path = filepath.Join(t.TempDir(), "audit.log")
+	l, err := New(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l
+}
+
+func mustWrite(t *testing.T, l *Logger, e *Entry) {
+	t.Helper()
+	if err := l.Write(e); err != nil {
+		t.Fatal(err)
+	}
+	// backups are named by milliseconds.
+	time.Sleep(2 * time.Millisecond)
+}
+
+func readEntries(t *testing.T, path string) []Entry {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var entries []Entry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, e)
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return entries
+}
+
+func TestNewInvalidPattern(t *testing.T) {
+	if _, err := New(Options{Redact: []string{"("}}); err == nil {
+		t.Error("got no error of the invalid pattern")
+	}
+}
+
+func TestRedact(t *testing.T) {
+	l := newTestLogger(t, Options{Redact: []string{
+		`token-[0-9]+`,
+		`(?:password|passwd)=(\S+)`,
+		`key=(\w+)?;`,
+	}})
+	tests := []struct {
+		in, want string
+	}{
+		{"echo hello", "echo hello"},
+		{"curl -H token-1234 -H token-5678", "curl -H [REDACTED] -H [REDACTED]"},
+		{"login password=abc passwd=def", "login password=[REDACTED] passwd=[REDACTED]"},
+		// an unmatched group is not replaced.
+		{"key=; key=abc;", "key=; key=[REDACTED];"},
+		{"password=token-1", "password=[REDACTED]"},
+	}
+	for _, tt := range tests {
+		if got := l.Redact(tt.in); got != tt.want {
+			t.Errorf("redact %q: got %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestWrite(t *testing.T) {
+	l := newTestLogger(t, Options{Redact: []string{`password=(\S+)`}})
+	mustWrite(t, l, &Entry{
+		StartedAt: time.Now(),
+		Host:      "web",
+		Command:   "login password=abc && cat a > b",
+		Stdout:    "password=def\n",
+		Error:     "invalid password=ghi",
+	})
+
+	b, err := os.ReadFile(l.opts.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), "&& cat a > b") {
+		t.Errorf("got escaped command: %s", b)
+	}
+	entries := readEntries(t, l.opts.Path)
+	if len(entries) != 1 {
+		t.Fatalf("got %d entries, want 1", len(entries))
+	}
+	e := entries[0]
+	if e.Command != "login password=[REDACTED] && cat a > b" || e.Stdout != "password=[REDACTED]\n" || e.Error != "invalid password=[REDACTED]" {
+		t.Errorf("got entry %+v", e)
+	}
+}
+
+func TestCaptureRedact(t *testing.T) {
+	l := newTestLogger(t, Options{Redact: []string{`password=(\S+)`}})
+	tests := []struct {
+		name      string
+		limit     int
+		writes    []string
+		want      string
+		truncated bool
+	}{
+		{
+			name:   "within the limit",
+			limit:  64,
+			writes: []string{"ok\n", "password=abc\n"},
+			want:   "ok\npassword=[REDACTED]\n",
+		},
+		{
+			name:      "secret across the limit",
+			limit:     20,
+			writes:    []string{"ok\npassword=abcdef", "ghijkl\nmore\n"},
+			want:      "ok\n",
+			truncated: true,
+		},
+		{
+			name:      "secret after the limit",
+			limit:     8,
+			writes:    []string{"ok\nmore\n", "password=abc\n"},
+			want:      "ok\nmore\n",
+			truncated: true,
+		},
+		{
+			name:      "secret across the lookahead",
+			limit:     4,
+			writes:    []string{"ok\n", strings.Repeat("x", redactLookahead-12), "password=abcdefghijkl\n"},
+			want:      "ok\n",
+			truncated: true,
+		},
+		{
+			name:      "no line in the limit",
+			limit:     4,
+			writes:    []string{"password=abc\n"},
+			want:      "",
+			truncated: true,
+		},
+		{
+			name:      "zero limit",
+			limit:     0,
+			writes:    []string{"ok\n"},
+			want:      "",
+			truncated: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewCapture(tt.limit)
+			for _, w := range tt.writes {
+				if n, err := c.Write([]byte(w)); n != len(w) || err != nil {
+					t.Fatalf("write: got %d, %v", n, err)
+				}
+			}
+			got := c.Redact(l.Redact)
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+			if strings.Contains(got, "abc") {
+				t.Errorf("got the secret in %q", got)
+			}
+			if c.Truncated() != tt.truncated {
+				t.Errorf("got truncated %v, want %v", c.Truncated(), tt.truncated)
+			}
+		})
+	}
+}
+
+func TestRotateBySize(t *testing.T) {
+	l := newTestLogger(t, Options{MaxSize: 300, MaxBackups: 2})
+	command := strings.Repeat("x", 100)
+	for i := 0; i < 5; i++ {
+		mustWrite(t, l, &Entry{StartedAt: time.Now(), Command: command})
+	}
+
+	backups, err := l.Backups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 2 {
+		t.Fatalf("got %d backups, want 2", len(backups))
+	}
+	if backups[0] < backups[1] {
+		t.Errorf("got backups %v, want the newest first", backups)
+	}
+	for _, path := range append(backups, l.opts.Path) {
+		if n := len(readEntries(t, path)); n != 1 {
+			t.Errorf("got %d entries in %s, want 1", n, path)
+		}
+	}
+}
+
+func TestRotateByAge(t *testing.T) {
+	l := newTestLogger(t, Options{MaxAge: time.Hour})
+	mustWrite(t, l, &Entry{StartedAt: time.Now().Add(-30 * time.Minute), Host: "new"})
+	mustWrite(t, l, &Entry{StartedAt: time.Now(), Host: "new"})
+	if backups, err := l.Backups(); err != nil || len(backups) != 0 {
+		t.Fatalf("got backups %v, %v before MaxAge", backups, err)
+	}
+
+	// a new Logger reads the first entry of the active file.
+	l, err := New(Options{Path: l.opts.Path, MaxAge: 20 * time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustWrite(t, l, &Entry{StartedAt: time.Now(), Host: "next"})
+	backups, err := l.Backups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 1 {
+		t.Fatalf("got %d backups, want 1", len(backups))
+	}
+	if n := len(readEntries(t, backups[0])); n != 2 {
+		t.Errorf("got %d entries in the backup, want 2", n)
+	}
+	entries := readEntries(t, l.opts.Path)
+	if len(entries) != 1 || entries[0].Host != "next" {
+		t.Errorf("got active entries %+v, want [next]", entries)
+	}
+}
+
+func TestRemoveBackupsByAge(t *testing.T) {
+	l := newTestLogger(t, Options{MaxSize: 1, MaxAge: time.Hour})
+	old := l.backupPath(time.Now().Add(-2 * time.Hour))
+	if err := os.WriteFile(old, []byte("{}\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	modTime := time.Now().Add(-2 * time.Hour)
+	if err := os.Chtimes(old, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+
+	mustWrite(t, l, &Entry{StartedAt: time.Now()})
+	mustWrite(t, l, &Entry{StartedAt: time.Now()})
+	backups, err := l.Backups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 1 || backups[0] == old {
+		t.Errorf("got backups %v, want the new backup only", backups)
+	}
+}
@@ -0,0 +1,202 @@
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// FormatVersion is the version of the archive format.
+	FormatVersion = 1
+
+	manifestName = "manifest.json"
+)
+
+var (
+	ErrIntegrity = errors.New("backup integrity verification failed")
+)
+
+// Manifest describes the files in an archive.
+type Manifest struct {
+	Version       int       `json:"version"`
+	CreatedAt     time.Time `json:"createdAt"`
+	SchemaVersion int       `json:"schemaVersion"`
+	Files         []*File   `json:"files"`
+}
+
+// File is a file in an archive.
+type File struct {
+	// Name is the slash separated path in the archive.
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+	// Source is the original path of the file.
+	Source string `json:"source,omitempty"`
+}
+
+// Find returns the File with the given name or nil if not exists.
+func (m *Manifest) Find(name string) *File {
+	for _, f := range m.Files {
+		if f.Name == name {
+			return f
+		}
+	}
+	return nil
+}
+
+// Entry is a file to add to an archive.
+type Entry struct {
+	Name   string
+	Source string
+}
+
+// Create writes a gzipped tar archive of the given entries with a manifest to w.
+// The archive is encrypted if the passphrase is not empty.
+func Create(w io.Writer, schemaVersion int, entries []*Entry, passphrase string) (*Manifest, error) {
+	manifest := Manifest{
+		Version:       FormatVersion,
+		CreatedAt:     time.Now(),
+		SchemaVersion: schemaVersion,
+	}
+
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+	for _, entry := range entries {
+		b, err := ioutil.ReadFile(entry.Source)
+		if err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256(b)
+		manifest.Files = append(manifest.Files, &File{
+			Name:   entry.Name,
+			Size:   int64(len(b)),
+			SHA256: hex.EncodeToString(sum[:]),
+			Source: entry.Source,
+		})
+		if err := writeTarFile(tw, entry.Name, b); err != nil {
+			return nil, err
+		}
+	}
+	manifestBytes, err := json.MarshalIndent(&manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := writeTarFile(tw, manifestName, manifestBytes); err != nil {
+		return nil, err
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gw.Close(); err != nil {
+		return nil, err
+	}
+
+	out := buf.Bytes()
+	if passphrase != "" {
+		if out, err = encrypt(out, passphrase); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := w.Write(out); err != nil {
+		return nil, err
+	}
+	return &manifest, nil
+}
+
+// Extract extracts the archive read from r into the given directory and verifies checksums of files
+// in the manifest. The passphrase is required if the archive is encrypted.
+func Extract(r io.Reader, dir, passphrase string) (*Manifest, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if IsEncrypted(data) {
+		if passphrase == "" {
+			return nil, errors.New("passphrase is required for the encrypted backup")
+		}
+		if data, err = decrypt(data, passphrase); err != nil {
+			return nil, err
+		}
+	}
+
+	gr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrIntegrity, err)
+	}
+	tr := tar.NewReader(gr)
+	sums := make(map[string]string)
+	var manifest *Manifest
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrIntegrity, err)
+		}
+		name := path.Clean(hdr.Name)
+		if path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") {
+			return nil, fmt.Errorf("%w: invalid file name %s", ErrIntegrity, hdr.Name)
+		}
+		b, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrIntegrity, err)
+		}
+		if name == manifestName {
+			manifest = new(Manifest)
+			if err := json.Unmarshal(b, manifest); err != nil {
+				return nil, fmt.Errorf("%w: %v", ErrIntegrity, err)
+			}
+			continue
+		}
+		sum := sha256.Sum256(b)
+		sums[name] = hex.EncodeToString(sum[:])
+		dst := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(dst), 0700); err != nil {
+			return nil, err
+		}
+		if err := ioutil.WriteFile(dst, b, 0600); err != nil {
+			return nil, err
+		}
+	}
+
+	if manifest == nil {
+		return nil, fmt.Errorf("%w: no manifest", ErrIntegrity)
+	}
+	if manifest.Version > FormatVersion {
+		return nil, fmt.Errorf("unsupported backup format version: %d", manifest.Version)
+	}
+	for _, f := range manifest.Files {
+		if sums[f.Name] != f.SHA256 {
+			return nil, fmt.Errorf("%w: checksum mismatch of %s", ErrIntegrity, f.Name)
+		}
+	}
+	return manifest, nil
+}
+
+func writeTarFile(tw *tar.Writer, name string, b []byte) error {
+	if err := tw.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0600,
+		Size:    int64(len(b)),
+		ModTime: time.Now(),
+	}); err != nil {
+		return err
+	}
+	_, err := tw.Write(b)
+	return err
+}
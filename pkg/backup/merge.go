@@ -0,0 +1,152 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"github.com/zacscoding/zssh/pkg/host"
+	"gorm.io/gorm"
+	"reflect"
+)
+
+// Resolution is how to merge a host in a backup which conflicts with an existing host.
+type Resolution int
+
+const (
+	// ResolutionSkip keeps the existing host.
+	ResolutionSkip Resolution = iota
+	// ResolutionOverwrite replaces the existing host with the host in the backup.
+	ResolutionOverwrite
+	// ResolutionRename adds the host in the backup with a new name.
+	ResolutionRename
+)
+
+// Resolver returns the Resolution of the given conflict between the existing and the backup hosts.
+type Resolver func(existing, incoming *host.ServerInfo) (Resolution, error)
+
+// MergeResult is the result of Merge.
+type MergeResult struct {
+	Added       []string `json:"added"`
+	Overwritten []string `json:"overwritten"`
+	Renamed     []string `json:"renamed"`
+	Skipped     []string `json:"skipped"`
+	Unchanged   []string `json:"unchanged"`
+	// DroppedAliases are aliases of hosts in the backup which are used by other hosts.
+	DroppedAliases []string `json:"droppedAliases"`
+}
+
+// Merge merges the given hosts into the store. Hosts with the same name as existing hosts are merged
+// by the Resolution of the resolver unless they are identical.
+func Merge(ctx context.Context, store host.Store, hosts []*host.ServerInfo, resolve Resolver) (*MergeResult, error) {
+	var result MergeResult
+	for _, incoming := range hosts {
+		existing, err := store.FindByName(ctx, incoming.Name)
+		if err != nil && err != gorm.ErrRecordNotFound {
+			return &result, err
+		}
+		if existing != nil && existing.Name != incoming.Name {
+			// the name of the incoming host is an alias of the other host.
+			existing = nil
+			incoming.Name = renamed(ctx, store, incoming.Name)
+		}
+
+		info := copyHost(incoming)
+		if existing == nil {
+			result.DroppedAliases = append(result.DroppedAliases, dropUsedAliases(ctx, store, info, 0)...)
+			if err := store.Save(ctx, info); err != nil {
+				return &result, fmt.Errorf("add the host(%s): %v", info.Name, err)
+			}
+			result.Added = append(result.Added, info.Name)
+			continue
+		}
+		if identical(existing, incoming) {
+			result.Unchanged = append(result.Unchanged, incoming.Name)
+			continue
+		}
+
+		resolution, err := resolve(existing, incoming)
+		if err != nil {
+			return &result, err
+		}
+		switch resolution {
+		case ResolutionOverwrite:
+			info.ID = existing.ID
+			info.CreatedAt = existing.CreatedAt
+			result.DroppedAliases = append(result.DroppedAliases, dropUsedAliases(ctx, store, info, existing.ID)...)
+			if _, err := store.Update(ctx, info); err != nil {
+				return &result, fmt.Errorf("overwrite the host(%s): %v", info.Name, err)
+			}
+			result.Overwritten = append(result.Overwritten, info.Name)
+		case ResolutionRename:
+			info.Name = renamed(ctx, store, incoming.Name)
+			result.DroppedAliases = append(result.DroppedAliases, dropUsedAliases(ctx, store, info, 0)...)
+			if err := store.Save(ctx, info); err != nil {
+				return &result, fmt.Errorf("add the host(%s): %v", info.Name, err)
+			}
+			result.Renamed = append(result.Renamed, fmt.Sprintf("%s -> %s", incoming.Name, info.Name))
+		default:
+			result.Skipped = append(result.Skipped, incoming.Name)
+		}
+	}
+	return &result, nil
+}
+
+// copyHost returns a copy of the given host without ids to save into another store.
+func copyHost(info *host.ServerInfo) *host.ServerInfo {
+	c := *info
+	c.ID = 0
+	c.Aliases = nil
+	for _, alias := range info.Aliases {
+		c.Aliases = append(c.Aliases, host.ServerAlias{Name: alias.Name})
+	}
+	c.Addresses = nil
+	for _, addr := range info.Addresses {
+		c.Addresses = append(c.Addresses, host.ServerAddress{Seq: addr.Seq, Address: addr.Address, Port: addr.Port})
+	}
+	c.Tags = nil
+	for _, tag := range info.Tags {
+		c.Tags = append(c.Tags, host.ServerTag{Name: tag.Name})
+	}
+	return &c
+}
+
+// dropUsedAliases removes aliases of the given host which are names or aliases of other hosts than the host of id.
+func dropUsedAliases(ctx context.Context, store host.Store, info *host.ServerInfo, id uint) []string {
+	var (
+		aliases []host.ServerAlias
+		dropped []string
+	)
+	for _, alias := range info.Aliases {
+		if found, err := store.FindByName(ctx, alias.Name); err == nil && found.ID != id {
+			dropped = append(dropped, fmt.Sprintf("%s(%s)", alias.Name, info.Name))
+			continue
+		}
+		aliases = append(aliases, alias)
+	}
+	info.Aliases = aliases
+	return dropped
+}
+
+// renamed returns "{name}-restored" or "{name}-restored-N" which is not used by other hosts.
+func renamed(ctx context.Context, store host.Store, name string) string {
+	candidate := name + "-restored"
+	for i := 2; ; i++ {
+		if _, err := store.FindByName(ctx, candidate); err != nil {
+			return candidate
+		}
+		candidate = fmt.Sprintf("%s-restored-%d", name, i)
+	}
+}
+
+func identical(a, b *host.ServerInfo) bool {
+	return a.User == b.User &&
+		a.Address == b.Address &&
+		a.Port == b.Port &&
+		a.Password == b.Password &&
+		a.KeyPath == b.KeyPath &&
+		a.KeyName == b.KeyName &&
+		a.CertPath == b.CertPath &&
+		a.Description == b.Description &&
+		reflect.DeepEqual(a.AliasNames(), b.AliasNames()) &&
+		reflect.DeepEqual(a.TagNames(), b.TagNames()) &&
+		reflect.DeepEqual(a.Endpoints(), b.Endpoints())
+}
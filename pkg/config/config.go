@@ -0,0 +1,489 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	FileName = "config.yaml"
+)
+
+const (
+	LogFormatConsole = "console"
+	LogFormatJSON    = "json"
+)
+
+const (
+	OutputFormatTable    = "table"
+	OutputFormatJSON     = "json"
+	OutputFormatYAML     = "yaml"
+	OutputFormatCSV      = "csv"
+	OutputFormatTemplate = "template"
+)
+
+const (
+	StoreBackendSQLite = "sqlite"
+	StoreBackendJSON   = "json"
+	StoreBackendTOML   = "toml"
+)
+
+// Config is the configuration of a workspace loaded from the config.yaml file.
+type Config struct {
+	// User, Port and KeyPath are used if a host does not have them.
+	User    string `yaml:"user"`
+	Port    int    `yaml:"port"`
+	KeyPath string `yaml:"keypath"`
+
+	Terminal       TerminalConfig   `yaml:"terminal"`
+	ConnectTimeout Duration         `yaml:"connectTimeout"`
+	AuthTimeout    Duration         `yaml:"authTimeout"`
+	KeepAlive      KeepAliveConfig  `yaml:"keepAlive"`
+	KnownHosts     KnownHostsConfig `yaml:"knownHosts"`
+	Agent          AgentConfig      `yaml:"agent"`
+	Recording      RecordingConfig  `yaml:"recording"`
+	Audit          AuditConfig      `yaml:"audit"`
+	Mux            MuxConfig        `yaml:"mux"`
+
+	// Output is the default output format of commands.
+	Output string `yaml:"output"`
+	// OutputTemplate is the default template of the template output format.
+	OutputTemplate string         `yaml:"outputTemplate"`
+	Log            LogConfig      `yaml:"log"`
+	ConfirmDelete  bool           `yaml:"confirmDelete"`
+	Database       DatabaseConfig `yaml:"database"`
+	Store          StoreConfig    `yaml:"store"`
+
+	// Hosts is the overrides of the configuration by host name.
+	Hosts map[string]*HostConfig `yaml:"hosts,omitempty"`
+}
+
+type TerminalConfig struct {
+	Type string `yaml:"type"`
+	// Speed is the input and output baud rates of the pseudo terminal.
+	Speed uint32 `yaml:"speed"`
+}
+
+// KeepAliveConfig is the configuration of keepalive requests to detect dead connections.
+type KeepAliveConfig struct {
+	// Interval is the interval of keepalive requests. Zero disables keepalives. It is overridden by hosts.
+	Interval Duration `yaml:"interval"`
+	// MaxMissed closes the connection if the number of requests in a row are not replied.
+	MaxMissed int `yaml:"maxMissed"`
+}
+
+// KnownHostsConfig is the configuration of the verification of host keys.
+type KnownHostsConfig struct {
+	// Files are known_hosts files which may have @cert-authority entries. Files which do not exist are skipped,
+	// and relative paths are relative to the workspace.
+	Files []string `yaml:"files"`
+	// Strict rejects hosts which are not in the files. Changed host keys are rejected regardless of it.
+	Strict bool `yaml:"strict"`
+}
+
+// AgentConfig is the configuration of the ssh agent forwarding.
+type AgentConfig struct {
+	// Forward forwards the local ssh agent to all hosts. It is overridden by hosts.
+	Forward bool `yaml:"forward"`
+	// UntrustedTags are tags of hosts which the agent must not be forwarded to.
+	UntrustedTags []string `yaml:"untrustedTags"`
+}
+
+// RecordingConfig is the configuration of the recordings of shell sessions.
+type RecordingConfig struct {
+	// Always records shell sessions of all hosts. It is overridden by hosts.
+	Always bool `yaml:"always"`
+	// Dir is the directory of recordings. It is relative to the workspace unless it is absolute.
+	Dir string `yaml:"dir"`
+}
+
+// AuditConfig is the configuration of the audit log of executed commands.
+type AuditConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Path is the JSON lines file of the log. It is relative to the workspace unless it is absolute.
+	Path string `yaml:"path"`
+	// MaxOutput is the maximum bytes of each of stdout and stderr kept in an entry.
+	MaxOutput int `yaml:"maxOutput"`
+	// Redact are regular expressions of secrets masked in commands and outputs.
+	// Only the first group is masked if a pattern has groups.
+	Redact []string `yaml:"redact"`
+	// MaxSizeMB rotates the log when it exceeds the megabytes. Zero means no rotation.
+	MaxSizeMB int `yaml:"maxSizeMB"`
+	// MaxAge rotates the log once its first entry is older than it, and removes rotated logs older than it.
+	// Zero means no limit.
+	MaxAge Duration `yaml:"maxAge"`
+	// MaxBackups is the maximum number of rotated logs to keep. Zero means no limit.
+	MaxBackups int `yaml:"maxBackups"`
+}
+
+// MuxConfig is the configuration of the connection multiplexing daemon.
+type MuxConfig struct {
+	// Enabled opens sessions through the daemon if it is running.
+	Enabled bool `yaml:"enabled"`
+	// IdleTimeout closes the connection to a host of the daemon which has no sessions for it.
+	IdleTimeout Duration `yaml:"idleTimeout"`
+}
+
+type LogConfig struct {
+	Format string `yaml:"format"`
+}
+
+type DatabaseConfig struct {
+	OpenRetries   int      `yaml:"openRetries"`
+	RetryInterval Duration `yaml:"retryInterval"`
+}
+
+// StoreConfig is the configuration of where hosts are stored.
+type StoreConfig struct {
+	// Backend is one of sqlite, json and toml.
+	Backend string `yaml:"backend"`
+	// Path is the path of the json or toml file. It is relative to the workspace unless it is absolute.
+	// Defaults to hosts.json or hosts.toml in the workspace.
+	Path string `yaml:"path"`
+}
+
+// HostConfig is the configuration for a host. Zero values are not overridden.
+type HostConfig struct {
+	User              string   `yaml:"user,omitempty"`
+	Port              int      `yaml:"port,omitempty"`
+	KeyPath           string   `yaml:"keypath,omitempty"`
+	TerminalType      string   `yaml:"terminalType,omitempty"`
+	ConnectTimeout    Duration `yaml:"connectTimeout,omitempty"`
+	AuthTimeout       Duration `yaml:"authTimeout,omitempty"`
+	KeepAliveInterval Duration `yaml:"keepAliveInterval,omitempty"`
+	ForwardAgent      bool     `yaml:"forwardAgent,omitempty"`
+	Record            bool     `yaml:"record,omitempty"`
+}
+
+// Default returns a new Config with default values.
+func Default() *Config {
+	return &Config{
+		Port: 22,
+		Terminal: TerminalConfig{
+			Type:  "xterm-256color",
+			Speed: 115200,
+		},
+		ConnectTimeout: Duration(10 * time.Second),
+		AuthTimeout:    Duration(30 * time.Second),
+		KeepAlive: KeepAliveConfig{
+			Interval:  Duration(30 * time.Second),
+			MaxMissed: 3,
+		},
+		KnownHosts: KnownHostsConfig{
+			Files: []string{"known_hosts", "~/.ssh/known_hosts"},
+		},
+		Agent: AgentConfig{
+			UntrustedTags: []string{"untrusted"},
+		},
+		Recording: RecordingConfig{
+			Dir: "recordings",
+		},
+		Audit: AuditConfig{
+			Path:      "audit.jsonl",
+			MaxOutput: 64 * 1024,
+			Redact: []string{
+				`(?i)(?:password|passwd|secret|token|api[_-]?key)\s*[=:]\s*([^\s'";&|]+)`,
+				`(?i)authorization:\s*(?:bearer|basic)\s+([^\s'";&|]+)`,
+			},
+			MaxSizeMB:  10,
+			MaxAge:     Duration(30 * 24 * time.Hour),
+			MaxBackups: 5,
+		},
+		Mux: MuxConfig{
+			Enabled:     true,
+			IdleTimeout: Duration(10 * time.Minute),
+		},
+		Log: LogConfig{
+			Format: LogFormatConsole,
+		},
+		ConfirmDelete: true,
+		Database: DatabaseConfig{
+			OpenRetries:   10,
+			RetryInterval: Duration(500 * time.Millisecond),
+		},
+		Store: StoreConfig{
+			Backend: StoreBackendSQLite,
+		},
+	}
+}
+
+// Load loads the Config from the config file in the given workspace. It returns the default Config
+// if the file does not exist.
+func Load(workspace string) (*Config, error) {
+	c := Default()
+	b, err := ioutil.ReadFile(filepath.Join(workspace, FileName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return c, nil
+		}
+		return nil, err
+	}
+	if err := decode(b, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Validate returns an error if the Config has invalid values.
+func (c *Config) Validate() error {
+	if err := validatePort(c.Port); err != nil {
+		return err
+	}
+	switch c.Output {
+	case "", OutputFormatTable, OutputFormatJSON, OutputFormatYAML, OutputFormatCSV:
+	case OutputFormatTemplate:
+		if c.OutputTemplate == "" {
+			return fmt.Errorf("outputTemplate is required with the template output format")
+		}
+	default:
+		return fmt.Errorf("invalid output format: %s", c.Output)
+	}
+	switch c.Log.Format {
+	case LogFormatConsole, LogFormatJSON:
+	default:
+		return fmt.Errorf("invalid log format: %s", c.Log.Format)
+	}
+	if c.Terminal.Type == "" {
+		return fmt.Errorf("empty terminal type")
+	}
+	if c.Database.OpenRetries < 1 {
+		return fmt.Errorf("invalid database open retries: %d", c.Database.OpenRetries)
+	}
+	switch c.Store.Backend {
+	case StoreBackendSQLite, StoreBackendJSON, StoreBackendTOML:
+	default:
+		return fmt.Errorf("invalid store backend: %s", c.Store.Backend)
+	}
+	if c.KeepAlive.Interval < 0 || c.KeepAlive.MaxMissed < 1 {
+		return fmt.Errorf("invalid keepalive: interval=%s, maxMissed=%d",
+			time.Duration(c.KeepAlive.Interval), c.KeepAlive.MaxMissed)
+	}
+	if c.Audit.MaxOutput < 0 || c.Audit.MaxSizeMB < 0 || c.Audit.MaxBackups < 0 {
+		return fmt.Errorf("invalid audit limits: maxOutput=%d, maxSizeMB=%d, maxBackups=%d",
+			c.Audit.MaxOutput, c.Audit.MaxSizeMB, c.Audit.MaxBackups)
+	}
+	for _, pattern := range c.Audit.Redact {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("invalid audit redact pattern %s: %v", pattern, err)
+		}
+	}
+	for name, h := range c.Hosts {
+		if h == nil {
+			continue
+		}
+		if h.Port != 0 {
+			if err := validatePort(h.Port); err != nil {
+				return fmt.Errorf("host(%s): %v", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Host returns the HostConfig of the given host name merged with the defaults.
+func (c *Config) Host(name string) *HostConfig {
+	h := HostConfig{
+		User:              c.User,
+		Port:              c.Port,
+		KeyPath:           c.KeyPath,
+		TerminalType:      c.Terminal.Type,
+		ConnectTimeout:    c.ConnectTimeout,
+		AuthTimeout:       c.AuthTimeout,
+		KeepAliveInterval: c.KeepAlive.Interval,
+		ForwardAgent:      c.Agent.Forward,
+		Record:            c.Recording.Always,
+	}
+	override, ok := c.Hosts[name]
+	if !ok || override == nil {
+		return &h
+	}
+	if override.User != "" {
+		h.User = override.User
+	}
+	if override.Port != 0 {
+		h.Port = override.Port
+	}
+	if override.KeyPath != "" {
+		h.KeyPath = override.KeyPath
+	}
+	if override.TerminalType != "" {
+		h.TerminalType = override.TerminalType
+	}
+	if override.ConnectTimeout != 0 {
+		h.ConnectTimeout = override.ConnectTimeout
+	}
+	if override.AuthTimeout != 0 {
+		h.AuthTimeout = override.AuthTimeout
+	}
+	if override.KeepAliveInterval != 0 {
+		h.KeepAliveInterval = override.KeepAliveInterval
+	}
+	if override.ForwardAgent {
+		h.ForwardAgent = true
+	}
+	if override.Record {
+		h.Record = true
+	}
+	return &h
+}
+
+// StorePath returns the path of the file of the json or toml store in the given workspace.
+func (c *Config) StorePath(workspace string) string {
+	path := c.Store.Path
+	if path == "" {
+		path = "hosts." + c.Store.Backend
+	}
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(workspace, path)
+}
+
+// Values returns the flattened values of the Config by dotted keys such as "terminal.type".
+func (c *Config) Values() (map[string]string, error) {
+	b, err := yaml.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]interface{}
+	if err := yaml.Unmarshal(b, &m); err != nil {
+		return nil, err
+	}
+	values := make(map[string]string)
+	flatten("", m, values)
+	return values, nil
+}
+
+// Get returns the value of the given dotted key.
+func (c *Config) Get(key string) (string, error) {
+	values, err := c.Values()
+	if err != nil {
+		return "", err
+	}
+	v, ok := values[key]
+	if !ok {
+		return "", fmt.Errorf("unknown config key: %s", key)
+	}
+	return v, nil
+}
+
+// Keys returns the sorted dotted keys of the given values.
+func Keys(values map[string]string) []string {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Set sets the value of the given dotted key in the config file of the workspace.
+// The comments and the other values in the file are kept.
+func Set(workspace, key, value string) error {
+	path := filepath.Join(workspace, FileName)
+	var doc yaml.Node
+	b, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := yaml.Unmarshal(b, &doc); err != nil {
+		return err
+	}
+	if doc.Kind == 0 {
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode}}}
+	}
+
+	node := doc.Content[0]
+	for _, k := range strings.Split(key, ".") {
+		if node.Kind != yaml.MappingNode {
+			return fmt.Errorf("invalid config key: %s", key)
+		}
+		node = mappingValue(node, k)
+	}
+	if node.Kind == yaml.MappingNode && len(node.Content) > 0 {
+		return fmt.Errorf("config key %s is not a value", key)
+	}
+	*node = yaml.Node{Kind: yaml.ScalarNode, Value: value}
+
+	out, err := yaml.Marshal(&doc)
+	if err != nil {
+		return err
+	}
+	if err := decode(out, Default()); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, out, 0600)
+}
+
+// decode decodes the given yaml to the Config and validates it.
+func decode(b []byte, c *Config) error {
+	d := yaml.NewDecoder(bytes.NewReader(b))
+	d.KnownFields(true)
+	if err := d.Decode(c); err != nil && err != io.EOF {
+		return fmt.Errorf("parse %s: %v", FileName, err)
+	}
+	return c.Validate()
+}
+
+// mappingValue returns the value node of the given key in the mapping node. It appends a new
+// mapping node if the key does not exist.
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	v := &yaml.Node{Kind: yaml.MappingNode}
+	node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: key}, v)
+	return v
+}
+
+func flatten(prefix string, m map[string]interface{}, values map[string]string) {
+	for k, v := range m {
+		key := k
+		if prefix != "" {
+			key = prefix + "." + k
+		}
+		if child, ok := v.(map[string]interface{}); ok {
+			flatten(key, child, values)
+			continue
+		}
+		if v == nil {
+			values[key] = ""
+			continue
+		}
+		values[key] = fmt.Sprint(v)
+	}
+}
+
+func validatePort(port int) error {
+	if port < 1 || port > 65535 {
+		return fmt.Errorf("invalid port: %d", port)
+	}
+	return nil
+}
+
+// Duration is a time.Duration encoded as a string such as "10s" in yaml.
+type Duration time.Duration
+
+func (d Duration) MarshalYAML() (interface{}, error) {
+	return time.Duration(d).String(), nil
+}
+
+func (d *Duration) UnmarshalYAML(value *yaml.Node) error {
+	v, err := time.ParseDuration(value.Value)
+	if err != nil {
+		return fmt.Errorf("invalid duration: %s", value.Value)
+	}
+	*d = Duration(v)
+	return nil
+}
@@ -9,8 +9,18 @@ import (
 	"time"
 )
 
+const (
+	defaultOpenRetries   = 10
+	defaultRetryInterval = 500 * time.Millisecond
+)
+
 // NewSQLiteDB creates a new gorm.DB from given db path.
 func NewSQLiteDB(dbpath string) (*gorm.DB, error) {
+	return NewSQLiteDBWithRetry(dbpath, defaultOpenRetries, defaultRetryInterval)
+}
+
+// NewSQLiteDBWithRetry creates a new gorm.DB from given db path and retries to open it up to given retries.
+func NewSQLiteDBWithRetry(dbpath string, retries int, interval time.Duration) (*gorm.DB, error) {
 	var (
 		db  *gorm.DB
 		err error
@@ -26,17 +36,22 @@ func NewSQLiteDB(dbpath string) (*gorm.DB, error) {
 		},
 	)
 
-	for i := 0; i < 10; i++ {
+	for i := 0; i < retries; i++ {
 		db, err = gorm.Open(sqlite.Open(dbpath), &gorm.Config{
 			Logger: l,
 		})
 		if err == nil {
 			break
 		}
-		time.Sleep(500 * time.Millisecond)
+		time.Sleep(interval)
 	}
 	if err != nil {
 		return nil, err
 	}
 	return db, nil
 }
+
+// Snapshot writes a consistent copy of the given sqlite database to the path.
+func Snapshot(db *gorm.DB, path string) error {
+	return db.Exec("VACUUM INTO ?", path).Error
+}
@@ -0,0 +1,239 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	TableNameSchemaMigration = "schema_migrations"
+)
+
+var (
+	ErrNewerSchema = errors.New("database schema is newer than this version of zssh")
+)
+
+// Migration is a versioned change of the database schema.
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(tx *gorm.DB) error
+	Down    func(tx *gorm.DB) error
+}
+
+// SchemaMigration is a record of an applied Migration.
+type SchemaMigration struct {
+	Version   int       `gorm:"column:version;primarykey;autoIncrement:false"`
+	Name      string    `gorm:"column:name"`
+	AppliedAt time.Time `gorm:"column:applied_at"`
+}
+
+func (m SchemaMigration) TableName() string {
+	return TableNameSchemaMigration
+}
+
+// MigrationStatus is a Migration with the applied time if applied.
+type MigrationStatus struct {
+	Version   int        `json:"version"`
+	Name      string     `json:"name"`
+	Applied   bool       `json:"applied"`
+	AppliedAt *time.Time `json:"appliedAt"`
+}
+
+// Migrator applies or rolls back migrations to the database.
+type Migrator struct {
+	db         *gorm.DB
+	dbpath     string
+	migrations []*Migration
+}
+
+// NewMigrator creates a new Migrator of the registered migrations for the given db and its file path.
+func NewMigrator(db *gorm.DB, dbpath string) *Migrator {
+	return &Migrator{db: db, dbpath: dbpath, migrations: migrations}
+}
+
+// LatestVersion returns the version of the last registered migration.
+func (m *Migrator) LatestVersion() int {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// CurrentVersion returns the version of the last applied migration or 0 if no migration is applied.
+func (m *Migrator) CurrentVersion() (int, error) {
+	if err := m.db.Migrator().AutoMigrate(new(SchemaMigration)); err != nil {
+		return 0, err
+	}
+	var version int
+	if err := m.db.Model(new(SchemaMigration)).Select("COALESCE(MAX(version), 0)").Scan(&version).Error; err != nil {
+		return 0, err
+	}
+	return version, nil
+}
+
+// Check returns ErrNewerSchema if the database is migrated by a newer version of zssh.
+func (m *Migrator) Check() error {
+	current, err := m.CurrentVersion()
+	if err != nil {
+		return err
+	}
+	if current > m.LatestVersion() {
+		return fmt.Errorf("%w: %d > %d", ErrNewerSchema, current, m.LatestVersion())
+	}
+	return nil
+}
+
+// Pending returns true if there are migrations not applied yet.
+func (m *Migrator) Pending() (bool, error) {
+	current, err := m.CurrentVersion()
+	if err != nil {
+		return false, err
+	}
+	return current < m.LatestVersion(), nil
+}
+
+// Status returns the status of all registered migrations in the version order.
+func (m *Migrator) Status() ([]*MigrationStatus, error) {
+	if _, err := m.CurrentVersion(); err != nil {
+		return nil, err
+	}
+	var applied []*SchemaMigration
+	if err := m.db.Order("version").Find(&applied).Error; err != nil {
+		return nil, err
+	}
+	appliedByVersion := make(map[int]*SchemaMigration, len(applied))
+	for _, a := range applied {
+		appliedByVersion[a.Version] = a
+	}
+
+	var statuses []*MigrationStatus
+	for _, migration := range m.migrations {
+		status := MigrationStatus{Version: migration.Version, Name: migration.Name}
+		if a, ok := appliedByVersion[migration.Version]; ok {
+			status.Applied = true
+			appliedAt := a.AppliedAt
+			status.AppliedAt = &appliedAt
+		}
+		statuses = append(statuses, &status)
+	}
+	return statuses, nil
+}
+
+// Migrate applies or rolls back migrations to the given target version. The target is the latest version if negative.
+// The database file is backed up before changing the schema of the existing database and the path of the backup
+// is returned.
+func (m *Migrator) Migrate(target int) (string, error) {
+	if err := m.Check(); err != nil {
+		return "", err
+	}
+	current, err := m.CurrentVersion()
+	if err != nil {
+		return "", err
+	}
+	if target < 0 {
+		target = m.LatestVersion()
+	}
+	if target > m.LatestVersion() {
+		return "", fmt.Errorf("unknown target version: %d", target)
+	}
+	if target == current {
+		return "", nil
+	}
+
+	var backupPath string
+	if hasTables, err := m.hasTables(); err != nil {
+		return "", err
+	} else if hasTables {
+		backupPath, err = m.backup(current)
+		if err != nil {
+			return "", fmt.Errorf("backup the database: %v", err)
+		}
+	}
+
+	if target > current {
+		for _, migration := range m.migrations {
+			if migration.Version <= current || migration.Version > target {
+				continue
+			}
+			if err := m.apply(migration); err != nil {
+				return backupPath, err
+			}
+		}
+		return backupPath, nil
+	}
+	for i := len(m.migrations) - 1; i >= 0; i-- {
+		migration := m.migrations[i]
+		if migration.Version > current || migration.Version <= target {
+			continue
+		}
+		if err := m.rollback(migration); err != nil {
+			return backupPath, err
+		}
+	}
+	return backupPath, nil
+}
+
+func (m *Migrator) apply(migration *Migration) error {
+	return m.db.Transaction(func(tx *gorm.DB) error {
+		if err := migration.Up(tx); err != nil {
+			return fmt.Errorf("apply migration %d(%s): %v", migration.Version, migration.Name, err)
+		}
+		return tx.Create(&SchemaMigration{
+			Version:   migration.Version,
+			Name:      migration.Name,
+			AppliedAt: time.Now(),
+		}).Error
+	})
+}
+
+func (m *Migrator) rollback(migration *Migration) error {
+	if migration.Down == nil {
+		return fmt.Errorf("migration %d(%s) is irreversible", migration.Version, migration.Name)
+	}
+	return m.db.Transaction(func(tx *gorm.DB) error {
+		if err := migration.Down(tx); err != nil {
+			return fmt.Errorf("rollback migration %d(%s): %v", migration.Version, migration.Name, err)
+		}
+		return tx.Delete(&SchemaMigration{}, migration.Version).Error
+	})
+}
+
+// hasTables returns true if the database has tables except the schema_migrations table.
+func (m *Migrator) hasTables() (bool, error) {
+	var count int64
+	err := m.db.Raw("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%' AND name != ?",
+		TableNameSchemaMigration).Scan(&count).Error
+	return count > 0, err
+}
+
+// backup copies the database to "{dbpath}.v{version}-{timestamp}.bak".
+func (m *Migrator) backup(version int) (string, error) {
+	path := fmt.Sprintf("%s.v%d-%s.bak", m.dbpath, version, time.Now().Format("20060102150405.000000"))
+	if _, err := os.Stat(path); err == nil {
+		return "", fmt.Errorf("backup file already exists: %s", path)
+	}
+	if err := Snapshot(m.db, path); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+func init() {
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	for i, migration := range migrations {
+		if migration.Version != i+1 {
+			panic(fmt.Sprintf("migration versions must be sequential from 1: %d", migration.Version))
+		}
+		if strings.TrimSpace(migration.Name) == "" {
+			panic(fmt.Sprintf("migration %d has no name", migration.Version))
+		}
+	}
+}
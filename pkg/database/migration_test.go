@@ -0,0 +1,225 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestMigrator(t *testing.T) (*Migrator, *gorm.DB) {
+	t.Helper()
+	dbpath := filepath.Join(t.TempDir(), "zssh.db")
+	db, err := NewSQLiteDB(dbpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewMigrator(db, dbpath), db
+}
+
+func mustMigrate(t *testing.T, m *Migrator, target int) string {
+	t.Helper()
+	backupPath, err := m.Migrate(target)
+	if err != nil {
+		t.Fatalf("migrate to %d: %v", target, err)
+	}
+	return backupPath
+}
+
+func checkVersion(t *testing.T, m *Migrator, want int) {
+	t.Helper()
+	current, err := m.CurrentVersion()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if current != want {
+		t.Fatalf("got version %d, want %d", current, want)
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	m, db := newTestMigrator(t)
+	latest := m.LatestVersion()
+
+	// a new database is not backed up.
+	if backupPath := mustMigrate(t, m, -1); backupPath != "" {
+		t.Errorf("got backup %s of the new database", backupPath)
+	}
+	checkVersion(t, m, latest)
+	if pending, err := m.Pending(); err != nil || pending {
+		t.Errorf("got pending %v, %v", pending, err)
+	}
+	if backupPath := mustMigrate(t, m, latest); backupPath != "" {
+		t.Errorf("got backup %s without migrations", backupPath)
+	}
+
+	// rolls back and applies each migration again.
+	for version := latest - 1; version >= 0; version-- {
+		mustMigrate(t, m, version)
+		checkVersion(t, m, version)
+	}
+	if hasTables, err := m.hasTables(); err != nil || hasTables {
+		t.Errorf("got tables after rolling back all migrations: %v, %v", hasTables, err)
+	}
+	for version := 1; version <= latest; version++ {
+		mustMigrate(t, m, version)
+		checkVersion(t, m, version)
+	}
+	if !db.Migrator().HasIndex(new(hostV5), "DeletedAt") {
+		t.Error("no index of deleted_at of hosts")
+	}
+
+	statuses, err := m.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses) != latest {
+		t.Fatalf("got %d statuses, want %d", len(statuses), latest)
+	}
+	for _, status := range statuses {
+		if !status.Applied || status.AppliedAt == nil {
+			t.Errorf("migration %d is not applied", status.Version)
+		}
+	}
+}
+
+func TestMigrateBackup(t *testing.T) {
+	m, db := newTestMigrator(t)
+	mustMigrate(t, m, -1)
+	if err := db.Exec("INSERT INTO hosts(name, created_at, updated_at) VALUES (?, ?, ?)", "web", time.Now(), time.Now()).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	backupPath := mustMigrate(t, m, 0)
+	if backupPath == "" {
+		t.Fatal("the database is not backed up")
+	}
+	wantPrefix := fmt.Sprintf("%s.v%d-", m.dbpath, m.LatestVersion())
+	if !strings.HasPrefix(backupPath, wantPrefix) || !strings.HasSuffix(backupPath, ".bak") {
+		t.Errorf("got backup %s, want %s*.bak", backupPath, wantPrefix)
+	}
+
+	// the backup has the schema and the rows before the rollback.
+	backup, err := NewSQLiteDB(backupPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	backupMigrator := NewMigrator(backup, backupPath)
+	checkVersion(t, backupMigrator, m.LatestVersion())
+	var names []string
+	if err := backup.Table("hosts").Pluck("name", &names).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 1 || names[0] != "web" {
+		t.Errorf("got hosts %v in the backup, want [web]", names)
+	}
+	if _, err := os.Stat(backupPath); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMigrateNewerSchema(t *testing.T) {
+	m, db := newTestMigrator(t)
+	mustMigrate(t, m, -1)
+	newer := m.LatestVersion() + 1
+	if err := db.Create(&SchemaMigration{Version: newer, Name: "newer", AppliedAt: time.Now()}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.Check(); !errors.Is(err, ErrNewerSchema) {
+		t.Errorf("check: got %v, want %v", err, ErrNewerSchema)
+	}
+	if _, err := m.Migrate(0); !errors.Is(err, ErrNewerSchema) {
+		t.Errorf("migrate: got %v, want %v", err, ErrNewerSchema)
+	}
+	checkVersion(t, m, newer)
+	matches, err := filepath.Glob(m.dbpath + ".*.bak")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 0 {
+		t.Errorf("got backups %v of the refused migration", matches)
+	}
+}
+
+func TestMigrateUnknownTarget(t *testing.T) {
+	m, _ := newTestMigrator(t)
+	if _, err := m.Migrate(m.LatestVersion() + 1); err == nil {
+		t.Error("migrated to an unknown version")
+	}
+	checkVersion(t, m, 0)
+}
+
+func TestMigrateIrreversible(t *testing.T) {
+	m, db := newTestMigrator(t)
+	m.migrations = []*Migration{
+		{
+			Version: 1,
+			Name:    "create hosts",
+			Up: func(tx *gorm.DB) error {
+				return tx.Migrator().CreateTable(new(hostV1))
+			},
+		},
+	}
+	mustMigrate(t, m, -1)
+	if _, err := m.Migrate(0); err == nil || !strings.Contains(err.Error(), "irreversible") {
+		t.Errorf("got %v, want the irreversible migration", err)
+	}
+	checkVersion(t, m, 1)
+	if !db.Migrator().HasTable(new(hostV1)) {
+		t.Error("the table is dropped")
+	}
+}
+
+func TestMigrateFailure(t *testing.T) {
+	m, db := newTestMigrator(t)
+	m.migrations = []*Migration{
+		{
+			Version: 1,
+			Name:    "create hosts and fail",
+			Up: func(tx *gorm.DB) error {
+				if err := tx.Migrator().CreateTable(new(hostV1)); err != nil {
+					return err
+				}
+				return errors.New("failed")
+			},
+		},
+	}
+	if _, err := m.Migrate(-1); err == nil || !strings.Contains(err.Error(), "failed") {
+		t.Errorf("got %v, want the failure", err)
+	}
+	// the failed migration is rolled back with its transaction.
+	checkVersion(t, m, 0)
+	if db.Migrator().HasTable(new(hostV1)) {
+		t.Error("the table of the failed migration exists")
+	}
+}
+
+func TestMigrateSnapshotPasswords(t *testing.T) {
+	m, db := newTestMigrator(t)
+	mustMigrate(t, m, 7)
+	snapshots := []string{
+		`{"id":1,"name":"web","password":"secret","port":22}`,
+		`{"id":1,"name":"web","port":23}`,
+	}
+	for i, snapshot := range snapshots {
+		r := revisionV5{ServerInfoID: 1, Rev: i + 1, Action: "update", Changes: "[]", CreatedAt: time.Now(), Snapshot: snapshot}
+		if err := db.Create(&r).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mustMigrate(t, m, 8)
+	var got []string
+	if err := db.Model(new(revisionV5)).Order("rev").Pluck("snapshot", &got).Error; err != nil {
+		t.Fatal(err)
+	}
+	want := []string{`{"id":1,"name":"web","port":22}`, `{"id":1,"name":"web","port":23}`}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got snapshots %v, want %v", got, want)
+	}
+}
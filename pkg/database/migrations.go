@@ -0,0 +1,277 @@
+package database
+
+import (
+	"encoding/json"
+	"gorm.io/gorm"
+	"time"
+)
+
+// migrations are the all schema changes of the workspace database in the version order.
+//
+// Each migration defines the snapshot of models at the version instead of using models in other packages,
+// so the migration does not change when the models are changed. Migrations created before the schema_migrations
+// table use AutoMigrate to upgrade databases created by AutoMigrate of old versions.
+var migrations = []*Migration{
+	{
+		Version: 1,
+		Name:    "create hosts and active_host",
+		Up: func(tx *gorm.DB) error {
+			return tx.Migrator().AutoMigrate(new(hostV1), new(activeHostV1))
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(new(activeHostV1), new(hostV1))
+		},
+	},
+	{
+		Version: 2,
+		Name:    "add host aliases, addresses and last connection",
+		Up: func(tx *gorm.DB) error {
+			return tx.Migrator().AutoMigrate(new(hostV2), new(hostAliasV2), new(hostAddressV2))
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := tx.Migrator().DropTable(new(hostAddressV2), new(hostAliasV2)); err != nil {
+				return err
+			}
+			for _, column := range []string{"last_address", "last_connected_at"} {
+				if err := tx.Migrator().DropColumn(new(hostV2), column); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Version: 3,
+		Name:    "create connection_history",
+		Up: func(tx *gorm.DB) error {
+			return tx.Migrator().AutoMigrate(new(connectionV3))
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(new(connectionV3))
+		},
+	},
+	{
+		Version: 4,
+		Name:    "create host_tags",
+		Up: func(tx *gorm.DB) error {
+			return tx.Migrator().CreateTable(new(hostTagV4))
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(new(hostTagV4))
+		},
+	},
+	{
+		Version: 5,
+		Name:    "add deleted_at of hosts and create host_revisions",
+		Up: func(tx *gorm.DB) error {
+			if err := tx.Migrator().AddColumn(new(hostV5), "DeletedAt"); err != nil {
+				return err
+			}
+			if err := tx.Migrator().CreateIndex(new(hostV5), "DeletedAt"); err != nil {
+				return err
+			}
+			return tx.Migrator().CreateTable(new(revisionV5))
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := tx.Migrator().DropTable(new(revisionV5)); err != nil {
+				return err
+			}
+			// the index may be dropped by rollbacks of older versions which drop columns of hosts.
+			if tx.Migrator().HasIndex(new(hostV5), "DeletedAt") {
+				if err := tx.Migrator().DropIndex(new(hostV5), "DeletedAt"); err != nil {
+					return err
+				}
+			}
+			return tx.Migrator().DropColumn(new(hostV5), "deleted_at")
+		},
+	},
+	{
+		Version: 6,
+		Name:    "create keys and add key_name of hosts",
+		Up: func(tx *gorm.DB) error {
+			if err := tx.Migrator().CreateTable(new(keyV6)); err != nil {
+				return err
+			}
+			return tx.Migrator().AddColumn(new(hostV6), "KeyName")
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := dropHostColumn(tx, new(hostV6), "key_name"); err != nil {
+				return err
+			}
+			return tx.Migrator().DropTable(new(keyV6))
+		},
+	},
+	{
+		Version: 7,
+		Name:    "add cert_path of hosts",
+		Up: func(tx *gorm.DB) error {
+			return tx.Migrator().AddColumn(new(hostV7), "CertPath")
+		},
+		Down: func(tx *gorm.DB) error {
+			return dropHostColumn(tx, new(hostV7), "cert_path")
+		},
+	},
+	{
+		Version: 8,
+		Name:    "remove passwords from snapshots of host_revisions",
+		Up: func(tx *gorm.DB) error {
+			var revisions []*revisionV5
+			if err := tx.Where("snapshot LIKE ?", `%"password":%`).Find(&revisions).Error; err != nil {
+				return err
+			}
+			for _, r := range revisions {
+				var snapshot map[string]interface{}
+				if err := json.Unmarshal([]byte(r.Snapshot), &snapshot); err != nil {
+					continue
+				}
+				delete(snapshot, "password")
+				b, err := json.Marshal(snapshot)
+				if err != nil {
+					return err
+				}
+				if err := tx.Model(r).Update("snapshot", string(b)).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		// removed passwords can not be restored, and snapshots without them are valid in older versions.
+		Down: func(tx *gorm.DB) error {
+			return nil
+		},
+	},
+}
+
+// dropHostColumn drops the column of hosts after v5. Dropping a column of sqlite recreates the table
+// without indexes, so the index of deleted_at is created again.
+func dropHostColumn(tx *gorm.DB, model interface{}, column string) error {
+	if err := tx.Migrator().DropColumn(model, column); err != nil {
+		return err
+	}
+	if tx.Migrator().HasIndex(new(hostV5), "DeletedAt") {
+		return nil
+	}
+	return tx.Migrator().CreateIndex(new(hostV5), "DeletedAt")
+}
+
+type hostV1 struct {
+	ID          uint   `gorm:"column:id;primarykey"`
+	Name        string `gorm:"column:name;unique"`
+	User        string `gorm:"column:user_name"`
+	Address     string `gorm:"column:address"`
+	Port        int    `gorm:"column:port"`
+	Password    string `gorm:"column:password"`
+	KeyPath     string `gorm:"column:keypath"`
+	Description string `gorm:"column:description"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+func (hostV1) TableName() string { return "hosts" }
+
+type activeHostV1 struct {
+	ID           uint `gorm:"column:id;primarykey"`
+	ServerInfo   hostV1
+	ServerInfoID uint
+}
+
+func (activeHostV1) TableName() string { return "active_host" }
+
+type hostV2 struct {
+	hostV1
+	LastAddress     string     `gorm:"column:last_address"`
+	LastConnectedAt *time.Time `gorm:"column:last_connected_at"`
+}
+
+func (hostV2) TableName() string { return "hosts" }
+
+type hostAliasV2 struct {
+	ID           uint   `gorm:"column:id;primarykey"`
+	ServerInfoID uint   `gorm:"column:server_info_id;index"`
+	Name         string `gorm:"column:name;unique"`
+}
+
+func (hostAliasV2) TableName() string { return "host_aliases" }
+
+type hostAddressV2 struct {
+	ID           uint   `gorm:"column:id;primarykey"`
+	ServerInfoID uint   `gorm:"column:server_info_id;index"`
+	Seq          int    `gorm:"column:seq"`
+	Address      string `gorm:"column:address"`
+	Port         int    `gorm:"column:port"`
+}
+
+func (hostAddressV2) TableName() string { return "host_addresses" }
+
+type connectionV3 struct {
+	ID            uint       `gorm:"column:id;primarykey"`
+	ServerInfoID  uint       `gorm:"column:server_info_id;index"`
+	HostName      string     `gorm:"column:host_name;index"`
+	Address       string     `gorm:"column:address"`
+	Type          string     `gorm:"column:type"`
+	Command       string     `gorm:"column:command"`
+	ExitStatus    int        `gorm:"column:exit_status"`
+	Error         string     `gorm:"column:error"`
+	BytesSent     int64      `gorm:"column:bytes_sent"`
+	BytesReceived int64      `gorm:"column:bytes_received"`
+	StartedAt     time.Time  `gorm:"column:started_at;index"`
+	EndedAt       *time.Time `gorm:"column:ended_at"`
+}
+
+func (connectionV3) TableName() string { return "connection_history" }
+
+type hostTagV4 struct {
+	ID           uint   `gorm:"column:id;primarykey"`
+	ServerInfoID uint   `gorm:"column:server_info_id;uniqueIndex:idx_host_tags_host_name"`
+	Name         string `gorm:"column:name;uniqueIndex:idx_host_tags_host_name;index"`
+}
+
+func (hostTagV4) TableName() string { return "host_tags" }
+
+type hostV5 struct {
+	ID        uint           `gorm:"column:id;primarykey"`
+	DeletedAt gorm.DeletedAt `gorm:"column:deleted_at;index"`
+}
+
+func (hostV5) TableName() string { return "hosts" }
+
+type revisionV5 struct {
+	ID           uint      `gorm:"column:id;primarykey"`
+	ServerInfoID uint      `gorm:"column:server_info_id;index"`
+	Rev          int       `gorm:"column:rev"`
+	Action       string    `gorm:"column:action"`
+	Actor        string    `gorm:"column:actor"`
+	Changes      string    `gorm:"column:changes"`
+	CreatedAt    time.Time `gorm:"column:created_at"`
+	Snapshot     string    `gorm:"column:snapshot"`
+}
+
+func (revisionV5) TableName() string { return "host_revisions" }
+
+type hostV6 struct {
+	ID      uint   `gorm:"column:id;primarykey"`
+	KeyName string `gorm:"column:key_name"`
+}
+
+func (hostV6) TableName() string { return "hosts" }
+
+type keyV6 struct {
+	ID          uint      `gorm:"column:id;primarykey"`
+	Name        string    `gorm:"column:name;unique"`
+	Type        string    `gorm:"column:type"`
+	Bits        int       `gorm:"column:bits"`
+	Fingerprint string    `gorm:"column:fingerprint"`
+	Comment     string    `gorm:"column:comment"`
+	PublicKey   string    `gorm:"column:public_key"`
+	Encrypted   bool      `gorm:"column:encrypted"`
+	CreatedAt   time.Time `gorm:"column:created_at"`
+}
+
+func (keyV6) TableName() string { return "keys" }
+
+type hostV7 struct {
+	ID       uint   `gorm:"column:id;primarykey"`
+	CertPath string `gorm:"column:cert_path"`
+}
+
+func (hostV7) TableName() string { return "hosts" }
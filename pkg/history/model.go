@@ -0,0 +1,95 @@
+package history
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+const (
+	TableNameConnection = "connection_history"
+)
+
+const (
+	TypeShell = "shell"
+	TypeExec  = "exec"
+)
+
+// Connection is a record of a connection to a host.
+type Connection struct {
+	ID           uint   `json:"id" gorm:"column:id;primarykey"`
+	ServerInfoID uint   `json:"hostId" gorm:"column:server_info_id;index"`
+	HostName     string `json:"host" gorm:"column:host_name;index"`
+	Address      string `json:"address" gorm:"column:address"`
+	Type         string `json:"type" gorm:"column:type"`
+	Command      string `json:"command" gorm:"column:command"`
+	ExitStatus   int    `json:"exitStatus" gorm:"column:exit_status"`
+	Error        string `json:"error" gorm:"column:error"`
+	// BytesSent is the number of bytes sent to the remote host.
+	BytesSent int64 `json:"bytesSent" gorm:"column:bytes_sent"`
+	// BytesReceived is the number of bytes received from the remote host.
+	BytesReceived int64 `json:"bytesReceived" gorm:"column:bytes_received"`
+
+	StartedAt time.Time  `json:"startedAt" gorm:"column:started_at;index"`
+	EndedAt   *time.Time `json:"endedAt" gorm:"column:ended_at"`
+}
+
+func (c Connection) TableName() string {
+	return TableNameConnection
+}
+
+// Succeeded returns a true if the connection was closed without any errors, otherwise false.
+func (c *Connection) Succeeded() bool {
+	return c.ExitStatus == 0 && c.Error == ""
+}
+
+// Duration returns the elapsed time of the connection. It returns zero if the connection is not ended.
+func (c *Connection) Duration() time.Duration {
+	if c.EndedAt == nil {
+		return 0
+	}
+	return c.EndedAt.Sub(c.StartedAt)
+}
+
+func (c *Connection) String() string {
+	s := fmt.Sprintf("%s %s [%s]", c.StartedAt.Format(time.RFC3339), c.HostName, c.Type)
+	if c.Command != "" {
+		s += " " + c.Command
+	}
+	s += fmt.Sprintf(" exit=%d duration=%s sent=%dB received=%dB",
+		c.ExitStatus, c.Duration().Round(time.Millisecond), c.BytesSent, c.BytesReceived)
+	if c.Error != "" {
+		s += " error=" + c.Error
+	}
+	return s
+}
+
+func (c *Connection) ToJSON(pretty bool) string {
+	var (
+		b   []byte
+		err error
+	)
+	if pretty {
+		b, err = json.MarshalIndent(c, "", "  ")
+	} else {
+		b, err = json.Marshal(c)
+	}
+	if err != nil {
+		return err.Error()
+	}
+	return string(b)
+}
+
+// Stats is the usage statistics of a host.
+type Stats struct {
+	ServerInfoID    uint      `json:"hostId"`
+	HostName        string    `json:"host"`
+	Connections     int64     `json:"connections"`
+	Failures        int64     `json:"failures"`
+	LastConnectedAt time.Time `json:"lastConnectedAt"`
+}
+
+func (s *Stats) String() string {
+	return fmt.Sprintf("%s: %d connections (%d failed), last connected at %s",
+		s.HostName, s.Connections, s.Failures, s.LastConnectedAt.Format(time.RFC3339))
+}
@@ -0,0 +1,125 @@
+package history
+
+import (
+	"context"
+	"gorm.io/gorm"
+	"time"
+)
+
+// Filter is the conditions to find connections. Zero values are ignored.
+type Filter struct {
+	HostName   string
+	Type       string
+	Since      time.Time
+	Until      time.Time
+	FailedOnly bool
+	Limit      int
+}
+
+type Store interface {
+	Save(ctx context.Context, c *Connection) error
+	Update(ctx context.Context, c *Connection) error
+	Find(ctx context.Context, filter *Filter) ([]*Connection, error)
+	Stats(ctx context.Context) ([]*Stats, error)
+}
+
+// NewStore creates a new Store from given gorm.DB.
+func NewStore(db *gorm.DB) Store {
+	return &store{db: db}
+}
+
+type store struct {
+	db *gorm.DB
+}
+
+func (s *store) Save(ctx context.Context, c *Connection) error {
+	return s.db.WithContext(ctx).Create(c).Error
+}
+
+func (s *store) Update(ctx context.Context, c *Connection) error {
+	return s.db.WithContext(ctx).Save(c).Error
+}
+
+// Find returns connections matched with the given filter in the latest order.
+func (s *store) Find(ctx context.Context, filter *Filter) ([]*Connection, error) {
+	db := s.db.WithContext(ctx)
+	if filter != nil {
+		if filter.HostName != "" {
+			db = db.Where("host_name = ?", filter.HostName)
+		}
+		if filter.Type != "" {
+			db = db.Where("type = ?", filter.Type)
+		}
+		if !filter.Since.IsZero() {
+			db = db.Where("started_at >= ?", filter.Since)
+		}
+		if !filter.Until.IsZero() {
+			db = db.Where("started_at < ?", filter.Until)
+		}
+		if filter.FailedOnly {
+			db = db.Where("exit_status != 0 OR error != ''")
+		}
+		if filter.Limit > 0 {
+			db = db.Limit(filter.Limit)
+		}
+	}
+
+	var connections []*Connection
+	if err := db.Order("started_at DESC").Order("id DESC").Find(&connections).Error; err != nil {
+		return nil, err
+	}
+	return connections, nil
+}
+
+// Stats returns the usage statistics of each host in the order of the last connected time.
+func (s *store) Stats(ctx context.Context) ([]*Stats, error) {
+	var rows []struct {
+		ServerInfoID uint
+		Connections  int64
+		Failures     int64
+		LastID       uint
+	}
+	if err := s.db.WithContext(ctx).
+		Model(new(Connection)).
+		Select("server_info_id, " +
+			"COUNT(*) AS connections, " +
+			"SUM(CASE WHEN exit_status != 0 OR error != '' THEN 1 ELSE 0 END) AS failures, " +
+			"MAX(id) AS last_id").
+		Group("server_info_id").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+
+	// sqlite returns aggregated datetime as text, so loads the last connections to read the time.
+	lastIDs := make([]uint, len(rows))
+	for i, row := range rows {
+		lastIDs[i] = row.LastID
+	}
+	var lasts []*Connection
+	if err := s.db.WithContext(ctx).
+		Where("id IN ?", lastIDs).
+		Order("started_at DESC").
+		Find(&lasts).Error; err != nil {
+		return nil, err
+	}
+
+	statsByID := make(map[uint]*Stats, len(rows))
+	for _, row := range rows {
+		statsByID[row.LastID] = &Stats{
+			ServerInfoID: row.ServerInfoID,
+			Connections:  row.Connections,
+			Failures:     row.Failures,
+		}
+	}
+	stats := make([]*Stats, 0, len(lasts))
+	for _, last := range lasts {
+		st := statsByID[last.ID]
+		st.HostName = last.HostName
+		st.LastConnectedAt = last.StartedAt
+		stats = append(stats, st)
+	}
+	return stats, nil
+}
@@ -0,0 +1,326 @@
+package host
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	FileFormatJSON = "json"
+	FileFormatTOML = "toml"
+)
+
+// hostsFile is the hand-editable content of the file of a file Store.
+type hostsFile struct {
+	// Active is the name of the active host.
+	Active string `json:"active,omitempty" toml:"active,omitempty"`
+	// Hosts include hosts in the trash, which have deletedAt.
+	Hosts     []*hostRecord     `json:"hosts" toml:"hosts"`
+	Revisions []*revisionRecord `json:"revisions,omitempty" toml:"revisions,omitempty"`
+}
+
+// revisionRecord is a Revision in the file.
+type revisionRecord struct {
+	HostID    uint      `json:"hostId" toml:"hostId"`
+	Rev       int       `json:"rev" toml:"rev"`
+	Action    string    `json:"action" toml:"action"`
+	Actor     string    `json:"actor,omitempty" toml:"actor,omitempty"`
+	Changes   Changes   `json:"changes,omitempty" toml:"changes,omitempty"`
+	CreatedAt time.Time `json:"createdAt" toml:"createdAt"`
+	Snapshot  string    `json:"snapshot" toml:"snapshot"`
+}
+
+// NewFileStore creates a new Store which keeps hosts in the json or toml file of the given path.
+// The format is decided by the extension of the path. The file is read on every call, so changes
+// edited by hand are applied without restarting.
+func NewFileStore(path string) (Store, error) {
+	format := strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+	switch format {
+	case FileFormatJSON, FileFormatTOML:
+	default:
+		return nil, fmt.Errorf("unsupported file format of the host store: %s", path)
+	}
+	fs := &fileStore{path: path, format: format}
+	ms, err := fs.load()
+	if err != nil {
+		return nil, err
+	}
+	// rewrites snapshots of revisions which have passwords recorded by older versions.
+	scrubbed := false
+	for _, revisions := range ms.revisions {
+		for _, r := range revisions {
+			if snapshot := snapshotWithoutPassword(r.Snapshot); snapshot != r.Snapshot {
+				r.Snapshot = snapshot
+				scrubbed = true
+			}
+		}
+	}
+	if scrubbed {
+		if err := fs.write(ms); err != nil {
+			return nil, err
+		}
+	}
+	return fs, nil
+}
+
+type fileStore struct {
+	mu     sync.Mutex
+	path   string
+	format string
+}
+
+func (fs *fileStore) Save(ctx context.Context, info *ServerInfo) error {
+	return fs.update(func(ms *memoryStore) error {
+		return ms.Save(ctx, info)
+	})
+}
+
+// FindByName finds a ServerInfo that has the given hostname as a name or an alias.
+func (fs *fileStore) FindByName(ctx context.Context, hostname string) (*ServerInfo, error) {
+	ms, err := fs.read()
+	if err != nil {
+		return nil, err
+	}
+	return ms.FindByName(ctx, hostname)
+}
+
+func (fs *fileStore) FindAll(ctx context.Context) ([]*ServerInfo, error) {
+	ms, err := fs.read()
+	if err != nil {
+		return nil, err
+	}
+	return ms.FindAll(ctx)
+}
+
+func (fs *fileStore) Find(ctx context.Context, q *Query) (*Page, error) {
+	ms, err := fs.read()
+	if err != nil {
+		return nil, err
+	}
+	return ms.Find(ctx, q)
+}
+
+// Update updates the given ServerInfo and replaces its aliases and addresses. The creation time and the
+// last connection of the host are kept.
+func (fs *fileStore) Update(ctx context.Context, info *ServerInfo) (int64, error) {
+	var updated int64
+	err := fs.update(func(ms *memoryStore) error {
+		var err error
+		updated, err = ms.Update(ctx, info)
+		return err
+	})
+	return updated, err
+}
+
+// UpdateLastConnection records the given address as the last connected address of the host at now.
+func (fs *fileStore) UpdateLastConnection(ctx context.Context, id uint, address string) error {
+	return fs.update(func(ms *memoryStore) error {
+		return ms.UpdateLastConnection(ctx, id, address)
+	})
+}
+
+func (fs *fileStore) DeleteByName(ctx context.Context, hostname string) (int64, error) {
+	var deleted int64
+	err := fs.update(func(ms *memoryStore) error {
+		var err error
+		deleted, err = ms.DeleteByName(ctx, hostname)
+		return err
+	})
+	return deleted, err
+}
+
+func (fs *fileStore) FindTrash(ctx context.Context) ([]*ServerInfo, error) {
+	ms, err := fs.read()
+	if err != nil {
+		return nil, err
+	}
+	return ms.FindTrash(ctx)
+}
+
+func (fs *fileStore) Restore(ctx context.Context, hostname string) (*ServerInfo, error) {
+	var restored *ServerInfo
+	err := fs.update(func(ms *memoryStore) error {
+		var err error
+		restored, err = ms.Restore(ctx, hostname)
+		return err
+	})
+	return restored, err
+}
+
+func (fs *fileStore) Purge(ctx context.Context, hostnames ...string) (int64, error) {
+	var purged int64
+	err := fs.update(func(ms *memoryStore) error {
+		var err error
+		purged, err = ms.Purge(ctx, hostnames...)
+		return err
+	})
+	return purged, err
+}
+
+func (fs *fileStore) FindRevisions(ctx context.Context, hostname string) ([]*Revision, error) {
+	ms, err := fs.read()
+	if err != nil {
+		return nil, err
+	}
+	return ms.FindRevisions(ctx, hostname)
+}
+
+func (fs *fileStore) Revert(ctx context.Context, hostname string, rev int) (*ServerInfo, error) {
+	var reverted *ServerInfo
+	err := fs.update(func(ms *memoryStore) error {
+		var err error
+		reverted, err = ms.Revert(ctx, hostname, rev)
+		return err
+	})
+	return reverted, err
+}
+
+func (fs *fileStore) SaveOrUpdateActiveServerInfo(ctx context.Context, info *ServerInfo) error {
+	return fs.update(func(ms *memoryStore) error {
+		return ms.SaveOrUpdateActiveServerInfo(ctx, info)
+	})
+}
+
+func (fs *fileStore) FindActiveServerInfo(ctx context.Context) (*ServerInfo, error) {
+	ms, err := fs.read()
+	if err != nil {
+		return nil, err
+	}
+	return ms.FindActiveServerInfo(ctx)
+}
+
+func (fs *fileStore) read() (*memoryStore, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return fs.load()
+}
+
+// update loads the file, applies the given change and writes the file if the change succeeded.
+func (fs *fileStore) update(change func(ms *memoryStore) error) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	ms, err := fs.load()
+	if err != nil {
+		return err
+	}
+	if err := change(ms); err != nil {
+		return err
+	}
+	return fs.write(ms)
+}
+
+// load reads the file to a memoryStore. A file that does not exist is regarded as empty.
+func (fs *fileStore) load() (*memoryStore, error) {
+	ms := newMemoryStore()
+	b, err := ioutil.ReadFile(fs.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return ms, nil
+		}
+		return nil, err
+	}
+	var f hostsFile
+	if fs.format == FileFormatJSON {
+		if len(bytes.TrimSpace(b)) != 0 {
+			err = json.Unmarshal(b, &f)
+		}
+	} else {
+		_, err = toml.Decode(string(b), &f)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %v", fs.path, err)
+	}
+
+	// assigns ids after the hosts that have ids to keep them.
+	for _, h := range f.Hosts {
+		if h.ID > ms.lastID {
+			ms.lastID = h.ID
+		}
+	}
+	for _, h := range f.Hosts {
+		info := h.toServerInfo()
+		if info.Name == "" {
+			return nil, fmt.Errorf("parse %s: empty host name", fs.path)
+		}
+		if err := ms.insert(info); err != nil {
+			return nil, fmt.Errorf("parse %s: %v", fs.path, err)
+		}
+		if f.Active != "" && f.Active == info.Name && !info.Trashed() {
+			ms.activeID = info.ID
+		}
+	}
+	for _, r := range f.Revisions {
+		if _, ok := ms.hosts[r.HostID]; !ok {
+			continue
+		}
+		ms.revisions[r.HostID] = append(ms.revisions[r.HostID], &Revision{
+			ID:           uint(len(ms.revisions[r.HostID]) + 1),
+			ServerInfoID: r.HostID,
+			Rev:          r.Rev,
+			Action:       r.Action,
+			Actor:        r.Actor,
+			Changes:      r.Changes,
+			CreatedAt:    r.CreatedAt,
+			Snapshot:     r.Snapshot,
+		})
+	}
+	return ms, nil
+}
+
+// write writes hosts of the memoryStore to the file through a temporary file.
+func (fs *fileStore) write(ms *memoryStore) error {
+	f := hostsFile{Hosts: []*hostRecord{}}
+	for _, info := range append(ms.sorted(false), ms.sorted(true)...) {
+		f.Hosts = append(f.Hosts, newHostRecord(info))
+		if info.ID == ms.activeID && !info.Trashed() {
+			f.Active = info.Name
+		}
+		for _, r := range ms.revisions[info.ID] {
+			f.Revisions = append(f.Revisions, &revisionRecord{
+				HostID:    info.ID,
+				Rev:       r.Rev,
+				Action:    r.Action,
+				Actor:     r.Actor,
+				Changes:   r.Changes,
+				CreatedAt: r.CreatedAt,
+				Snapshot:  r.Snapshot,
+			})
+		}
+	}
+	var buf bytes.Buffer
+	if fs.format == FileFormatJSON {
+		e := json.NewEncoder(&buf)
+		e.SetIndent("", "  ")
+		if err := e.Encode(&f); err != nil {
+			return err
+		}
+	} else if err := toml.NewEncoder(&buf).Encode(&f); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(fs.path), 0700); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(fs.path), "."+filepath.Base(fs.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), fs.path)
+}
@@ -0,0 +1,23 @@
+package host_test
+
+import (
+	"fmt"
+	"github.com/zacscoding/zssh/pkg/host"
+	"github.com/zacscoding/zssh/pkg/host/hosttest"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileStore(t *testing.T) {
+	for _, format := range []string{host.FileFormatJSON, host.FileFormatTOML} {
+		t.Run(format, func(t *testing.T) {
+			dir, n := t.TempDir(), 0
+			if err := hosttest.TestStore(func() (host.Store, error) {
+				n++
+				return host.NewFileStore(filepath.Join(dir, fmt.Sprintf("hosts-%d.%s", n, format)))
+			}); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
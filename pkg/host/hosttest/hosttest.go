@@ -0,0 +1,832 @@
+// Package hosttest implements the conformance suite of host.Store implementations.
+//
+// An implementation is checked by calling TestStore from a test:
+//
+//	func TestStore(t *testing.T) {
+//		if err := hosttest.TestStore(func() (host.Store, error) {
+//			return host.NewMemoryStore(), nil
+//		}); err != nil {
+//			t.Fatal(err)
+//		}
+//	}
+package hosttest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/zacscoding/zssh/pkg/host"
+	"gorm.io/gorm"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// NewStore creates a new empty host.Store to check.
+type NewStore func() (host.Store, error)
+
+type testCase struct {
+	name string
+	run  func(ctx context.Context, s host.Store) error
+}
+
+var testCases = []testCase{
+	{"save and find by name", testSaveAndFind},
+	{"find by alias", testFindByAlias},
+	{"find not found", testFindNotFound},
+	{"save duplicate name", testSaveDuplicate},
+	{"names and aliases are unique", testUniqueNames},
+	{"find all", testFindAll},
+	{"update", testUpdate},
+	{"update last connection", testUpdateLastConnection},
+	{"update keeps the last connection", testUpdateKeepsLastConnection},
+	{"delete by name", testDeleteByName},
+	{"active host", testActiveHost},
+	{"isolated values", testIsolatedValues},
+	{"tags", testTags},
+	{"find by query", testFindByQuery},
+	{"find sorted", testFindSorted},
+	{"find pages", testFindPages},
+	{"trash", testTrash},
+	{"purge", testPurge},
+	{"revisions", testRevisions},
+	{"revert", testRevert},
+}
+
+// TestStore runs the conformance suite against stores created by newStore. A new store is created for
+// each case. It returns an error describing all failed cases, or nil if the store conforms.
+func TestStore(newStore NewStore) error {
+	var failures []string
+	for _, tc := range testCases {
+		s, err := newStore()
+		if err != nil {
+			return fmt.Errorf("create a store: %v", err)
+		}
+		if err := tc.run(context.Background(), s); err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", tc.name, err))
+		}
+	}
+	if len(failures) != 0 {
+		return errors.New("hosttest: store does not conform:\n\t" + strings.Join(failures, "\n\t"))
+	}
+	return nil
+}
+
+func newHost(name string, aliases ...string) *host.ServerInfo {
+	info := &host.ServerInfo{
+		Name:        name,
+		User:        "root",
+		Address:     "10.0.0.1",
+		Port:        22,
+		Password:    "secret",
+		Description: "host " + name,
+		Addresses: []host.ServerAddress{
+			{Seq: 0, Address: "10.0.1.1", Port: 2222},
+			{Seq: 1, Address: "10.0.2.1"},
+		},
+	}
+	for _, alias := range aliases {
+		info.Aliases = append(info.Aliases, host.ServerAlias{Name: alias})
+	}
+	return info
+}
+
+func saveHosts(ctx context.Context, s host.Store, hosts ...*host.ServerInfo) error {
+	for _, info := range hosts {
+		if err := s.Save(ctx, info); err != nil {
+			return fmt.Errorf("save %s: %w", info.Name, err)
+		}
+	}
+	return nil
+}
+
+// checkHost returns an error if the found host does not have the values of the expected host.
+func checkHost(found, expected *host.ServerInfo) error {
+	if found == nil {
+		return fmt.Errorf("host %s is nil", expected.Name)
+	}
+	for _, f := range []struct {
+		field     string
+		got, want interface{}
+	}{
+		{"id", found.ID, expected.ID},
+		{"name", found.Name, expected.Name},
+		{"user", found.User, expected.User},
+		{"address", found.Address, expected.Address},
+		{"port", found.Port, expected.Port},
+		{"password", found.Password, expected.Password},
+		{"keypath", found.KeyPath, expected.KeyPath},
+		{"key", found.KeyName, expected.KeyName},
+		{"certpath", found.CertPath, expected.CertPath},
+		{"description", found.Description, expected.Description},
+		{"aliases", found.AliasNames(), expected.AliasNames()},
+		{"tags", found.TagNames(), expected.TagNames()},
+		{"endpoints", found.Endpoints(), expected.Endpoints()},
+	} {
+		if !reflect.DeepEqual(f.got, f.want) {
+			return fmt.Errorf("%s of %s: got %v, want %v", f.field, expected.Name, f.got, f.want)
+		}
+	}
+	return nil
+}
+
+func testSaveAndFind(ctx context.Context, s host.Store) error {
+	web, db := newHost("web"), newHost("db")
+	if err := saveHosts(ctx, s, web, db); err != nil {
+		return err
+	}
+	if web.ID == 0 || db.ID == 0 || web.ID == db.ID {
+		return fmt.Errorf("ids are not assigned: %d, %d", web.ID, db.ID)
+	}
+	found, err := s.FindByName(ctx, "db")
+	if err != nil {
+		return err
+	}
+	if found.CreatedAt.IsZero() || found.UpdatedAt.IsZero() {
+		return fmt.Errorf("timestamps are not set")
+	}
+	return checkHost(found, db)
+}
+
+func testFindByAlias(ctx context.Context, s host.Store) error {
+	web := newHost("web", "www", "frontend")
+	if err := saveHosts(ctx, s, web, newHost("db")); err != nil {
+		return err
+	}
+	found, err := s.FindByName(ctx, "frontend")
+	if err != nil {
+		return err
+	}
+	return checkHost(found, web)
+}
+
+func testFindNotFound(ctx context.Context, s host.Store) error {
+	if err := saveHosts(ctx, s, newHost("web")); err != nil {
+		return err
+	}
+	if _, err := s.FindByName(ctx, "db"); err != gorm.ErrRecordNotFound {
+		return fmt.Errorf("got %v, want %v", err, gorm.ErrRecordNotFound)
+	}
+	return nil
+}
+
+func testSaveDuplicate(ctx context.Context, s host.Store) error {
+	if err := saveHosts(ctx, s, newHost("web", "www")); err != nil {
+		return err
+	}
+	if err := s.Save(ctx, newHost("web")); err == nil {
+		return fmt.Errorf("saved a duplicate name")
+	}
+	if err := s.Save(ctx, newHost("db", "www")); err == nil {
+		return fmt.Errorf("saved a duplicate alias")
+	}
+	hosts, err := s.FindAll(ctx)
+	if err != nil {
+		return err
+	}
+	if len(hosts) != 1 {
+		return fmt.Errorf("got %d hosts after failed saves, want 1", len(hosts))
+	}
+	return nil
+}
+
+func testUniqueNames(ctx context.Context, s host.Store) error {
+	web, db := newHost("web", "www"), newHost("db")
+	if err := saveHosts(ctx, s, web, db); err != nil {
+		return err
+	}
+	if err := s.Save(ctx, newHost("cache", "db")); err == nil {
+		return fmt.Errorf("saved an alias which is the name of another host")
+	}
+	if err := s.Save(ctx, newHost("www")); err == nil {
+		return fmt.Errorf("saved a name which is an alias of another host")
+	}
+	info, err := s.FindByName(ctx, "db")
+	if err != nil {
+		return err
+	}
+	info.Aliases = []host.ServerAlias{{Name: "web"}}
+	if _, err := s.Update(ctx, info); err == nil {
+		return fmt.Errorf("updated an alias to the name of another host")
+	}
+	info.Aliases = nil
+	info.Name = "www"
+	if _, err := s.Update(ctx, info); err == nil {
+		return fmt.Errorf("updated a name to an alias of another host")
+	}
+	found, err := s.FindByName(ctx, "db")
+	if err != nil {
+		return err
+	}
+	if err := checkHost(found, db); err != nil {
+		return err
+	}
+	if _, err := s.DeleteByName(ctx, "db"); err != nil {
+		return err
+	}
+	if _, err := s.FindByName(ctx, "db"); err != gorm.ErrRecordNotFound {
+		return fmt.Errorf("find the deleted host: got %v, want %v", err, gorm.ErrRecordNotFound)
+	}
+	return nil
+}
+
+func testFindAll(ctx context.Context, s host.Store) error {
+	hosts := []*host.ServerInfo{newHost("web", "www"), newHost("db"), newHost("cache")}
+	if err := saveHosts(ctx, s, hosts...); err != nil {
+		return err
+	}
+	found, err := s.FindAll(ctx)
+	if err != nil {
+		return err
+	}
+	if len(found) != len(hosts) {
+		return fmt.Errorf("got %d hosts, want %d", len(found), len(hosts))
+	}
+	for i := range hosts {
+		if err := checkHost(found[i], hosts[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func testUpdate(ctx context.Context, s host.Store) error {
+	web := newHost("web", "www")
+	if err := saveHosts(ctx, s, web, newHost("db")); err != nil {
+		return err
+	}
+	info, err := s.FindByName(ctx, "web")
+	if err != nil {
+		return err
+	}
+	info.Name = "frontend"
+	info.Port = 2022
+	info.Description = "updated"
+	info.Aliases = []host.ServerAlias{{Name: "fe"}}
+	info.Addresses = []host.ServerAddress{{Seq: 0, Address: "10.0.3.1"}}
+	if _, err := s.Update(ctx, info); err != nil {
+		return err
+	}
+	found, err := s.FindByName(ctx, "fe")
+	if err != nil {
+		return err
+	}
+	if err := checkHost(found, info); err != nil {
+		return err
+	}
+	for _, name := range []string{"web", "www"} {
+		if _, err := s.FindByName(ctx, name); err != gorm.ErrRecordNotFound {
+			return fmt.Errorf("find the old name %s: got %v, want %v", name, err, gorm.ErrRecordNotFound)
+		}
+	}
+
+	info.Name = "db"
+	if _, err := s.Update(ctx, info); err == nil {
+		return fmt.Errorf("updated to a duplicate name")
+	}
+	return nil
+}
+
+func testUpdateLastConnection(ctx context.Context, s host.Store) error {
+	web := newHost("web")
+	if err := saveHosts(ctx, s, web); err != nil {
+		return err
+	}
+	if err := s.UpdateLastConnection(ctx, web.ID, "10.0.1.1:2222"); err != nil {
+		return err
+	}
+	found, err := s.FindByName(ctx, "web")
+	if err != nil {
+		return err
+	}
+	if found.LastAddress != "10.0.1.1:2222" || found.LastConnectedAt == nil {
+		return fmt.Errorf("got %q at %v", found.LastAddress, found.LastConnectedAt)
+	}
+	return checkHost(found, web)
+}
+
+func testUpdateKeepsLastConnection(ctx context.Context, s host.Store) error {
+	web := newHost("web")
+	if err := saveHosts(ctx, s, web); err != nil {
+		return err
+	}
+	if err := s.UpdateLastConnection(ctx, web.ID, "10.0.1.1:2222"); err != nil {
+		return err
+	}
+	connected, err := s.FindByName(ctx, "web")
+	if err != nil {
+		return err
+	}
+
+	// the updated host is built without the stored fields like by the update command.
+	update := newHost("web")
+	update.ID = web.ID
+	update.User = "admin"
+	if _, err := s.Update(ctx, update); err != nil {
+		return err
+	}
+	found, err := s.FindByName(ctx, "web")
+	if err != nil {
+		return err
+	}
+	if found.User != "admin" {
+		return fmt.Errorf("got user %q, want admin", found.User)
+	}
+	if !found.CreatedAt.Equal(connected.CreatedAt) {
+		return fmt.Errorf("got created at %v, want %v", found.CreatedAt, connected.CreatedAt)
+	}
+	if found.LastAddress != "10.0.1.1:2222" || found.LastConnectedAt == nil ||
+		!found.LastConnectedAt.Equal(*connected.LastConnectedAt) {
+		return fmt.Errorf("got last connection %q at %v, want %q at %v",
+			found.LastAddress, found.LastConnectedAt, connected.LastAddress, connected.LastConnectedAt)
+	}
+	return nil
+}
+
+func testDeleteByName(ctx context.Context, s host.Store) error {
+	if err := saveHosts(ctx, s, newHost("web", "www"), newHost("db")); err != nil {
+		return err
+	}
+	deleted, err := s.DeleteByName(ctx, "web")
+	if err != nil {
+		return err
+	}
+	if deleted != 1 {
+		return fmt.Errorf("got %d deleted, want 1", deleted)
+	}
+	if deleted, err = s.DeleteByName(ctx, "web"); err != nil || deleted != 0 {
+		return fmt.Errorf("delete again: got %d, %v, want 0, nil", deleted, err)
+	}
+	if _, err := s.FindByName(ctx, "www"); err != gorm.ErrRecordNotFound {
+		return fmt.Errorf("find the alias of the deleted host: got %v, want %v", err, gorm.ErrRecordNotFound)
+	}
+	// the alias is kept by the host in the trash until purged.
+	if err := saveHosts(ctx, s, newHost("frontend", "www")); !errors.Is(err, host.ErrTrashed) {
+		return fmt.Errorf("save the alias of the trashed host: got %v, want %v", err, host.ErrTrashed)
+	}
+	if _, err := s.Purge(ctx, "web"); err != nil {
+		return err
+	}
+	return saveHosts(ctx, s, newHost("frontend", "www"))
+}
+
+func testActiveHost(ctx context.Context, s host.Store) error {
+	if _, err := s.FindActiveServerInfo(ctx); err == nil {
+		return fmt.Errorf("found an active host in the empty store")
+	}
+	web, db := newHost("web", "www"), newHost("db")
+	if err := saveHosts(ctx, s, web, db); err != nil {
+		return err
+	}
+	for _, info := range []*host.ServerInfo{web, db} {
+		if err := s.SaveOrUpdateActiveServerInfo(ctx, info); err != nil {
+			return err
+		}
+		found, err := s.FindActiveServerInfo(ctx)
+		if err != nil {
+			return err
+		}
+		if err := checkHost(found, info); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func testIsolatedValues(ctx context.Context, s host.Store) error {
+	web := newHost("web", "www")
+	if err := saveHosts(ctx, s, web); err != nil {
+		return err
+	}
+	expected := *web
+	expected.Aliases = append([]host.ServerAlias(nil), web.Aliases...)
+	expected.Addresses = append([]host.ServerAddress(nil), web.Addresses...)
+
+	web.Port = 1
+	web.Aliases[0].Name = "changed"
+	found, err := s.FindByName(ctx, "web")
+	if err != nil {
+		return err
+	}
+	found.Address = "changed"
+	found.Addresses[0].Address = "changed"
+	if found, err = s.FindByName(ctx, "web"); err != nil {
+		return err
+	}
+	return checkHost(found, &expected)
+}
+
+func withTags(info *host.ServerInfo, tags ...string) *host.ServerInfo {
+	info.Tags = nil
+	for _, tag := range tags {
+		info.Tags = append(info.Tags, host.ServerTag{Name: tag})
+	}
+	return info
+}
+
+// names returns names of the found hosts.
+func names(page *host.Page) []string {
+	names := make([]string, 0, len(page.Hosts))
+	for _, info := range page.Hosts {
+		names = append(names, info.Name)
+	}
+	return names
+}
+
+func testTags(ctx context.Context, s host.Store) error {
+	web := withTags(newHost("web"), "prod", "frontend")
+	if err := saveHosts(ctx, s, web); err != nil {
+		return err
+	}
+	found, err := s.FindByName(ctx, "web")
+	if err != nil {
+		return err
+	}
+	if tags := found.TagNames(); !reflect.DeepEqual(tags, []string{"frontend", "prod"}) {
+		return fmt.Errorf("got tags %v, want sorted tags", tags)
+	}
+	withTags(found, "staging")
+	if _, err := s.Update(ctx, found); err != nil {
+		return err
+	}
+	updated, err := s.FindByName(ctx, "web")
+	if err != nil {
+		return err
+	}
+	if err := checkHost(updated, found); err != nil {
+		return err
+	}
+	if err := s.Save(ctx, withTags(newHost("db"), "prod", "prod")); err == nil {
+		return fmt.Errorf("saved duplicate tags")
+	}
+	return nil
+}
+
+func testFindByQuery(ctx context.Context, s host.Store) error {
+	web1 := withTags(newHost("web-1"), "prod", "web")
+	web2 := withTags(newHost("web-2"), "staging", "web")
+	db := withTags(newHost("db"), "prod")
+	db.User = "postgres"
+	db.Address = "192.168.0.10"
+	db.Addresses = nil
+	cache := newHost("cache")
+	cache.Address = "cache.local"
+	cache.Addresses = []host.ServerAddress{{Seq: 0, Address: "192.168.1.20"}}
+	if err := saveHosts(ctx, s, web1, web2, db, cache); err != nil {
+		return err
+	}
+	afterSave := time.Now()
+
+	for _, tc := range []struct {
+		name  string
+		query host.Query
+		want  []string
+	}{
+		{"all", host.Query{}, []string{"web-1", "web-2", "db", "cache"}},
+		{"name glob", host.Query{Name: "web-*"}, []string{"web-1", "web-2"}},
+		{"name set", host.Query{Name: "[cd]*"}, []string{"db", "cache"}},
+		{"name single", host.Query{Name: "web-?"}, []string{"web-1", "web-2"}},
+		{"user", host.Query{User: "postgres"}, []string{"db"}},
+		{"tag", host.Query{Tags: []string{"prod"}}, []string{"web-1", "db"}},
+		{"all tags", host.Query{Tags: []string{"prod", "web"}}, []string{"web-1"}},
+		{"cidr", host.Query{CIDR: "192.168.0.0/16"}, []string{"db", "cache"}},
+		{"cidr and tag", host.Query{CIDR: "192.168.0.0/24", Tags: []string{"prod"}}, []string{"db"}},
+		{"created before", host.Query{CreatedBefore: afterSave.Add(-time.Hour)}, []string{}},
+		{"created after", host.Query{CreatedAfter: afterSave.Add(-time.Hour)}, []string{"web-1", "web-2", "db", "cache"}},
+		{"updated after", host.Query{UpdatedAfter: afterSave.Add(time.Hour)}, []string{}},
+	} {
+		page, err := s.Find(ctx, &tc.query)
+		if err != nil {
+			return fmt.Errorf("%s: %v", tc.name, err)
+		}
+		if got := names(page); !reflect.DeepEqual(got, tc.want) {
+			return fmt.Errorf("%s: got %v, want %v", tc.name, got, tc.want)
+		}
+		if page.Total != int64(len(tc.want)) || page.NextCursor != "" {
+			return fmt.Errorf("%s: got total %d and cursor %q", tc.name, page.Total, page.NextCursor)
+		}
+	}
+	if _, err := s.Find(ctx, &host.Query{CIDR: "invalid"}); err == nil {
+		return fmt.Errorf("found hosts by an invalid cidr")
+	}
+	return nil
+}
+
+func testFindSorted(ctx context.Context, s host.Store) error {
+	var hosts []*host.ServerInfo
+	for i, name := range []string{"b", "d", "a", "c"} {
+		info := newHost(name)
+		info.Port = 22 + i%2
+		info.User = []string{"x", "y"}[i/2]
+		hosts = append(hosts, info)
+	}
+	if err := saveHosts(ctx, s, hosts...); err != nil {
+		return err
+	}
+	if err := s.UpdateLastConnection(ctx, hosts[1].ID, "10.0.0.1:22"); err != nil {
+		return err
+	}
+
+	for _, tc := range []struct {
+		query host.Query
+		want  []string
+	}{
+		{host.Query{SortBy: host.SortByName}, []string{"a", "b", "c", "d"}},
+		{host.Query{SortBy: host.SortByName, Desc: true}, []string{"d", "c", "b", "a"}},
+		{host.Query{SortBy: host.SortByPort}, []string{"b", "a", "d", "c"}},
+		{host.Query{SortBy: host.SortByPort, Desc: true}, []string{"c", "d", "a", "b"}},
+		{host.Query{SortBy: host.SortByUser, Desc: true}, []string{"c", "a", "d", "b"}},
+		{host.Query{SortBy: host.SortByID, Desc: true}, []string{"c", "a", "d", "b"}},
+		{host.Query{SortBy: host.SortByLastConnectedAt, Desc: true}, []string{"d", "c", "a", "b"}},
+	} {
+		page, err := s.Find(ctx, &tc.query)
+		if err != nil {
+			return err
+		}
+		if got := names(page); !reflect.DeepEqual(got, tc.want) {
+			return fmt.Errorf("sort by %s(desc: %v): got %v, want %v", tc.query.SortBy, tc.query.Desc, got, tc.want)
+		}
+	}
+	if _, err := s.Find(ctx, &host.Query{SortBy: "unknown"}); err == nil {
+		return fmt.Errorf("sorted by an unknown field")
+	}
+	return nil
+}
+
+func testFindPages(ctx context.Context, s host.Store) error {
+	var all []string
+	for i := 0; i < 7; i++ {
+		info := newHost(fmt.Sprintf("host-%d", i))
+		info.Port = 22 + i%3
+		if err := saveHosts(ctx, s, info); err != nil {
+			return err
+		}
+		all = append(all, info.Name)
+	}
+
+	page, err := s.Find(ctx, &host.Query{SortBy: host.SortByName, Limit: 3, Offset: 5})
+	if err != nil {
+		return err
+	}
+	if got := names(page); !reflect.DeepEqual(got, all[5:]) || page.Total != 7 {
+		return fmt.Errorf("offset: got %v of %d, want %v of 7", got, page.Total, all[5:])
+	}
+
+	// iterates pages sorted by a field with ties by cursors.
+	for _, desc := range []bool{false, true} {
+		var got []string
+		q := host.Query{SortBy: host.SortByPort, Desc: desc, Limit: 2}
+		for i := 0; ; i++ {
+			page, err := s.Find(ctx, &q)
+			if err != nil {
+				return err
+			}
+			if page.Total != 7 {
+				return fmt.Errorf("cursor: got total %d, want 7", page.Total)
+			}
+			got = append(got, names(page)...)
+			if page.NextCursor == "" {
+				break
+			}
+			if i > len(all) {
+				return fmt.Errorf("cursor: too many pages")
+			}
+			q.Cursor = page.NextCursor
+		}
+		sorted := append([]string(nil), got...)
+		sort.Strings(sorted)
+		if !reflect.DeepEqual(sorted, all) {
+			return fmt.Errorf("cursor(desc: %v): got %v, want all hosts once", desc, got)
+		}
+		ordered, err := s.Find(ctx, &host.Query{SortBy: host.SortByPort, Desc: desc})
+		if err != nil {
+			return err
+		}
+		if want := names(ordered); !reflect.DeepEqual(got, want) {
+			return fmt.Errorf("cursor(desc: %v): got %v, want %v", desc, got, want)
+		}
+	}
+
+	if page, err = s.Find(ctx, &host.Query{Limit: 2}); err != nil {
+		return err
+	}
+	if _, err := s.Find(ctx, &host.Query{Cursor: page.NextCursor, Offset: 1}); err == nil {
+		return fmt.Errorf("found hosts by a cursor with an offset")
+	}
+	return nil
+}
+
+func trashNames(ctx context.Context, s host.Store) ([]string, error) {
+	trash, err := s.FindTrash(ctx)
+	if err != nil {
+		return nil, err
+	}
+	got := []string{}
+	for _, info := range trash {
+		if !info.Trashed() {
+			return nil, fmt.Errorf("%s in the trash is not trashed", info.Name)
+		}
+		got = append(got, info.Name)
+	}
+	return got, nil
+}
+
+func testTrash(ctx context.Context, s host.Store) error {
+	web, db := withTags(newHost("web", "www"), "prod"), newHost("db")
+	if err := saveHosts(ctx, s, web, db); err != nil {
+		return err
+	}
+	if err := s.SaveOrUpdateActiveServerInfo(ctx, web); err != nil {
+		return err
+	}
+	for _, name := range []string{"web", "db"} {
+		if _, err := s.DeleteByName(ctx, name); err != nil {
+			return err
+		}
+		// orders hosts by the deleted time.
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got, err := trashNames(ctx, s); err != nil || !reflect.DeepEqual(got, []string{"db", "web"}) {
+		return fmt.Errorf("find trash: got %v, %v, want [db web]", got, err)
+	}
+	if all, err := s.FindAll(ctx); err != nil || len(all) != 0 {
+		return fmt.Errorf("find all: got %d hosts, %v, want no hosts", len(all), err)
+	}
+	if page, err := s.Find(ctx, &host.Query{}); err != nil || page.Total != 0 {
+		return fmt.Errorf("find: got %v, want no hosts", err)
+	}
+	if _, err := s.FindActiveServerInfo(ctx); err != gorm.ErrRecordNotFound {
+		return fmt.Errorf("find the trashed active host: got %v, want %v", err, gorm.ErrRecordNotFound)
+	}
+	if _, err := s.Restore(ctx, "www"); err != gorm.ErrRecordNotFound {
+		return fmt.Errorf("restore by an alias: got %v, want %v", err, gorm.ErrRecordNotFound)
+	}
+
+	restored, err := s.Restore(ctx, "web")
+	if err != nil {
+		return err
+	}
+	if restored.Trashed() {
+		return fmt.Errorf("restored host is trashed")
+	}
+	found, err := s.FindByName(ctx, "www")
+	if err != nil {
+		return err
+	}
+	if err := checkHost(found, web); err != nil {
+		return err
+	}
+	if got, err := trashNames(ctx, s); err != nil || !reflect.DeepEqual(got, []string{"db"}) {
+		return fmt.Errorf("find trash after restore: got %v, %v, want [db]", got, err)
+	}
+	if _, err := s.Restore(ctx, "web"); err != gorm.ErrRecordNotFound {
+		return fmt.Errorf("restore a host not in the trash: got %v, want %v", err, gorm.ErrRecordNotFound)
+	}
+	return nil
+}
+
+func testPurge(ctx context.Context, s host.Store) error {
+	if err := saveHosts(ctx, s, newHost("web", "www"), newHost("db"), newHost("cache")); err != nil {
+		return err
+	}
+	for _, name := range []string{"web", "db"} {
+		if _, err := s.DeleteByName(ctx, name); err != nil {
+			return err
+		}
+	}
+	if purged, err := s.Purge(ctx, "web", "cache"); err != nil || purged != 1 {
+		return fmt.Errorf("purge web and cache: got %d, %v, want 1", purged, err)
+	}
+	if got, err := trashNames(ctx, s); err != nil || !reflect.DeepEqual(got, []string{"db"}) {
+		return fmt.Errorf("find trash: got %v, %v, want [db]", got, err)
+	}
+	if _, err := s.FindRevisions(ctx, "web"); err != gorm.ErrRecordNotFound {
+		return fmt.Errorf("find revisions of the purged host: got %v, want %v", err, gorm.ErrRecordNotFound)
+	}
+	if purged, err := s.Purge(ctx); err != nil || purged != 1 {
+		return fmt.Errorf("purge all: got %d, %v, want 1", purged, err)
+	}
+	if got, err := trashNames(ctx, s); err != nil || len(got) != 0 {
+		return fmt.Errorf("find trash after purge all: got %v, %v, want none", got, err)
+	}
+	if _, err := s.FindByName(ctx, "cache"); err != nil {
+		return fmt.Errorf("find the host not in the trash: %v", err)
+	}
+	return nil
+}
+
+func actions(revisions []*host.Revision) []string {
+	var got []string
+	for _, r := range revisions {
+		got = append(got, fmt.Sprintf("%d:%s", r.Rev, r.Action))
+	}
+	return got
+}
+
+func testRevisions(ctx context.Context, s host.Store) error {
+	ctx = host.WithActor(ctx, "tester")
+	web := newHost("web", "www")
+	if err := saveHosts(ctx, s, web); err != nil {
+		return err
+	}
+	info, err := s.FindByName(ctx, "web")
+	if err != nil {
+		return err
+	}
+	info.Port = 2022
+	info.Password = "changed"
+	if _, err := s.Update(ctx, info); err != nil {
+		return err
+	}
+	// an update without changes is not recorded.
+	if _, err := s.Update(ctx, info); err != nil {
+		return err
+	}
+	if _, err := s.DeleteByName(ctx, "web"); err != nil {
+		return err
+	}
+	if _, err := s.Restore(ctx, "web"); err != nil {
+		return err
+	}
+
+	revisions, err := s.FindRevisions(ctx, "www")
+	if err != nil {
+		return err
+	}
+	want := []string{"1:create", "2:update", "3:delete", "4:restore"}
+	if got := actions(revisions); !reflect.DeepEqual(got, want) {
+		return fmt.Errorf("got revisions %v, want %v", got, want)
+	}
+	for _, r := range revisions {
+		if r.Actor != "tester" || r.CreatedAt.IsZero() || r.ServerInfoID != web.ID {
+			return fmt.Errorf("revision %d: got actor %q at %v of host %d", r.Rev, r.Actor, r.CreatedAt, r.ServerInfoID)
+		}
+	}
+	changes := make(map[string]host.Change)
+	for _, c := range revisions[1].Changes {
+		changes[c.Field] = c
+	}
+	if len(changes) != 2 || changes["port"].Old != "22" || changes["port"].New != "2022" {
+		return fmt.Errorf("got changes %v, want port and password", revisions[1].Changes)
+	}
+	if c := changes["password"]; strings.Contains(c.Old+c.New, "secret") || strings.Contains(c.Old+c.New, "changed") {
+		return fmt.Errorf("password is not masked: %v", c)
+	}
+	for _, r := range revisions {
+		if strings.Contains(r.Snapshot, "secret") || strings.Contains(r.Snapshot, "changed") {
+			return fmt.Errorf("revision %d: password in the snapshot: %s", r.Rev, r.Snapshot)
+		}
+	}
+	if _, err := s.FindRevisions(ctx, "unknown"); err != gorm.ErrRecordNotFound {
+		return fmt.Errorf("find revisions of an unknown host: got %v, want %v", err, gorm.ErrRecordNotFound)
+	}
+	return nil
+}
+
+func testRevert(ctx context.Context, s host.Store) error {
+	web := withTags(newHost("web", "www"), "prod")
+	if err := saveHosts(ctx, s, web); err != nil {
+		return err
+	}
+	info, err := s.FindByName(ctx, "web")
+	if err != nil {
+		return err
+	}
+	info.Name = "frontend"
+	info.Description = "updated"
+	info.Aliases = []host.ServerAlias{{Name: "fe"}}
+	info.Tags = []host.ServerTag{{Name: "staging"}}
+	info.Password = "changed"
+	if _, err := s.Update(ctx, info); err != nil {
+		return err
+	}
+
+	// the password is kept because snapshots do not have it.
+	web.Password = "changed"
+	reverted, err := s.Revert(ctx, "fe", 1)
+	if err != nil {
+		return err
+	}
+	if reverted.ID != web.ID {
+		return fmt.Errorf("reverted host id: got %d, want %d", reverted.ID, web.ID)
+	}
+	found, err := s.FindByName(ctx, "www")
+	if err != nil {
+		return err
+	}
+	if err := checkHost(found, web); err != nil {
+		return err
+	}
+	revisions, err := s.FindRevisions(ctx, "web")
+	if err != nil {
+		return err
+	}
+	if got, want := actions(revisions), []string{"1:create", "2:update", "3:revert"}; !reflect.DeepEqual(got, want) {
+		return fmt.Errorf("got revisions %v, want %v", got, want)
+	}
+	if _, err := s.Revert(ctx, "web", 9); !errors.Is(err, host.ErrRevisionNotFound) {
+		return fmt.Errorf("revert to an unknown revision: got %v, want %v", err, host.ErrRevisionNotFound)
+	}
+	return nil
+}
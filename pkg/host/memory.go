@@ -0,0 +1,397 @@
+package host
+
+import (
+	"context"
+	"fmt"
+	"gorm.io/gorm"
+	"sort"
+	"sync"
+	"time"
+)
+
+// NewMemoryStore creates a new Store which keeps hosts in memory.
+// Hosts not found are reported as gorm.ErrRecordNotFound like the Store of the database.
+func NewMemoryStore() Store {
+	return newMemoryStore()
+}
+
+type memoryStore struct {
+	mu sync.RWMutex
+	// hosts include hosts in the trash.
+	hosts     map[uint]*ServerInfo
+	revisions map[uint][]*Revision
+	lastID    uint
+	activeID  uint
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{
+		hosts:     make(map[uint]*ServerInfo),
+		revisions: make(map[uint][]*Revision),
+	}
+}
+
+func (ms *memoryStore) Save(ctx context.Context, info *ServerInfo) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if err := ms.insert(info); err != nil {
+		return err
+	}
+	ms.record(ctx, ActionCreate, nil, info)
+	return nil
+}
+
+// FindByName finds a ServerInfo that has the given hostname as a name or an alias.
+func (ms *memoryStore) FindByName(ctx context.Context, hostname string) (*ServerInfo, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	info := ms.findByName(hostname, false)
+	if info == nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return copyServerInfo(info), nil
+}
+
+func (ms *memoryStore) FindAll(ctx context.Context) ([]*ServerInfo, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	servers := make([]*ServerInfo, 0, len(ms.hosts))
+	for _, info := range ms.sorted(false) {
+		servers = append(servers, copyServerInfo(info))
+	}
+	return servers, nil
+}
+
+func (ms *memoryStore) Find(ctx context.Context, q *Query) (*Page, error) {
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	var matched []*ServerInfo
+	for _, info := range ms.sorted(false) {
+		if q.match(info) {
+			matched = append(matched, copyServerInfo(info))
+		}
+	}
+	return q.paginate(matched)
+}
+
+// Update updates the given ServerInfo and replaces its aliases and addresses. The creation time and the
+// last connection of the host are kept.
+func (ms *memoryStore) Update(ctx context.Context, info *ServerInfo) (int64, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	return ms.update(ctx, info, ActionUpdate)
+}
+
+func (ms *memoryStore) update(ctx context.Context, info *ServerInfo, action string) (int64, error) {
+	if err := ms.checkUnique(info); err != nil {
+		return 0, err
+	}
+	before, ok := ms.hosts[info.ID]
+	if ok {
+		if before.Trashed() {
+			return 0, fmt.Errorf("%s is %w", before.Name, ErrTrashed)
+		}
+		before = copyServerInfo(before)
+		keepStoredFields(info, before)
+	}
+	info.UpdatedAt = time.Now()
+	ms.put(info)
+	ms.record(ctx, action, before, info)
+	return 1, nil
+}
+
+// UpdateLastConnection records the given address as the last connected address of the host at now.
+func (ms *memoryStore) UpdateLastConnection(ctx context.Context, id uint, address string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	info, ok := ms.hosts[id]
+	if !ok || info.Trashed() {
+		return nil
+	}
+	now := time.Now()
+	info.LastAddress = address
+	info.LastConnectedAt = &now
+	return nil
+}
+
+// DeleteByName moves the host of the given name to the trash.
+func (ms *memoryStore) DeleteByName(ctx context.Context, hostname string) (int64, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	for _, info := range ms.sorted(false) {
+		if info.Name == hostname {
+			info.DeletedAt = gorm.DeletedAt{Time: time.Now(), Valid: true}
+			ms.record(ctx, ActionDelete, info, info)
+			return 1, nil
+		}
+	}
+	return 0, nil
+}
+
+func (ms *memoryStore) FindTrash(ctx context.Context) ([]*ServerInfo, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	servers := []*ServerInfo{}
+	for _, info := range ms.sorted(true) {
+		servers = append(servers, copyServerInfo(info))
+	}
+	sort.SliceStable(servers, func(i, j int) bool {
+		return servers[i].DeletedAt.Time.After(servers[j].DeletedAt.Time)
+	})
+	return servers, nil
+}
+
+func (ms *memoryStore) Restore(ctx context.Context, hostname string) (*ServerInfo, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	for _, info := range ms.sorted(true) {
+		if info.Name != hostname {
+			continue
+		}
+		restored := copyServerInfo(info)
+		restored.DeletedAt = gorm.DeletedAt{}
+		if err := ms.checkUnique(restored); err != nil {
+			return nil, err
+		}
+		info.DeletedAt = gorm.DeletedAt{}
+		ms.record(ctx, ActionRestore, info, info)
+		return restored, nil
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (ms *memoryStore) Purge(ctx context.Context, hostnames ...string) (int64, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	names := make(map[string]bool)
+	for _, name := range hostnames {
+		names[name] = true
+	}
+	var purged int64
+	for _, info := range ms.sorted(true) {
+		if len(names) == 0 || names[info.Name] {
+			delete(ms.hosts, info.ID)
+			delete(ms.revisions, info.ID)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+func (ms *memoryStore) FindRevisions(ctx context.Context, hostname string) ([]*Revision, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	info := ms.findByName(hostname, true)
+	if info == nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+	revisions := make([]*Revision, 0, len(ms.revisions[info.ID]))
+	for _, r := range ms.revisions[info.ID] {
+		c := *r
+		c.Changes = append(Changes{}, r.Changes...)
+		revisions = append(revisions, &c)
+	}
+	return revisions, nil
+}
+
+func (ms *memoryStore) Revert(ctx context.Context, hostname string, rev int) (*ServerInfo, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	current := ms.findByName(hostname, false)
+	if current == nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+	for _, r := range ms.revisions[current.ID] {
+		if r.Rev != rev {
+			continue
+		}
+		info, err := revertedServerInfo(current, r)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := ms.update(ctx, info, ActionRevert); err != nil {
+			return nil, err
+		}
+		return copyServerInfo(info), nil
+	}
+	return nil, fmt.Errorf("%w: %d", ErrRevisionNotFound, rev)
+}
+
+func (ms *memoryStore) SaveOrUpdateActiveServerInfo(ctx context.Context, info *ServerInfo) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	ms.activeID = info.ID
+	return nil
+}
+
+func (ms *memoryStore) FindActiveServerInfo(ctx context.Context) (*ServerInfo, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	info, ok := ms.hosts[ms.activeID]
+	if !ok || info.Trashed() {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return copyServerInfo(info), nil
+}
+
+// insert stores a new host without recording a revision.
+func (ms *memoryStore) insert(info *ServerInfo) error {
+	if info.ID != 0 {
+		if _, ok := ms.hosts[info.ID]; ok {
+			return fmt.Errorf("duplicate host id: %d", info.ID)
+		}
+	}
+	if err := ms.checkUnique(info); err != nil {
+		return err
+	}
+	now := time.Now()
+	if info.CreatedAt.IsZero() {
+		info.CreatedAt = now
+	}
+	if info.UpdatedAt.IsZero() {
+		info.UpdatedAt = now
+	}
+	ms.put(info)
+	return nil
+}
+
+// findByName returns the host that has the given hostname as a name or an alias.
+// Hosts in the trash are also found if trashed is true.
+func (ms *memoryStore) findByName(hostname string, trashed bool) *ServerInfo {
+	hosts := ms.sorted(false)
+	if trashed {
+		hosts = append(hosts, ms.sorted(true)...)
+	}
+	for _, info := range hosts {
+		if info.Name == hostname {
+			return info
+		}
+	}
+	for _, info := range hosts {
+		for _, alias := range info.Aliases {
+			if alias.Name == hostname {
+				return info
+			}
+		}
+	}
+	return nil
+}
+
+// record appends the revisions of the change of a host from before to after.
+func (ms *memoryStore) record(ctx context.Context, action string, before, after *ServerInfo) {
+	revisions := ms.revisions[after.ID]
+	last := 0
+	if len(revisions) != 0 {
+		last = revisions[len(revisions)-1].Rev
+	}
+	for _, r := range newRevisions(ctx, action, before, after, last) {
+		r.ID = uint(len(revisions) + 1)
+		revisions = append(revisions, r)
+	}
+	ms.revisions[after.ID] = revisions
+}
+
+// put stores a copy of the given ServerInfo and assigns ids to it and its associations.
+func (ms *memoryStore) put(info *ServerInfo) {
+	if info.ID == 0 {
+		ms.lastID++
+		info.ID = ms.lastID
+	} else if info.ID > ms.lastID {
+		ms.lastID = info.ID
+	}
+	for i := range info.Aliases {
+		info.Aliases[i].ID = uint(i + 1)
+		info.Aliases[i].ServerInfoID = info.ID
+	}
+	for i := range info.Addresses {
+		info.Addresses[i].ID = uint(i + 1)
+		info.Addresses[i].ServerInfoID = info.ID
+	}
+	for i := range info.Tags {
+		info.Tags[i].ID = uint(i + 1)
+		info.Tags[i].ServerInfoID = info.ID
+	}
+	ms.hosts[info.ID] = copyServerInfo(info)
+}
+
+// checkUnique returns an error if the name or aliases of the given ServerInfo are used by other hosts
+// as names or aliases, or it has duplicate aliases or tags. Names and aliases of hosts in the trash
+// are kept until purged.
+func (ms *memoryStore) checkUnique(info *ServerInfo) error {
+	aliases := make(map[string]bool)
+	for _, alias := range info.Aliases {
+		if aliases[alias.Name] {
+			return fmt.Errorf("duplicate alias: %s", alias.Name)
+		}
+		aliases[alias.Name] = true
+	}
+	tags := make(map[string]bool)
+	for _, tag := range info.Tags {
+		if tags[tag.Name] {
+			return fmt.Errorf("duplicate tag: %s", tag.Name)
+		}
+		tags[tag.Name] = true
+	}
+	names := map[string]bool{info.Name: true}
+	for name := range aliases {
+		names[name] = true
+	}
+	// finds hosts not in the trash first to report them rather than trashed ones.
+	for _, other := range append(ms.sorted(false), ms.sorted(true)...) {
+		if other.ID == info.ID {
+			continue
+		}
+		duplicate := ""
+		if names[other.Name] {
+			duplicate = other.Name
+		}
+		for _, alias := range other.Aliases {
+			if duplicate == "" && names[alias.Name] {
+				duplicate = alias.Name
+			}
+		}
+		if duplicate == "" {
+			continue
+		}
+		if other.Trashed() {
+			return fmt.Errorf("duplicate host name or alias: %s is %w(%s)", duplicate, ErrTrashed, other.Name)
+		}
+		return fmt.Errorf("duplicate host name or alias: %s is used by %s", duplicate, other.Name)
+	}
+	return nil
+}
+
+// sorted returns the hosts in the trash if trashed is true or the other hosts in the order of id.
+func (ms *memoryStore) sorted(trashed bool) []*ServerInfo {
+	servers := make([]*ServerInfo, 0, len(ms.hosts))
+	for _, info := range ms.hosts {
+		if info.Trashed() == trashed {
+			servers = append(servers, info)
+		}
+	}
+	sort.Slice(servers, func(i, j int) bool {
+		return servers[i].ID < servers[j].ID
+	})
+	return servers
+}
+
+func copyServerInfo(info *ServerInfo) *ServerInfo {
+	c := *info
+	if info.LastConnectedAt != nil {
+		t := *info.LastConnectedAt
+		c.LastConnectedAt = &t
+	}
+	c.Aliases = append([]ServerAlias(nil), info.Aliases...)
+	c.Addresses = append([]ServerAddress(nil), info.Addresses...)
+	sort.SliceStable(c.Addresses, func(i, j int) bool {
+		return c.Addresses[i].Seq < c.Addresses[j].Seq
+	})
+	c.Tags = append([]ServerTag(nil), info.Tags...)
+	sort.SliceStable(c.Tags, func(i, j int) bool {
+		return c.Tags[i].Name < c.Tags[j].Name
+	})
+	return &c
+}
@@ -0,0 +1,15 @@
+package host_test
+
+import (
+	"github.com/zacscoding/zssh/pkg/host"
+	"github.com/zacscoding/zssh/pkg/host/hosttest"
+	"testing"
+)
+
+func TestMemoryStore(t *testing.T) {
+	if err := hosttest.TestStore(func() (host.Store, error) {
+		return host.NewMemoryStore(), nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -3,6 +3,9 @@ package host
 import (
 	"encoding/json"
 	"fmt"
+	"gorm.io/gorm"
+	"net"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -10,20 +13,38 @@ import (
 const (
 	TableNameServerInfo       = "hosts"
 	TableNameActiveServerInfo = "active_host"
+	TableNameServerAlias      = "host_aliases"
+	TableNameServerAddress    = "host_addresses"
+	TableNameServerTag        = "host_tags"
+	TableNameRevision         = "host_revisions"
 )
 
 type ServerInfo struct {
-	ID          uint   `json:"id" gorm:"column:id;primarykey"`
-	Name        string `json:"name" gorm:"column:name;unique"`
-	User        string `json:"user" gorm:"column:user_name"`
-	Address     string `json:"address" gorm:"column:address"`
-	Port        int    `json:"port" gorm:"column:port"`
-	Password    string `json:"password" gorm:"column:password"`
-	KeyPath     string `json:"keypath" gorm:"column:keypath"`
+	ID       uint   `json:"id" gorm:"column:id;primarykey"`
+	Name     string `json:"name" gorm:"column:name;unique"`
+	User     string `json:"user" gorm:"column:user_name"`
+	Address  string `json:"address" gorm:"column:address"`
+	Port     int    `json:"port" gorm:"column:port"`
+	Password string `json:"password" gorm:"column:password"`
+	KeyPath  string `json:"keypath" gorm:"column:keypath"`
+	// KeyName is the name of a managed key in the workspace, which is used instead of KeyPath.
+	KeyName string `json:"keyName" gorm:"column:key_name"`
+	// CertPath is the path of the OpenSSH user certificate of the key.
+	// "{KeyPath}-cert.pub" is used if it is empty and exists.
+	CertPath    string `json:"certPath" gorm:"column:cert_path"`
 	Description string `json:"description" gorm:"column:description"`
+	LastAddress string `json:"lastAddress" gorm:"column:last_address"`
+	// LastConnectedAt is the time of the last successful connection to this host.
+	LastConnectedAt *time.Time `json:"lastConnectedAt" gorm:"column:last_connected_at"`
+
+	Aliases   []ServerAlias   `json:"aliases" gorm:"foreignKey:ServerInfoID"`
+	Addresses []ServerAddress `json:"addresses" gorm:"foreignKey:ServerInfoID"`
+	Tags      []ServerTag     `json:"tags" gorm:"foreignKey:ServerInfoID"`
 
 	CreatedAt time.Time `json:"createdAt" gorm:"column:created_at"`
 	UpdatedAt time.Time `json:"updatedAt" gorm:"column:updated_at"`
+	// DeletedAt is set if the host is in the trash.
+	DeletedAt gorm.DeletedAt `json:"-" gorm:"column:deleted_at;index"`
 }
 
 func (info ServerInfo) TableName() string {
@@ -32,39 +53,118 @@ func (info ServerInfo) TableName() string {
 
 // HasCredentials returns a true if ServerInfo has password or key path in this host, otherwise false.
 func (info *ServerInfo) HasCredentials() bool {
-	if info.Password == "" && info.KeyPath == "" {
+	if info.Password == "" && info.KeyPath == "" && info.KeyName == "" {
 		return false
 	}
 	return true
 }
 
+// Trashed returns true if this host is in the trash.
+func (info *ServerInfo) Trashed() bool {
+	return info.DeletedAt.Valid
+}
+
+// AliasNames returns names of the aliases in this host.
+func (info *ServerInfo) AliasNames() []string {
+	names := make([]string, 0, len(info.Aliases))
+	for _, alias := range info.Aliases {
+		names = append(names, alias.Name)
+	}
+	return names
+}
+
+// TagNames returns names of the tags in this host.
+func (info *ServerInfo) TagNames() []string {
+	names := make([]string, 0, len(info.Tags))
+	for _, tag := range info.Tags {
+		names = append(names, tag.Name)
+	}
+	return names
+}
+
+// HasTags returns true if this host has all the given tags.
+func (info *ServerInfo) HasTags(tags ...string) bool {
+	for _, tag := range tags {
+		found := false
+		for _, t := range info.Tags {
+			if t.Name == tag {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// Endpoints returns "address:port" of this host to dial in order.
+// The primary address comes first and the alternate addresses follow it.
+func (info *ServerInfo) Endpoints() []string {
+	endpoints := []string{net.JoinHostPort(info.Address, strconv.Itoa(info.Port))}
+	for _, addr := range info.Addresses {
+		port := addr.Port
+		if port == 0 {
+			port = info.Port
+		}
+		endpoints = append(endpoints, net.JoinHostPort(addr.Address, strconv.Itoa(port)))
+	}
+	return endpoints
+}
+
+// keepStoredFields copies the fields which are not changed by updates from the stored host.
+func keepStoredFields(info, stored *ServerInfo) {
+	info.CreatedAt = stored.CreatedAt
+	info.LastAddress = stored.LastAddress
+	info.LastConnectedAt = stored.LastConnectedAt
+}
+
 func (info *ServerInfo) String() string {
 	return fmt.Sprintf("%s (%s:%d)", info.Name, info.Address, info.Port)
 }
 
 func (info *ServerInfo) MarshalJSON() ([]byte, error) {
 	v := struct {
-		ID          uint      `json:"id"`
-		Name        string    `json:"name"`
-		User        string    `json:"user"`
-		Address     string    `json:"address"`
-		Port        int       `json:"port"`
-		Password    string    `json:"password"`
-		KeyPath     string    `json:"keypath"`
-		Description string    `json:"description"`
-		CreatedAt   time.Time `json:"createdAt"`
-		UpdatedAt   time.Time `json:"updatedAt"`
+		ID              uint       `json:"id"`
+		Name            string     `json:"name"`
+		User            string     `json:"user"`
+		Address         string     `json:"address"`
+		Port            int        `json:"port"`
+		Password        string     `json:"password"`
+		KeyPath         string     `json:"keypath"`
+		KeyName         string     `json:"keyName"`
+		CertPath        string     `json:"certPath"`
+		Description     string     `json:"description"`
+		Aliases         []string   `json:"aliases"`
+		Addresses       []string   `json:"addresses"`
+		Tags            []string   `json:"tags"`
+		LastAddress     string     `json:"lastAddress"`
+		LastConnectedAt *time.Time `json:"lastConnectedAt"`
+		CreatedAt       time.Time  `json:"createdAt"`
+		UpdatedAt       time.Time  `json:"updatedAt"`
+		DeletedAt       *time.Time `json:"deletedAt,omitempty"`
 	}{
-		ID:          info.ID,
-		Name:        info.Name,
-		User:        info.User,
-		Address:     info.Address,
-		Port:        info.Port,
-		Password:    strings.Repeat("*", len(info.Password)),
-		KeyPath:     info.KeyPath,
-		Description: info.Description,
-		CreatedAt:   info.CreatedAt,
-		UpdatedAt:   info.UpdatedAt,
+		ID:              info.ID,
+		Name:            info.Name,
+		User:            info.User,
+		Address:         info.Address,
+		Port:            info.Port,
+		Password:        strings.Repeat("*", len(info.Password)),
+		KeyPath:         info.KeyPath,
+		KeyName:         info.KeyName,
+		CertPath:        info.CertPath,
+		Description:     info.Description,
+		Aliases:         info.AliasNames(),
+		Addresses:       info.Endpoints()[1:],
+		Tags:            info.TagNames(),
+		LastAddress:     info.LastAddress,
+		LastConnectedAt: info.LastConnectedAt,
+		CreatedAt:       info.CreatedAt,
+		UpdatedAt:       info.UpdatedAt,
+	}
+	if info.DeletedAt.Valid {
+		v.DeletedAt = &info.DeletedAt.Time
 	}
 	return json.Marshal(v)
 }
@@ -94,3 +194,40 @@ type ActiveServerInfo struct {
 func (info ActiveServerInfo) TableName() string {
 	return TableNameActiveServerInfo
 }
+
+// ServerAlias is an alternate name of a ServerInfo.
+type ServerAlias struct {
+	ID           uint   `gorm:"column:id;primarykey"`
+	ServerInfoID uint   `gorm:"column:server_info_id;index"`
+	Name         string `gorm:"column:name;unique"`
+}
+
+func (alias ServerAlias) TableName() string {
+	return TableNameServerAlias
+}
+
+// ServerAddress is an alternate address of a ServerInfo.
+// Addresses are tried in the order of Seq if the primary address of ServerInfo is unreachable.
+type ServerAddress struct {
+	ID           uint   `gorm:"column:id;primarykey"`
+	ServerInfoID uint   `gorm:"column:server_info_id;index"`
+	Seq          int    `gorm:"column:seq"`
+	Address      string `gorm:"column:address"`
+	// Port is the ssh port of this address. The port of ServerInfo is used if zero.
+	Port int `gorm:"column:port"`
+}
+
+func (addr ServerAddress) TableName() string {
+	return TableNameServerAddress
+}
+
+// ServerTag is a label of a ServerInfo to group and filter hosts.
+type ServerTag struct {
+	ID           uint   `gorm:"column:id;primarykey"`
+	ServerInfoID uint   `gorm:"column:server_info_id;uniqueIndex:idx_host_tags_host_name"`
+	Name         string `gorm:"column:name;uniqueIndex:idx_host_tags_host_name;index"`
+}
+
+func (tag ServerTag) TableName() string {
+	return TableNameServerTag
+}
@@ -0,0 +1,337 @@
+package host
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Fields of hosts to sort by in Query.
+const (
+	SortByID              = "id"
+	SortByName            = "name"
+	SortByUser            = "user"
+	SortByAddress         = "address"
+	SortByPort            = "port"
+	SortByDescription     = "description"
+	SortByCreatedAt       = "createdAt"
+	SortByUpdatedAt       = "updatedAt"
+	SortByLastConnectedAt = "lastConnectedAt"
+)
+
+// sortColumns are the sort expressions of the database by the sort fields.
+var sortColumns = map[string]string{
+	SortByID:              "id",
+	SortByName:            "name",
+	SortByUser:            "user_name",
+	SortByAddress:         "address",
+	SortByPort:            "port",
+	SortByDescription:     "description",
+	SortByCreatedAt:       "created_at",
+	SortByUpdatedAt:       "updated_at",
+	SortByLastConnectedAt: "COALESCE(last_connected_at, '')",
+}
+
+// timeKeyLayout is the layout of times stored in the sqlite database, which is also used to compare times
+// in sort keys, so that all stores order hosts in the same way.
+const timeKeyLayout = "2006-01-02 15:04:05.999999999-07:00"
+
+// SortFields returns the fields to sort hosts by.
+func SortFields() []string {
+	fields := make([]string, 0, len(sortColumns))
+	for field := range sortColumns {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// Query is the conditions, the order and the range of hosts to find. Zero values are ignored.
+type Query struct {
+	// Name is a glob pattern of host names. "*" matches any characters, "?" matches a character and
+	// "[...]" matches a character in the set.
+	Name string
+	// CIDR matches hosts which have the primary or an alternate IP address in the network.
+	CIDR string
+	User string
+	// Tags matches hosts which have all the tags.
+	Tags []string
+	// After bounds are inclusive and Before bounds are exclusive.
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	UpdatedAfter  time.Time
+	UpdatedBefore time.Time
+
+	// SortBy is one of SortFields. Hosts are sorted by id if empty and ties are ordered by id.
+	SortBy string
+	Desc   bool
+
+	Limit  int
+	Offset int
+	// Cursor is the Page.NextCursor of the previous page. It cannot be used with Offset.
+	Cursor string
+}
+
+// Page is hosts found by a Query.
+type Page struct {
+	Hosts []*ServerInfo
+	// Total is the number of hosts matched by the conditions regardless of the range.
+	Total int64
+	// NextCursor is the cursor of the next page. It is empty if there are no more hosts.
+	NextCursor string
+}
+
+// cursor is the position after the last host of a page.
+type cursor struct {
+	SortBy string      `json:"s"`
+	Desc   bool        `json:"d,omitempty"`
+	Key    interface{} `json:"k"`
+	ID     uint        `json:"i"`
+}
+
+// Validate returns an error if the Query has invalid values.
+func (q *Query) Validate() error {
+	if q.CIDR != "" {
+		if _, _, err := net.ParseCIDR(q.CIDR); err != nil {
+			return fmt.Errorf("invalid cidr: %s", q.CIDR)
+		}
+	}
+	if q.Name != "" {
+		if _, err := globRegexp(q.Name); err != nil {
+			return fmt.Errorf("invalid name pattern: %s", q.Name)
+		}
+	}
+	if _, ok := sortColumns[q.sortBy()]; !ok {
+		return fmt.Errorf("invalid sort field: %s (one of %s)", q.SortBy, strings.Join(SortFields(), ", "))
+	}
+	if q.Limit < 0 || q.Offset < 0 {
+		return fmt.Errorf("invalid limit or offset: %d, %d", q.Limit, q.Offset)
+	}
+	if q.Cursor != "" {
+		if q.Offset != 0 {
+			return fmt.Errorf("cursor cannot be used with offset")
+		}
+		if _, err := q.decodeCursor(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (q *Query) sortBy() string {
+	if q.SortBy == "" {
+		return SortByID
+	}
+	return q.SortBy
+}
+
+// tags returns the distinct tags of the Query.
+func (q *Query) tags() []string {
+	var tags []string
+	seen := make(map[string]bool)
+	for _, tag := range q.Tags {
+		if !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// match returns true if the given host satisfies the conditions of the Query.
+func (q *Query) match(info *ServerInfo) bool {
+	if q.Name != "" {
+		if re, err := globRegexp(q.Name); err != nil || !re.MatchString(info.Name) {
+			return false
+		}
+	}
+	if q.User != "" && info.User != q.User {
+		return false
+	}
+	if !info.HasTags(q.Tags...) {
+		return false
+	}
+	if !inRange(info.CreatedAt, q.CreatedAfter, q.CreatedBefore) || !inRange(info.UpdatedAt, q.UpdatedAfter, q.UpdatedBefore) {
+		return false
+	}
+	return q.matchCIDR(info)
+}
+
+func (q *Query) matchCIDR(info *ServerInfo) bool {
+	if q.CIDR == "" {
+		return true
+	}
+	_, network, err := net.ParseCIDR(q.CIDR)
+	if err != nil {
+		return false
+	}
+	addresses := []string{info.Address}
+	for _, addr := range info.Addresses {
+		addresses = append(addresses, addr.Address)
+	}
+	for _, addr := range addresses {
+		if ip := net.ParseIP(addr); ip != nil && network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// less returns true if a is ordered before b.
+func (q *Query) less(a, b *ServerInfo) bool {
+	return q.before(sortKey(a, q.sortBy()), a.ID, sortKey(b, q.sortBy()), b.ID)
+}
+
+// before returns true if the host of the key and the id is ordered before the other.
+func (q *Query) before(key interface{}, id uint, otherKey interface{}, otherID uint) bool {
+	c := compareKeys(key, otherKey)
+	if c == 0 {
+		c = compareKeys(int64(id), int64(otherID))
+	}
+	if q.Desc {
+		return c > 0
+	}
+	return c < 0
+}
+
+// paginate sorts the given hosts matched by the Query and returns the page of them.
+func (q *Query) paginate(hosts []*ServerInfo) (*Page, error) {
+	sort.SliceStable(hosts, func(i, j int) bool {
+		return q.less(hosts[i], hosts[j])
+	})
+	page := Page{Hosts: []*ServerInfo{}, Total: int64(len(hosts))}
+	if q.Cursor != "" {
+		c, err := q.decodeCursor()
+		if err != nil {
+			return nil, err
+		}
+		i := sort.Search(len(hosts), func(i int) bool {
+			return q.before(c.Key, c.ID, sortKey(hosts[i], q.sortBy()), hosts[i].ID)
+		})
+		hosts = hosts[i:]
+	} else if q.Offset < len(hosts) {
+		hosts = hosts[q.Offset:]
+	} else {
+		hosts = nil
+	}
+	if q.Limit > 0 && len(hosts) > q.Limit {
+		hosts = hosts[:q.Limit]
+		page.NextCursor = q.encodeCursor(hosts[len(hosts)-1])
+	}
+	page.Hosts = append(page.Hosts, hosts...)
+	return &page, nil
+}
+
+func (q *Query) encodeCursor(last *ServerInfo) string {
+	b, _ := json.Marshal(&cursor{SortBy: q.sortBy(), Desc: q.Desc, Key: sortKey(last, q.sortBy()), ID: last.ID})
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func (q *Query) decodeCursor() (*cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(q.Cursor)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	var c cursor
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	if c.SortBy != q.sortBy() || c.Desc != q.Desc {
+		return nil, fmt.Errorf("cursor of another order: %s", c.SortBy)
+	}
+	// numbers are decoded as float64.
+	if f, ok := c.Key.(float64); ok {
+		c.Key = int64(f)
+	}
+	return &c, nil
+}
+
+// sortKey returns the value of the given field to compare hosts, which is a string or an int64.
+func sortKey(info *ServerInfo, field string) interface{} {
+	switch field {
+	case SortByName:
+		return info.Name
+	case SortByUser:
+		return info.User
+	case SortByAddress:
+		return info.Address
+	case SortByPort:
+		return int64(info.Port)
+	case SortByDescription:
+		return info.Description
+	case SortByCreatedAt:
+		return info.CreatedAt.Format(timeKeyLayout)
+	case SortByUpdatedAt:
+		return info.UpdatedAt.Format(timeKeyLayout)
+	case SortByLastConnectedAt:
+		if info.LastConnectedAt == nil {
+			return ""
+		}
+		return info.LastConnectedAt.Format(timeKeyLayout)
+	default:
+		return int64(info.ID)
+	}
+}
+
+func compareKeys(a, b interface{}) int {
+	switch a := a.(type) {
+	case int64:
+		b, _ := b.(int64)
+		switch {
+		case a < b:
+			return -1
+		case a > b:
+			return 1
+		}
+		return 0
+	case string:
+		b, _ := b.(string)
+		return strings.Compare(a, b)
+	}
+	return 0
+}
+
+func inRange(t, after, before time.Time) bool {
+	if !after.IsZero() && t.Before(after) {
+		return false
+	}
+	if !before.IsZero() && !t.Before(before) {
+		return false
+	}
+	return true
+}
+
+// globRegexp converts the glob pattern to the regexp matching the whole string.
+func globRegexp(pattern string) (*regexp.Regexp, error) {
+	var b strings.Builder
+	b.WriteString("^")
+	runes := []rune(pattern)
+	for i := 0; i < len(runes); i++ {
+		switch c := runes[i]; c {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		case '[':
+			// the first "]" in the set is a member, e.g. "[]a]".
+			end := i + 2
+			for end < len(runes) && runes[end] != ']' {
+				end++
+			}
+			if end >= len(runes) {
+				return nil, fmt.Errorf("unclosed [ in %s", pattern)
+			}
+			b.WriteString("[" + strings.ReplaceAll(string(runes[i+1:end]), `\`, `\\`) + "]")
+			i = end
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
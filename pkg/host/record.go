@@ -0,0 +1,96 @@
+package host
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+// hostRecord is a host with its associations flattened, which is written to files and revisions.
+type hostRecord struct {
+	// ID is assigned when the file is loaded if it is zero.
+	ID              uint             `json:"id,omitempty" toml:"id,omitzero"`
+	Name            string           `json:"name" toml:"name"`
+	User            string           `json:"user" toml:"user"`
+	Address         string           `json:"address" toml:"address"`
+	Port            int              `json:"port" toml:"port"`
+	Password        string           `json:"password,omitempty" toml:"password,omitempty"`
+	KeyPath         string           `json:"keypath,omitempty" toml:"keypath,omitempty"`
+	KeyName         string           `json:"keyName,omitempty" toml:"keyName,omitempty"`
+	CertPath        string           `json:"certPath,omitempty" toml:"certPath,omitempty"`
+	Description     string           `json:"description,omitempty" toml:"description,omitempty"`
+	Aliases         []string         `json:"aliases,omitempty" toml:"aliases,omitempty"`
+	Addresses       []*recordAddress `json:"addresses,omitempty" toml:"addresses,omitempty"`
+	Tags            []string         `json:"tags,omitempty" toml:"tags,omitempty"`
+	LastAddress     string           `json:"lastAddress,omitempty" toml:"lastAddress,omitempty"`
+	LastConnectedAt *time.Time       `json:"lastConnectedAt,omitempty" toml:"lastConnectedAt,omitempty"`
+	CreatedAt       time.Time        `json:"createdAt" toml:"createdAt"`
+	UpdatedAt       time.Time        `json:"updatedAt" toml:"updatedAt"`
+	// DeletedAt is the time when the host is moved to the trash.
+	DeletedAt *time.Time `json:"deletedAt,omitempty" toml:"deletedAt,omitempty"`
+}
+
+type recordAddress struct {
+	Address string `json:"address" toml:"address"`
+	Port    int    `json:"port,omitempty" toml:"port,omitzero"`
+}
+
+func newHostRecord(info *ServerInfo) *hostRecord {
+	h := &hostRecord{
+		ID:              info.ID,
+		Name:            info.Name,
+		User:            info.User,
+		Address:         info.Address,
+		Port:            info.Port,
+		Password:        info.Password,
+		KeyPath:         info.KeyPath,
+		KeyName:         info.KeyName,
+		CertPath:        info.CertPath,
+		Description:     info.Description,
+		Aliases:         info.AliasNames(),
+		Tags:            info.TagNames(),
+		LastAddress:     info.LastAddress,
+		LastConnectedAt: info.LastConnectedAt,
+		CreatedAt:       info.CreatedAt,
+		UpdatedAt:       info.UpdatedAt,
+	}
+	if info.DeletedAt.Valid {
+		t := info.DeletedAt.Time
+		h.DeletedAt = &t
+	}
+	for _, addr := range info.Addresses {
+		h.Addresses = append(h.Addresses, &recordAddress{Address: addr.Address, Port: addr.Port})
+	}
+	return h
+}
+
+func (h *hostRecord) toServerInfo() *ServerInfo {
+	info := &ServerInfo{
+		ID:              h.ID,
+		Name:            h.Name,
+		User:            h.User,
+		Address:         h.Address,
+		Port:            h.Port,
+		Password:        h.Password,
+		KeyPath:         h.KeyPath,
+		KeyName:         h.KeyName,
+		CertPath:        h.CertPath,
+		Description:     h.Description,
+		LastAddress:     h.LastAddress,
+		LastConnectedAt: h.LastConnectedAt,
+		CreatedAt:       h.CreatedAt,
+		UpdatedAt:       h.UpdatedAt,
+	}
+	if h.DeletedAt != nil {
+		info.DeletedAt = gorm.DeletedAt{Time: *h.DeletedAt, Valid: true}
+	}
+	for _, name := range h.Aliases {
+		info.Aliases = append(info.Aliases, ServerAlias{Name: name})
+	}
+	for i, addr := range h.Addresses {
+		info.Addresses = append(info.Addresses, ServerAddress{Seq: i, Address: addr.Address, Port: addr.Port})
+	}
+	for _, name := range h.Tags {
+		info.Tags = append(info.Tags, ServerTag{Name: name})
+	}
+	return info
+}
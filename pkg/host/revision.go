@@ -0,0 +1,238 @@
+package host
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Actions of revisions.
+const (
+	// ActionBaseline records a host which existed before its revisions were recorded.
+	ActionBaseline = "baseline"
+	ActionCreate   = "create"
+	ActionUpdate   = "update"
+	ActionDelete   = "delete"
+	ActionRestore  = "restore"
+	ActionRevert   = "revert"
+)
+
+var (
+	// ErrTrashed is returned if the name or an alias of a host is used by a host in the trash.
+	ErrTrashed = errors.New("used by a host in the trash")
+	// ErrRevisionNotFound is returned if a host does not have the revision.
+	ErrRevisionNotFound = errors.New("revision not found")
+)
+
+// Revision is a change of a ServerInfo. Rev starts from 1 for each host.
+type Revision struct {
+	ID           uint      `json:"-" gorm:"column:id;primarykey"`
+	ServerInfoID uint      `json:"hostId" gorm:"column:server_info_id;index"`
+	Rev          int       `json:"rev" gorm:"column:rev"`
+	Action       string    `json:"action" gorm:"column:action"`
+	Actor        string    `json:"actor" gorm:"column:actor"`
+	Changes      Changes   `json:"changes" gorm:"column:changes"`
+	CreatedAt    time.Time `json:"createdAt" gorm:"column:created_at"`
+	// Snapshot is the json of the host after the change without the password.
+	Snapshot string `json:"-" gorm:"column:snapshot"`
+}
+
+func (r Revision) TableName() string {
+	return TableNameRevision
+}
+
+// ServerInfo returns the ServerInfo in the snapshot of the Revision.
+func (r *Revision) ServerInfo() (*ServerInfo, error) {
+	var h hostRecord
+	if err := json.Unmarshal([]byte(r.Snapshot), &h); err != nil {
+		return nil, fmt.Errorf("invalid snapshot of the revision %d: %v", r.Rev, err)
+	}
+	info := h.toServerInfo()
+	info.DeletedAt.Valid = false
+	return info, nil
+}
+
+// Change is a changed field of a host. Passwords are masked.
+type Change struct {
+	Field string `json:"field" toml:"field"`
+	Old   string `json:"old" toml:"old"`
+	New   string `json:"new" toml:"new"`
+}
+
+// Changes are stored as a json text in the database.
+type Changes []Change
+
+func (c Changes) Value() (driver.Value, error) {
+	if c == nil {
+		c = Changes{}
+	}
+	b, err := json.Marshal(c)
+	return string(b), err
+}
+
+func (c *Changes) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case string:
+		return json.Unmarshal([]byte(v), c)
+	case []byte:
+		return json.Unmarshal(v, c)
+	case nil:
+		*c = nil
+		return nil
+	}
+	return fmt.Errorf("invalid changes: %T", value)
+}
+
+func (c Changes) String() string {
+	parts := make([]string, 0, len(c))
+	for _, change := range c {
+		parts = append(parts, fmt.Sprintf("%s: %q -> %q", change.Field, change.Old, change.New))
+	}
+	return strings.Join(parts, ", ")
+}
+
+type actorKey struct{}
+
+// WithActor returns a context with the actor recorded in revisions of changes made with the context.
+// The current user of the operating system is recorded if the context does not have an actor.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+func actorFrom(ctx context.Context) string {
+	if actor, ok := ctx.Value(actorKey{}).(string); ok && actor != "" {
+		return actor
+	}
+	name := "unknown"
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+	if hostname, err := os.Hostname(); err == nil {
+		name += "@" + hostname
+	}
+	return name
+}
+
+// newRevisions returns revisions to record the change of a host from before to after, which is nil if the
+// host is created. last is the last Rev of the host. A baseline revision of the host before the change comes
+// first if the host does not have revisions yet. It returns nothing if an update does not change fields.
+func newRevisions(ctx context.Context, action string, before, after *ServerInfo, last int) []*Revision {
+	r := newRevision(action, before, after)
+	if action == ActionUpdate && len(r.Changes) == 0 {
+		return nil
+	}
+	r.Actor = actorFrom(ctx)
+	var revisions []*Revision
+	if last == 0 && before != nil {
+		baseline := newRevision(ActionBaseline, nil, before)
+		baseline.CreatedAt = before.UpdatedAt
+		baseline.Rev = 1
+		revisions = append(revisions, baseline)
+		last = 1
+	}
+	r.Rev = last + 1
+	return append(revisions, r)
+}
+
+func newRevision(action string, before, after *ServerInfo) *Revision {
+	r := Revision{
+		ServerInfoID: after.ID,
+		Action:       action,
+		Changes:      diff(before, after),
+		CreatedAt:    time.Now(),
+	}
+	h := newHostRecord(after)
+	h.Password = ""
+	b, _ := json.Marshal(h)
+	r.Snapshot = string(b)
+	return &r
+}
+
+// snapshotWithoutPassword removes the password from the snapshot recorded by older versions.
+func snapshotWithoutPassword(snapshot string) string {
+	var h hostRecord
+	if err := json.Unmarshal([]byte(snapshot), &h); err != nil || h.Password == "" {
+		return snapshot
+	}
+	h.Password = ""
+	b, _ := json.Marshal(&h)
+	return string(b)
+}
+
+// revisionFields returns the fields of the given host to compare in revisions.
+func revisionFields(info *ServerInfo) [][2]string {
+	if info == nil {
+		info = &ServerInfo{}
+	}
+	password := strings.Repeat("*", len(info.Password))
+	port := ""
+	if info.Port != 0 {
+		port = strconv.Itoa(info.Port)
+	}
+	addresses := make([]string, 0, len(info.Addresses))
+	for _, addr := range info.Addresses {
+		if addr.Port != 0 {
+			addresses = append(addresses, net.JoinHostPort(addr.Address, strconv.Itoa(addr.Port)))
+		} else {
+			addresses = append(addresses, addr.Address)
+		}
+	}
+	return [][2]string{
+		{"name", info.Name},
+		{"user", info.User},
+		{"address", info.Address},
+		{"port", port},
+		{"password", password},
+		{"keypath", info.KeyPath},
+		{"key", info.KeyName},
+		{"certpath", info.CertPath},
+		{"description", info.Description},
+		{"aliases", strings.Join(info.AliasNames(), ",")},
+		{"addresses", strings.Join(addresses, ",")},
+		{"tags", strings.Join(info.TagNames(), ",")},
+	}
+}
+
+func diff(before, after *ServerInfo) Changes {
+	changes := Changes{}
+	old, updated := revisionFields(before), revisionFields(after)
+	for i := range old {
+		changed := old[i][1] != updated[i][1]
+		if old[i][0] == "password" {
+			// masked passwords of the same length are equal.
+			changed = passwordOf(before) != passwordOf(after)
+		}
+		if changed {
+			changes = append(changes, Change{Field: old[i][0], Old: old[i][1], New: updated[i][1]})
+		}
+	}
+	return changes
+}
+
+func passwordOf(info *ServerInfo) string {
+	if info == nil {
+		return ""
+	}
+	return info.Password
+}
+
+// revertedServerInfo returns the current host with the fields in the snapshot of the revision.
+// The password is not reverted because snapshots do not have it.
+func revertedServerInfo(current *ServerInfo, r *Revision) (*ServerInfo, error) {
+	info, err := r.ServerInfo()
+	if err != nil {
+		return nil, err
+	}
+	info.ID = current.ID
+	info.Password = current.Password
+	keepStoredFields(info, current)
+	return info, nil
+}
@@ -2,7 +2,9 @@ package host
 
 import (
 	"context"
+	"fmt"
 	"gorm.io/gorm"
+	"time"
 )
 
 const (
@@ -13,9 +15,26 @@ type Store interface {
 	Save(ctx context.Context, info *ServerInfo) error
 	FindByName(ctx context.Context, hostname string) (*ServerInfo, error)
 	FindAll(ctx context.Context) ([]*ServerInfo, error)
+	// Find finds hosts matched by the given Query in its order and range.
+	Find(ctx context.Context, q *Query) (*Page, error)
 	Update(ctx context.Context, info *ServerInfo) (int64, error)
+	UpdateLastConnection(ctx context.Context, id uint, address string) error
+	// DeleteByName moves the host of the given name to the trash.
 	DeleteByName(ctx context.Context, hostname string) (int64, error)
 
+	// FindTrash finds hosts in the trash in the order of the deleted time.
+	FindTrash(ctx context.Context) ([]*ServerInfo, error)
+	// Restore restores the host of the given name from the trash.
+	Restore(ctx context.Context, hostname string) (*ServerInfo, error)
+	// Purge deletes hosts of the given names in the trash and their revisions permanently.
+	// All hosts in the trash are purged if no names are given.
+	Purge(ctx context.Context, hostnames ...string) (int64, error)
+	// FindRevisions finds revisions of the host of the given name or alias in the order of Rev.
+	// The host can be in the trash.
+	FindRevisions(ctx context.Context, hostname string) ([]*Revision, error)
+	// Revert updates the host of the given name or alias to the snapshot of the given revision.
+	Revert(ctx context.Context, hostname string, rev int) (*ServerInfo, error)
+
 	SaveOrUpdateActiveServerInfo(ctx context.Context, info *ServerInfo) error
 	FindActiveServerInfo(ctx context.Context) (*ServerInfo, error)
 }
@@ -30,12 +49,22 @@ type store struct {
 }
 
 func (hs *store) Save(ctx context.Context, info *ServerInfo) error {
-	return hs.db.WithContext(ctx).Create(info).Error
+	return hs.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := checkNames(tx, info); err != nil {
+			return err
+		}
+		if err := tx.Create(info).Error; err != nil {
+			return err
+		}
+		return recordRevisions(ctx, tx, ActionCreate, nil, info)
+	})
 }
 
+// FindByName finds a ServerInfo that has the given hostname as a name or an alias.
+// The host of the name is found before the host of the alias.
 func (hs *store) FindByName(ctx context.Context, hostname string) (*ServerInfo, error) {
 	var info ServerInfo
-	if err := hs.db.WithContext(ctx).Take(&info, "name = ?", hostname).Error; err != nil {
+	if err := takeByName(withAssociations(hs.db.WithContext(ctx)), hostname, &info); err != nil {
 		return nil, err
 	}
 	return &info, nil
@@ -43,38 +72,383 @@ func (hs *store) FindByName(ctx context.Context, hostname string) (*ServerInfo,
 
 func (hs *store) FindAll(ctx context.Context) ([]*ServerInfo, error) {
 	var servers []*ServerInfo
-	if err := hs.db.WithContext(ctx).Find(&servers).Error; err != nil {
+	if err := withAssociations(hs.db.WithContext(ctx)).Find(&servers).Error; err != nil {
 		return nil, err
 	}
 	return servers, nil
 }
 
+// Find finds hosts by the given Query. Conditions except the CIDR, the order and the range are applied
+// by the database. Hosts are filtered by the CIDR and paginated in memory if the CIDR is given.
+func (hs *store) Find(ctx context.Context, q *Query) (*Page, error) {
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+	db := hs.db.WithContext(ctx)
+	if q.CIDR != "" {
+		var servers []*ServerInfo
+		if err := withAssociations(hs.filter(db, q)).Find(&servers).Error; err != nil {
+			return nil, err
+		}
+		matched := servers[:0]
+		for _, info := range servers {
+			if q.matchCIDR(info) {
+				matched = append(matched, info)
+			}
+		}
+		return q.paginate(matched)
+	}
+
+	var page Page
+	if err := hs.filter(db, q).Count(&page.Total).Error; err != nil {
+		return nil, err
+	}
+	column, direction, op := sortColumns[q.sortBy()], "ASC", ">"
+	if q.Desc {
+		direction, op = "DESC", "<"
+	}
+	tx := withAssociations(hs.filter(db, q)).Order(column + " " + direction)
+	if column != "id" {
+		tx = tx.Order("id " + direction)
+	}
+	if q.Cursor != "" {
+		c, err := q.decodeCursor()
+		if err != nil {
+			return nil, err
+		}
+		if column == "id" {
+			tx = tx.Where("id "+op+" ?", c.ID)
+		} else {
+			tx = tx.Where(fmt.Sprintf("(%s %s ? OR (%s = ? AND id %s ?))", column, op, column, op), c.Key, c.Key, c.ID)
+		}
+	}
+	if q.Offset > 0 {
+		tx = tx.Offset(q.Offset)
+	}
+	if q.Limit > 0 {
+		// finds one more host to know whether the next page exists.
+		tx = tx.Limit(q.Limit + 1)
+	}
+	page.Hosts = []*ServerInfo{}
+	if err := tx.Find(&page.Hosts).Error; err != nil {
+		return nil, err
+	}
+	if q.Limit > 0 && len(page.Hosts) > q.Limit {
+		page.Hosts = page.Hosts[:q.Limit]
+		page.NextCursor = q.encodeCursor(page.Hosts[q.Limit-1])
+	}
+	return &page, nil
+}
+
+// filter applies the conditions of the Query except the CIDR.
+func (hs *store) filter(db *gorm.DB, q *Query) *gorm.DB {
+	db = db.Model(new(ServerInfo))
+	if q.Name != "" {
+		db = db.Where("name GLOB ?", q.Name)
+	}
+	if q.User != "" {
+		db = db.Where("user_name = ?", q.User)
+	}
+	if tags := q.tags(); len(tags) != 0 {
+		tagQuery := hs.db.Model(new(ServerTag)).
+			Select("server_info_id").
+			Where("name IN ?", tags).
+			Group("server_info_id").
+			Having("COUNT(name) = ?", len(tags))
+		db = db.Where("id IN (?)", tagQuery)
+	}
+	for _, cond := range []struct {
+		query string
+		value time.Time
+	}{
+		{"created_at >= ?", q.CreatedAfter},
+		{"created_at < ?", q.CreatedBefore},
+		{"updated_at >= ?", q.UpdatedAfter},
+		{"updated_at < ?", q.UpdatedBefore},
+	} {
+		if !cond.value.IsZero() {
+			db = db.Where(cond.query, cond.value)
+		}
+	}
+	return db
+}
+
+// Update updates the given ServerInfo and replaces its aliases and addresses. The creation time and the
+// last connection of the host are kept.
 func (hs *store) Update(ctx context.Context, info *ServerInfo) (int64, error) {
-	tx := hs.db.WithContext(ctx).Save(info)
-	return tx.RowsAffected, tx.Error
+	return hs.update(ctx, info, ActionUpdate)
+}
+
+func (hs *store) update(ctx context.Context, info *ServerInfo, action string) (int64, error) {
+	var rowsAffected int64
+	err := hs.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var before *ServerInfo
+		var found ServerInfo
+		if err := withAssociations(tx).Take(&found, info.ID).Error; err == nil {
+			before = &found
+			keepStoredFields(info, before)
+		} else if err != gorm.ErrRecordNotFound {
+			return err
+		}
+		if err := checkNames(tx, info); err != nil {
+			return err
+		}
+		if err := deleteAssociations(tx, info.ID); err != nil {
+			return err
+		}
+		for i := range info.Aliases {
+			info.Aliases[i].ID = 0
+		}
+		for i := range info.Addresses {
+			info.Addresses[i].ID = 0
+		}
+		for i := range info.Tags {
+			info.Tags[i].ID = 0
+		}
+		result := tx.Save(info)
+		if result.Error != nil {
+			return result.Error
+		}
+		rowsAffected = result.RowsAffected
+		return recordRevisions(ctx, tx, action, before, info)
+	})
+	return rowsAffected, err
+}
+
+// UpdateLastConnection records the given address as the last connected address of the host at now.
+func (hs *store) UpdateLastConnection(ctx context.Context, id uint, address string) error {
+	return hs.db.WithContext(ctx).
+		Model(new(ServerInfo)).
+		Where("id = ?", id).
+		UpdateColumns(map[string]interface{}{
+			"last_address":      address,
+			"last_connected_at": time.Now(),
+		}).
+		Error
 }
 
 func (hs *store) DeleteByName(ctx context.Context, hostname string) (int64, error) {
-	tx := hs.db.WithContext(ctx).Where("name = ?", hostname).Delete(new(ServerInfo))
-	return tx.RowsAffected, tx.Error
+	var rowsAffected int64
+	err := hs.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var info ServerInfo
+		if err := withAssociations(tx).Take(&info, "name = ?", hostname).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return nil
+			}
+			return err
+		}
+		result := tx.Delete(&info)
+		if result.Error != nil {
+			return result.Error
+		}
+		rowsAffected = result.RowsAffected
+		return recordRevisions(ctx, tx, ActionDelete, &info, &info)
+	})
+	return rowsAffected, err
+}
+
+func (hs *store) FindTrash(ctx context.Context) ([]*ServerInfo, error) {
+	var servers []*ServerInfo
+	if err := withAssociations(hs.db.WithContext(ctx).Unscoped()).
+		Where("deleted_at IS NOT NULL").
+		Order("deleted_at DESC").
+		Find(&servers).Error; err != nil {
+		return nil, err
+	}
+	return servers, nil
+}
+
+func (hs *store) Restore(ctx context.Context, hostname string) (*ServerInfo, error) {
+	var info ServerInfo
+	err := hs.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := withAssociations(tx.Unscoped()).
+			Where("deleted_at IS NOT NULL").
+			Take(&info, "name = ?", hostname).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Model(&info).UpdateColumn("deleted_at", nil).Error; err != nil {
+			return err
+		}
+		info.DeletedAt = gorm.DeletedAt{}
+		return recordRevisions(ctx, tx, ActionRestore, &info, &info)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+func (hs *store) Purge(ctx context.Context, hostnames ...string) (int64, error) {
+	var purged int64
+	err := hs.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var ids []uint
+		query := tx.Unscoped().Model(new(ServerInfo)).Where("deleted_at IS NOT NULL")
+		if len(hostnames) != 0 {
+			query = query.Where("name IN ?", hostnames)
+		}
+		if err := query.Pluck("id", &ids).Error; err != nil {
+			return err
+		}
+		for _, id := range ids {
+			if err := deleteAssociations(tx, id); err != nil {
+				return err
+			}
+			if err := tx.Where("server_info_id = ?", id).Delete(new(Revision)).Error; err != nil {
+				return err
+			}
+			result := tx.Unscoped().Delete(new(ServerInfo), id)
+			if result.Error != nil {
+				return result.Error
+			}
+			purged += result.RowsAffected
+		}
+		return nil
+	})
+	return purged, err
+}
+
+func (hs *store) FindRevisions(ctx context.Context, hostname string) ([]*Revision, error) {
+	db := hs.db.WithContext(ctx)
+	var info ServerInfo
+	if err := takeByName(db.Unscoped().Order("deleted_at IS NOT NULL"), hostname, &info); err != nil {
+		return nil, err
+	}
+	var revisions []*Revision
+	if err := db.Where("server_info_id = ?", info.ID).Order("rev").Find(&revisions).Error; err != nil {
+		return nil, err
+	}
+	return revisions, nil
+}
+
+func (hs *store) Revert(ctx context.Context, hostname string, rev int) (*ServerInfo, error) {
+	current, err := hs.FindByName(ctx, hostname)
+	if err != nil {
+		return nil, err
+	}
+	var r Revision
+	if err := hs.db.WithContext(ctx).
+		Take(&r, "server_info_id = ? AND rev = ?", current.ID, rev).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("%w: %d", ErrRevisionNotFound, rev)
+		}
+		return nil, err
+	}
+	info, err := revertedServerInfo(current, &r)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := hs.update(ctx, info, ActionRevert); err != nil {
+		return nil, err
+	}
+	return info, nil
 }
 
 func (hs *store) SaveOrUpdateActiveServerInfo(ctx context.Context, info *ServerInfo) error {
 	active := ActiveServerInfo{
 		ID:           activeServerId,
-		ServerInfo:   *info,
 		ServerInfoID: info.ID,
 	}
-	return hs.db.WithContext(ctx).Save(&active).Error
+	return hs.db.WithContext(ctx).Omit("ServerInfo").Save(&active).Error
 }
 
 func (hs *store) FindActiveServerInfo(ctx context.Context) (*ServerInfo, error) {
 	var info ActiveServerInfo
 	if err := hs.db.WithContext(ctx).
+		Preload("ServerInfo.Aliases").
+		Preload("ServerInfo.Addresses", orderBySeq).
+		Preload("ServerInfo.Tags", orderByName).
 		Joins("ServerInfo").
 		First(&info, activeServerId).
 		Error; err != nil {
 		return nil, err
 	}
+	if info.ServerInfo.ID == 0 || info.ServerInfo.Trashed() {
+		return nil, gorm.ErrRecordNotFound
+	}
 	return &info.ServerInfo, nil
 }
+
+// checkNames returns an error if the name or an alias of the given host is used by another host as a name
+// or an alias, and ErrTrashed if the host is in the trash.
+func checkNames(tx *gorm.DB, info *ServerInfo) error {
+	names := append([]string{info.Name}, info.AliasNames()...)
+	aliasQuery := tx.Model(new(ServerAlias)).Select("server_info_id").Where("name IN ?", names)
+	var other ServerInfo
+	err := withAssociations(tx.Unscoped()).
+		Where("id <> ?", info.ID).
+		Where(tx.Where("name IN ?", names).Or("id IN (?)", aliasQuery)).
+		Order("deleted_at IS NOT NULL").
+		Take(&other).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	duplicate := other.Name
+	for _, alias := range other.Aliases {
+		for _, name := range names {
+			if alias.Name == name {
+				duplicate = name
+			}
+		}
+	}
+	if other.Trashed() {
+		return fmt.Errorf("duplicate host name or alias: %s is %w(%s)", duplicate, ErrTrashed, other.Name)
+	}
+	return fmt.Errorf("duplicate host name or alias: %s is used by %s", duplicate, other.Name)
+}
+
+// recordRevisions saves revisions of the change of the host from before to after.
+func recordRevisions(ctx context.Context, tx *gorm.DB, action string, before, after *ServerInfo) error {
+	var last int
+	if err := tx.Model(new(Revision)).
+		Select("COALESCE(MAX(rev), 0)").
+		Where("server_info_id = ?", after.ID).
+		Scan(&last).Error; err != nil {
+		return err
+	}
+	for _, r := range newRevisions(ctx, action, before, after, last) {
+		if err := tx.Create(r).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// takeByName finds the host that has the given hostname as a name or an alias with the given query.
+// The host of the name is found before the host of the alias.
+func takeByName(db *gorm.DB, hostname string, info *ServerInfo) error {
+	db = db.Session(&gorm.Session{})
+	err := db.Take(info, "name = ?", hostname).Error
+	if err != gorm.ErrRecordNotFound {
+		return err
+	}
+	aliasQuery := db.Session(&gorm.Session{NewDB: true}).
+		Model(new(ServerAlias)).
+		Select("server_info_id").
+		Where("name = ?", hostname)
+	return db.Take(info, "id IN (?)", aliasQuery).Error
+}
+
+func withAssociations(db *gorm.DB) *gorm.DB {
+	return db.Preload("Aliases").Preload("Addresses", orderBySeq).Preload("Tags", orderByName)
+}
+
+func orderBySeq(db *gorm.DB) *gorm.DB {
+	return db.Order("seq")
+}
+
+func orderByName(db *gorm.DB) *gorm.DB {
+	return db.Order("name")
+}
+
+func deleteAssociations(tx *gorm.DB, serverInfoID uint) error {
+	if err := tx.Where("server_info_id = ?", serverInfoID).Delete(new(ServerAlias)).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("server_info_id = ?", serverInfoID).Delete(new(ServerAddress)).Error; err != nil {
+		return err
+	}
+	return tx.Where("server_info_id = ?", serverInfoID).Delete(new(ServerTag)).Error
+}
@@ -0,0 +1,28 @@
+package host_test
+
+import (
+	"fmt"
+	"github.com/zacscoding/zssh/pkg/database"
+	"github.com/zacscoding/zssh/pkg/host"
+	"github.com/zacscoding/zssh/pkg/host/hosttest"
+	"path/filepath"
+	"testing"
+)
+
+func TestStore(t *testing.T) {
+	dir, n := t.TempDir(), 0
+	if err := hosttest.TestStore(func() (host.Store, error) {
+		n++
+		dbpath := filepath.Join(dir, fmt.Sprintf("zssh-%d.db", n))
+		db, err := database.NewSQLiteDB(dbpath)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := database.NewMigrator(db, dbpath).Migrate(-1); err != nil {
+			return nil, err
+		}
+		return host.NewStore(db), nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
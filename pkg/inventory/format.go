@@ -0,0 +1,143 @@
+package inventory
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"github.com/zacscoding/zssh/pkg/host"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Fields are the keys of host fields in the inventory in the encoding order.
+var Fields = []string{"user", "address", "port", "aliases", "addresses", "tags", "description"}
+
+// Host is the non-secret data of a host in the inventory. Fields has values of keys in Fields.
+type Host struct {
+	Name   string
+	Fields map[string]string
+}
+
+// FromServerInfo creates a Host from the given ServerInfo without the password and the key path.
+func FromServerInfo(info *host.ServerInfo) *Host {
+	return &Host{
+		Name: info.Name,
+		Fields: map[string]string{
+			"user":        info.User,
+			"address":     info.Address,
+			"port":        strconv.Itoa(info.Port),
+			"aliases":     strings.Join(info.AliasNames(), ","),
+			"addresses":   strings.Join(info.Endpoints()[1:], ","),
+			"tags":        strings.Join(info.TagNames(), ","),
+			"description": info.Description,
+		},
+	}
+}
+
+// Apply sets the fields of the Host to the given ServerInfo. The password and the key path are not changed.
+func (h *Host) Apply(info *host.ServerInfo) error {
+	port, err := strconv.Atoi(h.Fields["port"])
+	if err != nil {
+		return fmt.Errorf("invalid port of the host(%s): %s", h.Name, h.Fields["port"])
+	}
+	info.Name = h.Name
+	info.User = h.Fields["user"]
+	info.Address = h.Fields["address"]
+	info.Port = port
+	info.Description = h.Fields["description"]
+	info.Aliases = nil
+	for _, alias := range splitList(h.Fields["aliases"]) {
+		info.Aliases = append(info.Aliases, host.ServerAlias{Name: alias})
+	}
+	info.Tags = nil
+	for _, tag := range splitList(h.Fields["tags"]) {
+		info.Tags = append(info.Tags, host.ServerTag{Name: tag})
+	}
+	info.Addresses = nil
+	for i, endpoint := range splitList(h.Fields["addresses"]) {
+		addr, p, err := net.SplitHostPort(endpoint)
+		if err != nil {
+			return fmt.Errorf("invalid address of the host(%s): %s", h.Name, endpoint)
+		}
+		port, err := strconv.Atoi(p)
+		if err != nil {
+			return fmt.Errorf("invalid address of the host(%s): %s", h.Name, endpoint)
+		}
+		info.Addresses = append(info.Addresses, host.ServerAddress{Seq: i, Address: addr, Port: port})
+	}
+	return nil
+}
+
+// Equal returns true if all fields of the given hosts are equal.
+func (h *Host) Equal(o *Host) bool {
+	if h == nil || o == nil {
+		return h == o
+	}
+	if h.Name != o.Name {
+		return false
+	}
+	for _, field := range Fields {
+		if h.Fields[field] != o.Fields[field] {
+			return false
+		}
+	}
+	return true
+}
+
+// Encode returns the deterministic text of the Host. Each line is a key and a quoted value.
+//
+//	name = "web"
+//	user = "ubuntu"
+//	...
+func (h *Host) Encode() []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "name = %s\n", strconv.Quote(h.Name))
+	for _, field := range Fields {
+		fmt.Fprintf(&buf, "%s = %s\n", field, strconv.Quote(h.Fields[field]))
+	}
+	return buf.Bytes()
+}
+
+// Decode parses the text encoded by Host.Encode.
+func Decode(b []byte) (*Host, error) {
+	h := Host{Fields: make(map[string]string)}
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		kv := strings.SplitN(text, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("line %d: invalid format", line)
+		}
+		key := strings.TrimSpace(kv[0])
+		value, err := strconv.Unquote(strings.TrimSpace(kv[1]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid value of %s", line, key)
+		}
+		if key == "name" {
+			h.Name = value
+		} else {
+			h.Fields[key] = value
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if h.Name == "" {
+		return nil, fmt.Errorf("empty host name")
+	}
+	return &h, nil
+}
+
+func splitList(value string) []string {
+	var values []string
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
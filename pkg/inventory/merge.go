@@ -0,0 +1,110 @@
+package inventory
+
+import (
+	"sort"
+)
+
+// Side is a side of a three-way merge.
+type Side int
+
+const (
+	SideLocal Side = iota
+	SideRemote
+)
+
+// fieldDeleted is the field of a Conflict between a deleted host and a modified host.
+const fieldDeleted = "(deleted)"
+
+// Conflict is a field of a host changed differently in the local and the remote inventory.
+// Values are empty if the host is deleted.
+type Conflict struct {
+	Host   string
+	Field  string
+	Base   string
+	Local  string
+	Remote string
+}
+
+// Resolver returns the side of the value to take for the given conflict.
+type Resolver func(c *Conflict) (Side, error)
+
+// merge merges the local and the remote hosts changed from the base hosts field by field.
+// Hosts are keyed by names.
+func merge(base, local, remote map[string]*Host, resolve Resolver) (map[string]*Host, error) {
+	names := make(map[string]struct{})
+	for _, hosts := range []map[string]*Host{base, local, remote} {
+		for name := range hosts {
+			names[name] = struct{}{}
+		}
+	}
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	merged := make(map[string]*Host)
+	for _, name := range sorted {
+		h, err := mergeHost(name, base[name], local[name], remote[name], resolve)
+		if err != nil {
+			return nil, err
+		}
+		if h != nil {
+			merged[name] = h
+		}
+	}
+	return merged, nil
+}
+
+func mergeHost(name string, base, local, remote *Host, resolve Resolver) (*Host, error) {
+	switch {
+	case local.Equal(remote):
+		return local, nil
+	case base.Equal(local):
+		return remote, nil
+	case base.Equal(remote):
+		return local, nil
+	case local == nil || remote == nil:
+		// deleted in one side and modified in the other side.
+		side, err := resolve(&Conflict{Host: name, Field: fieldDeleted, Local: exists(local), Remote: exists(remote)})
+		if err != nil {
+			return nil, err
+		}
+		if side == SideRemote {
+			return remote, nil
+		}
+		return local, nil
+	}
+
+	if base == nil {
+		base = &Host{Name: name, Fields: map[string]string{}}
+	}
+	merged := Host{Name: name, Fields: make(map[string]string)}
+	for _, field := range Fields {
+		b, l, r := base.Fields[field], local.Fields[field], remote.Fields[field]
+		switch {
+		case l == r, b == r:
+			merged.Fields[field] = l
+		case b == l:
+			merged.Fields[field] = r
+		default:
+			side, err := resolve(&Conflict{Host: name, Field: field, Base: b, Local: l, Remote: r})
+			if err != nil {
+				return nil, err
+			}
+			if side == SideRemote {
+				merged.Fields[field] = r
+			} else {
+				merged.Fields[field] = l
+			}
+		}
+	}
+	return &merged, nil
+}
+
+func exists(h *Host) string {
+	if h == nil {
+		return "deleted"
+	}
+	return "modified"
+}
@@ -0,0 +1,370 @@
+package inventory
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/zacscoding/zssh/pkg/host"
+	"gorm.io/gorm"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"os/exec"
+	"os/user"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// Dir is the directory of the inventory git working tree in a workspace.
+	Dir = "inventory"
+
+	hostsDir   = "hosts"
+	hostExt    = ".host"
+	branch     = "main"
+	remoteName = "origin"
+)
+
+var (
+	ErrNotInitialized = errors.New("inventory is not initialized")
+)
+
+// Repository is a git working tree of the host inventory.
+type Repository struct {
+	dir string
+}
+
+// Open opens the inventory Repository in the given workspace.
+func Open(workspace string) (*Repository, error) {
+	dir := filepath.Join(workspace, Dir)
+	if _, err := os.Stat(filepath.Join(dir, ".git")); err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNotInitialized
+		}
+		return nil, err
+	}
+	return &Repository{dir: dir}, nil
+}
+
+// Init initializes the inventory Repository in the given workspace if not exists.
+func Init(workspace string) (*Repository, error) {
+	if r, err := Open(workspace); err == nil {
+		return r, nil
+	}
+	r := Repository{dir: filepath.Join(workspace, Dir)}
+	if err := os.MkdirAll(filepath.Join(r.dir, hostsDir), 0700); err != nil {
+		return nil, err
+	}
+	if _, err := r.git("init", "-q"); err != nil {
+		return nil, err
+	}
+	if _, err := r.git("symbolic-ref", "HEAD", "refs/heads/"+branch); err != nil {
+		return nil, err
+	}
+	if name, _ := r.git("config", "user.name"); name == "" {
+		username := "zssh"
+		if u, err := user.Current(); err == nil {
+			username = u.Username
+		}
+		hostname, _ := os.Hostname()
+		if _, err := r.git("config", "user.name", username); err != nil {
+			return nil, err
+		}
+		if _, err := r.git("config", "user.email", username+"@"+hostname); err != nil {
+			return nil, err
+		}
+	}
+	return &r, nil
+}
+
+// Dir returns the path of the working tree.
+func (r *Repository) Dir() string {
+	return r.dir
+}
+
+// SetRemote sets the url of the remote repository which is a local path or a file url.
+func (r *Repository) SetRemote(remote string) error {
+	if current, _ := r.Remote(); current != "" {
+		_, err := r.git("remote", "set-url", remoteName, remote)
+		return err
+	}
+	_, err := r.git("remote", "add", remoteName, remote)
+	return err
+}
+
+// Remote returns the url of the remote repository or empty if not set.
+func (r *Repository) Remote() (string, error) {
+	out, err := r.git("remote")
+	if err != nil || !containsLine(out, remoteName) {
+		return "", err
+	}
+	return r.git("remote", "get-url", remoteName)
+}
+
+// WriteHost writes the given host to the working tree.
+func (r *Repository) WriteHost(h *Host) error {
+	return ioutil.WriteFile(r.hostPath(h.Name), h.Encode(), 0600)
+}
+
+// RemoveHost removes the host of the given name from the working tree.
+func (r *Repository) RemoveHost(name string) error {
+	if err := os.Remove(r.hostPath(name)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Export replaces hosts in the working tree with the given hosts.
+func (r *Repository) Export(hosts []*Host) error {
+	if err := os.RemoveAll(filepath.Join(r.dir, hostsDir)); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Join(r.dir, hostsDir), 0700); err != nil {
+		return err
+	}
+	for _, h := range hosts {
+		if err := r.WriteHost(h); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Commit commits all changes of the working tree with the given message and returns true if committed.
+func (r *Repository) Commit(message string) (bool, error) {
+	if _, err := r.git("add", "-A"); err != nil {
+		return false, err
+	}
+	status, err := r.git("status", "--porcelain")
+	if err != nil {
+		return false, err
+	}
+	if status == "" && r.hasHead() && !r.merging() {
+		return false, nil
+	}
+	if _, err := r.git("commit", "-q", "--allow-empty", "-m", message); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// SyncResult is the result of Repository.Sync.
+type SyncResult struct {
+	Committed bool
+	Merged    bool
+	Pushed    bool
+	Added     []string
+	Updated   []string
+	Deleted   []string
+}
+
+// Sync commits hosts in the given store to the inventory and merges changes of the remote repository
+// into the inventory and the store. Conflicts of fields are resolved by the resolver.
+func (r *Repository) Sync(ctx context.Context, store host.Store, resolve Resolver) (*SyncResult, error) {
+	var result SyncResult
+	infos, err := store.FindAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var hosts []*Host
+	for _, info := range infos {
+		hosts = append(hosts, FromServerInfo(info))
+	}
+	if err := r.Export(hosts); err != nil {
+		return nil, err
+	}
+	if result.Committed, err = r.Commit("sync inventory"); err != nil {
+		return nil, err
+	}
+
+	remote, err := r.Remote()
+	if err != nil || remote == "" {
+		return &result, err
+	}
+	if _, err := r.git("fetch", "-q", remoteName); err != nil {
+		return nil, err
+	}
+	remoteRef := "refs/remotes/" + remoteName + "/" + branch
+	if _, err := r.git("rev-parse", "--verify", "-q", remoteRef); err != nil {
+		// the remote repository is empty.
+		return &result, r.push(&result)
+	}
+	if _, err := r.git("merge-base", "--is-ancestor", remoteRef, "HEAD"); err == nil {
+		return &result, r.push(&result)
+	}
+
+	if _, err := r.git("merge-base", "--is-ancestor", "HEAD", remoteRef); err == nil {
+		return &result, r.fastForward(ctx, store, remoteRef, &result)
+	}
+
+	base := make(map[string]*Host)
+	if baseRev, err := r.git("merge-base", "HEAD", remoteRef); err == nil && baseRev != "" {
+		if base, err = r.readHosts(baseRev); err != nil {
+			return nil, err
+		}
+	}
+	local, err := r.readHosts("HEAD")
+	if err != nil {
+		return nil, err
+	}
+	remoteHosts, err := r.readHosts(remoteRef)
+	if err != nil {
+		return nil, err
+	}
+	merged, err := merge(base, local, remoteHosts, resolve)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := r.git("merge", "-q", "--no-ff", "--no-commit", "-s", "ours", "--allow-unrelated-histories", remoteRef); err != nil {
+		return nil, err
+	}
+	if err := r.applyToStore(ctx, store, local, merged, &result); err != nil {
+		r.git("merge", "--abort")
+		return nil, err
+	}
+	mergedHosts := make([]*Host, 0, len(merged))
+	for _, h := range merged {
+		mergedHosts = append(mergedHosts, h)
+	}
+	if err := r.Export(mergedHosts); err != nil {
+		return nil, err
+	}
+	if _, err := r.Commit("merge inventory from " + remoteName); err != nil {
+		return nil, err
+	}
+	result.Merged = true
+	return &result, r.push(&result)
+}
+
+// fastForward applies hosts of the given remote revision to the store and fast-forwards the inventory.
+func (r *Repository) fastForward(ctx context.Context, store host.Store, remoteRef string, result *SyncResult) error {
+	local, err := r.readHosts("HEAD")
+	if err != nil {
+		return err
+	}
+	remoteHosts, err := r.readHosts(remoteRef)
+	if err != nil {
+		return err
+	}
+	if err := r.applyToStore(ctx, store, local, remoteHosts, result); err != nil {
+		return err
+	}
+	if _, err := r.git("merge", "-q", "--ff-only", remoteRef); err != nil {
+		return err
+	}
+	result.Merged = true
+	return nil
+}
+
+// applyToStore applies changes from the local hosts to the merged hosts into the store.
+// Passwords and key paths in the store are kept.
+func (r *Repository) applyToStore(ctx context.Context, store host.Store, local, merged map[string]*Host, result *SyncResult) error {
+	for name := range local {
+		if _, ok := merged[name]; ok {
+			continue
+		}
+		if _, err := store.DeleteByName(ctx, name); err != nil {
+			return fmt.Errorf("delete the host(%s): %v", name, err)
+		}
+		result.Deleted = append(result.Deleted, name)
+	}
+	for name, h := range merged {
+		if h.Equal(local[name]) {
+			continue
+		}
+		info, err := store.FindByName(ctx, name)
+		if err != nil && err != gorm.ErrRecordNotFound {
+			return err
+		}
+		if info == nil || info.Name != name {
+			info = new(host.ServerInfo)
+			if err := h.Apply(info); err != nil {
+				return err
+			}
+			if err := store.Save(ctx, info); err != nil {
+				return fmt.Errorf("add the host(%s): %v", name, err)
+			}
+			result.Added = append(result.Added, name)
+			continue
+		}
+		if err := h.Apply(info); err != nil {
+			return err
+		}
+		if _, err := store.Update(ctx, info); err != nil {
+			return fmt.Errorf("update the host(%s): %v", name, err)
+		}
+		result.Updated = append(result.Updated, name)
+	}
+	return nil
+}
+
+func (r *Repository) push(result *SyncResult) error {
+	if _, err := r.git("push", "-q", remoteName, "HEAD:refs/heads/"+branch); err != nil {
+		return err
+	}
+	result.Pushed = true
+	return nil
+}
+
+// readHosts reads hosts in the given revision.
+func (r *Repository) readHosts(rev string) (map[string]*Host, error) {
+	out, err := r.git("ls-tree", "-r", "--name-only", rev, hostsDir+"/")
+	if err != nil {
+		return nil, err
+	}
+	hosts := make(map[string]*Host)
+	for _, file := range strings.Split(out, "\n") {
+		if !strings.HasSuffix(file, hostExt) {
+			continue
+		}
+		b, err := r.git("show", rev+":"+file)
+		if err != nil {
+			return nil, err
+		}
+		h, err := Decode([]byte(b))
+		if err != nil {
+			return nil, fmt.Errorf("%s of %s: %v", path.Base(file), rev, err)
+		}
+		hosts[h.Name] = h
+	}
+	return hosts, nil
+}
+
+func (r *Repository) hostPath(name string) string {
+	return filepath.Join(r.dir, hostsDir, url.PathEscape(name)+hostExt)
+}
+
+func (r *Repository) hasHead() bool {
+	_, err := r.git("rev-parse", "--verify", "-q", "HEAD")
+	return err == nil
+}
+
+func (r *Repository) merging() bool {
+	_, err := r.git("rev-parse", "--verify", "-q", "MERGE_HEAD")
+	return err == nil
+}
+
+func (r *Repository) git(args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = r.dir
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("git %s: %v %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+func containsLine(s, line string) bool {
+	for _, l := range strings.Split(s, "\n") {
+		if strings.TrimSpace(l) == line {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,116 @@
+package inventory
+
+import (
+	"context"
+	"fmt"
+	"github.com/zacscoding/zssh/pkg/host"
+	"sync"
+)
+
+// SyncStore is a host.Store which commits changes of hosts to the inventory Repository.
+// Failures of the inventory are passed to the error handler and do not fail the changes of the Store.
+// Changes are serialized because commits share the working tree of the repository.
+type SyncStore struct {
+	host.Store
+	repo    *Repository
+	onError func(err error)
+	mu      sync.Mutex
+}
+
+// NewSyncStore creates a new SyncStore of the given store and repository.
+func NewSyncStore(store host.Store, repo *Repository, onError func(err error)) *SyncStore {
+	return &SyncStore{Store: store, repo: repo, onError: onError}
+}
+
+func (s *SyncStore) Save(ctx context.Context, info *host.ServerInfo) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.Store.Save(ctx, info); err != nil {
+		return err
+	}
+	s.commit("add host "+info.Name, func() error {
+		return s.repo.WriteHost(FromServerInfo(info))
+	})
+	return nil
+}
+
+func (s *SyncStore) Update(ctx context.Context, info *host.ServerInfo) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	before, _ := s.Store.FindAll(ctx)
+	updated, err := s.Store.Update(ctx, info)
+	if err != nil {
+		return updated, err
+	}
+	s.commit("update host "+info.Name, func() error {
+		// removes the old file if the host is renamed.
+		for _, b := range before {
+			if b.ID == info.ID && b.Name != info.Name {
+				if err := s.repo.RemoveHost(b.Name); err != nil {
+					return err
+				}
+			}
+		}
+		return s.repo.WriteHost(FromServerInfo(info))
+	})
+	return updated, nil
+}
+
+func (s *SyncStore) DeleteByName(ctx context.Context, hostname string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	deleted, err := s.Store.DeleteByName(ctx, hostname)
+	if err != nil || deleted == 0 {
+		return deleted, err
+	}
+	s.commit("delete host "+hostname, func() error {
+		return s.repo.RemoveHost(hostname)
+	})
+	return deleted, nil
+}
+
+func (s *SyncStore) Restore(ctx context.Context, hostname string) (*host.ServerInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	info, err := s.Store.Restore(ctx, hostname)
+	if err != nil {
+		return nil, err
+	}
+	s.commit("restore host "+info.Name, func() error {
+		return s.repo.WriteHost(FromServerInfo(info))
+	})
+	return info, nil
+}
+
+func (s *SyncStore) Revert(ctx context.Context, hostname string, rev int) (*host.ServerInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	before, err := s.Store.FindByName(ctx, hostname)
+	if err != nil {
+		return nil, err
+	}
+	info, err := s.Store.Revert(ctx, hostname, rev)
+	if err != nil {
+		return nil, err
+	}
+	s.commit(fmt.Sprintf("revert host %s to revision %d", info.Name, rev), func() error {
+		// removes the old file if the host is renamed.
+		if before.Name != info.Name {
+			if err := s.repo.RemoveHost(before.Name); err != nil {
+				return err
+			}
+		}
+		return s.repo.WriteHost(FromServerInfo(info))
+	})
+	return info, nil
+}
+
+func (s *SyncStore) commit(message string, change func() error) {
+	if err := change(); err != nil {
+		s.onError(err)
+		return
+	}
+	if _, err := s.repo.Commit(message); err != nil {
+		s.onError(err)
+	}
+}
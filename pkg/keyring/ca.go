@@ -0,0 +1,204 @@
+package keyring
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/ssh"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// caKeyName is the name of the key files of a CA in its directory.
+const caKeyName = "ca"
+
+var (
+	// ErrCAExists is returned if the CA is initialized already.
+	ErrCAExists = errors.New("certificate authority already exists")
+	// ErrNoCA is returned if the CA is not initialized.
+	ErrNoCA = errors.New("certificate authority is not initialized")
+	// ErrPassphraseRequired is returned if the key of the CA is encrypted and the passphrase is not given.
+	ErrPassphraseRequired = errors.New("passphrase is required")
+
+	// userExtensions are the extensions of user certificates which are the same as ssh-keygen.
+	userExtensions = map[string]string{
+		"permit-X11-forwarding":   "",
+		"permit-agent-forwarding": "",
+		"permit-port-forwarding":  "",
+		"permit-pty":              "",
+		"permit-user-rc":          "",
+	}
+)
+
+// CA is a certificate authority which signs user and host keys with its key in the directory.
+type CA struct {
+	dir string
+}
+
+// SignOptions are options of a certificate. ValidAfter is now if zero.
+type SignOptions struct {
+	KeyID      string
+	Principals []string
+	ValidAfter time.Time
+	Validity   time.Duration
+}
+
+// Validate returns an error if the options do not have principals or have an empty one. A certificate
+// without principals is valid for any user or host, so it is not issued.
+func (o *SignOptions) Validate() error {
+	if len(o.Principals) == 0 {
+		return errors.New("no principals")
+	}
+	for _, principal := range o.Principals {
+		if strings.TrimSpace(principal) == "" {
+			return errors.New("empty principal")
+		}
+	}
+	if o.Validity <= 0 {
+		return fmt.Errorf("invalid validity: %s", o.Validity)
+	}
+	return nil
+}
+
+// NewCA creates a new CA of the given directory.
+func NewCA(dir string) *CA {
+	return &CA{dir: dir}
+}
+
+// PrivateKeyPath returns the path of the private key of the CA.
+func (ca *CA) PrivateKeyPath() string {
+	return filepath.Join(ca.dir, caKeyName)
+}
+
+// PublicKeyPath returns the path of the public key of the CA.
+func (ca *CA) PublicKeyPath() string {
+	return ca.PrivateKeyPath() + ".pub"
+}
+
+// Init generates the key of the CA with the type, bits, comment and passphrase of the given options.
+// The name of the options is ignored.
+func (ca *CA) Init(opts *GenerateOptions) (ssh.PublicKey, error) {
+	for _, path := range []string{ca.PrivateKeyPath(), ca.PublicKeyPath()} {
+		if _, err := os.Stat(path); err == nil {
+			return nil, fmt.Errorf("%w: %s", ErrCAExists, path)
+		}
+	}
+	pair, err := generateKeyPair(opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := pair.write(ca.PrivateKeyPath(), ca.PublicKeyPath()); err != nil {
+		os.Remove(ca.PrivateKeyPath())
+		os.Remove(ca.PublicKeyPath())
+		return nil, err
+	}
+	return pair.publicKey, nil
+}
+
+// PublicKey returns the public key of the CA.
+func (ca *CA) PublicKey() (ssh.PublicKey, error) {
+	publicKey, err := ReadPublicKey(ca.PublicKeyPath())
+	if os.IsNotExist(err) {
+		return nil, ErrNoCA
+	}
+	return publicKey, err
+}
+
+// Signer returns the signer of the private key of the CA. It returns ErrPassphraseRequired
+// if the key is encrypted and the passphrase is empty.
+func (ca *CA) Signer(passphrase string) (ssh.Signer, error) {
+	b, err := ioutil.ReadFile(ca.PrivateKeyPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNoCA
+		}
+		return nil, err
+	}
+	if passphrase != "" {
+		return ssh.ParsePrivateKeyWithPassphrase(b, []byte(passphrase))
+	}
+	signer, err := ssh.ParsePrivateKey(b)
+	if _, ok := err.(*ssh.PassphraseMissingError); ok {
+		return nil, ErrPassphraseRequired
+	}
+	return signer, err
+}
+
+// SignUser issues a user certificate of the given public key signed by the signer of the CA.
+func (ca *CA) SignUser(signer ssh.Signer, publicKey ssh.PublicKey, opts *SignOptions) (*ssh.Certificate, error) {
+	return sign(signer, publicKey, ssh.UserCert, opts)
+}
+
+// SignHost issues a host certificate of the given public key signed by the signer of the CA.
+// The principals of the options are host names of the host.
+func (ca *CA) SignHost(signer ssh.Signer, publicKey ssh.PublicKey, opts *SignOptions) (*ssh.Certificate, error) {
+	return sign(signer, publicKey, ssh.HostCert, opts)
+}
+
+func sign(signer ssh.Signer, publicKey ssh.PublicKey, certType uint32, opts *SignOptions) (*ssh.Certificate, error) {
+	if _, ok := publicKey.(*ssh.Certificate); ok {
+		return nil, fmt.Errorf("the public key is a certificate")
+	}
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	var serial [8]byte
+	if _, err := rand.Read(serial[:]); err != nil {
+		return nil, err
+	}
+	validAfter := opts.ValidAfter
+	if validAfter.IsZero() {
+		validAfter = time.Now()
+	}
+	cert := ssh.Certificate{
+		Key:             publicKey,
+		Serial:          binary.BigEndian.Uint64(serial[:]),
+		CertType:        certType,
+		KeyId:           opts.KeyID,
+		ValidPrincipals: opts.Principals,
+		ValidAfter:      uint64(validAfter.Unix()),
+		ValidBefore:     uint64(validAfter.Add(opts.Validity).Unix()),
+	}
+	if certType == ssh.UserCert {
+		cert.Permissions.Extensions = make(map[string]string, len(userExtensions))
+		for name, value := range userExtensions {
+			cert.Permissions.Extensions[name] = value
+		}
+	}
+	if err := cert.SignCert(rand.Reader, signer); err != nil {
+		return nil, err
+	}
+	return &cert, nil
+}
+
+// ReadPublicKey reads the public key in the authorized_keys format from the given path.
+func ReadPublicKey(path string) (ssh.PublicKey, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	publicKey, _, _, _, err := ssh.ParseAuthorizedKey(b)
+	if err != nil {
+		return nil, fmt.Errorf("parse the public key %s: %v", path, err)
+	}
+	return publicKey, nil
+}
+
+// WriteCertificate writes the given certificate to the path in the authorized_keys format like ssh-keygen.
+func WriteCertificate(path string, cert *ssh.Certificate) error {
+	return ioutil.WriteFile(path, ssh.MarshalAuthorizedKey(cert), 0644)
+}
+
+// Fingerprint returns the SHA256 fingerprint of the given public key.
+func Fingerprint(publicKey ssh.PublicKey) string {
+	return ssh.FingerprintSHA256(publicKey)
+}
+
+// AuthorizedKey returns the given public key in the authorized_keys format.
+func AuthorizedKey(publicKey ssh.PublicKey) string {
+	return strings.TrimSpace(string(ssh.MarshalAuthorizedKey(publicKey)))
+}
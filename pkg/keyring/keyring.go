@@ -0,0 +1,271 @@
+package keyring
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/ssh"
+	"gorm.io/gorm"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+)
+
+const (
+	DefaultRSABits   = 4096
+	DefaultECDSABits = 256
+)
+
+var (
+	// ErrKeyExists is returned if a key of the same name exists.
+	ErrKeyExists = errors.New("key already exists")
+
+	namePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+)
+
+// GenerateOptions are options of a new key. Bits is the default of the type if zero.
+type GenerateOptions struct {
+	Name       string
+	Type       string
+	Bits       int
+	Comment    string
+	Passphrase string
+}
+
+// Keyring manages key pairs in the directory, which are tracked by the Store.
+// The private key of a key "name" is the file "name" and the public key is "name.pub" like ssh-keygen.
+type Keyring struct {
+	dir   string
+	store Store
+}
+
+// NewKeyring creates a new Keyring of the given directory and store.
+func NewKeyring(dir string, store Store) *Keyring {
+	return &Keyring{dir: dir, store: store}
+}
+
+// PrivateKeyPath returns the path of the private key of the given name.
+func (kr *Keyring) PrivateKeyPath(name string) string {
+	return filepath.Join(kr.dir, name)
+}
+
+// PublicKeyPath returns the path of the public key of the given name.
+func (kr *Keyring) PublicKeyPath(name string) string {
+	return kr.PrivateKeyPath(name) + ".pub"
+}
+
+// Generate generates a new key pair and writes it to the directory.
+func (kr *Keyring) Generate(ctx context.Context, opts *GenerateOptions) (*Key, error) {
+	if !namePattern.MatchString(opts.Name) {
+		return nil, fmt.Errorf("invalid key name: %q", opts.Name)
+	}
+	if _, err := kr.store.FindByName(ctx, opts.Name); err == nil {
+		return nil, fmt.Errorf("%w: %s", ErrKeyExists, opts.Name)
+	} else if err != gorm.ErrRecordNotFound {
+		return nil, err
+	}
+	for _, path := range []string{kr.PrivateKeyPath(opts.Name), kr.PublicKeyPath(opts.Name)} {
+		if _, err := os.Stat(path); err == nil {
+			return nil, fmt.Errorf("%w: %s", ErrKeyExists, path)
+		}
+	}
+
+	pair, err := generateKeyPair(opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := pair.write(kr.PrivateKeyPath(opts.Name), kr.PublicKeyPath(opts.Name)); err != nil {
+		kr.removeFiles(opts.Name)
+		return nil, err
+	}
+	k := Key{
+		Name:        opts.Name,
+		Type:        opts.Type,
+		Bits:        pair.bits,
+		Fingerprint: ssh.FingerprintSHA256(pair.publicKey),
+		Comment:     opts.Comment,
+		PublicKey:   pair.authorizedKey,
+		Encrypted:   opts.Passphrase != "",
+		CreatedAt:   time.Now(),
+	}
+	if err := kr.store.Save(ctx, &k); err != nil {
+		kr.removeFiles(opts.Name)
+		return nil, err
+	}
+	return &k, nil
+}
+
+// Import adds the key of the given files to the directory, e.g. restored from a backup. The fields of
+// the given Key are saved as they are except its ID.
+func (kr *Keyring) Import(ctx context.Context, k *Key, privateKey, publicKey []byte) error {
+	if !namePattern.MatchString(k.Name) {
+		return fmt.Errorf("invalid key name: %q", k.Name)
+	}
+	if _, err := kr.store.FindByName(ctx, k.Name); err == nil {
+		return fmt.Errorf("%w: %s", ErrKeyExists, k.Name)
+	} else if err != gorm.ErrRecordNotFound {
+		return err
+	}
+	for _, path := range []string{kr.PrivateKeyPath(k.Name), kr.PublicKeyPath(k.Name)} {
+		if _, err := os.Stat(path); err == nil {
+			return fmt.Errorf("%w: %s", ErrKeyExists, path)
+		}
+	}
+
+	if err := os.MkdirAll(kr.dir, 0700); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(kr.PrivateKeyPath(k.Name), privateKey, 0600); err != nil {
+		kr.removeFiles(k.Name)
+		return err
+	}
+	if err := ioutil.WriteFile(kr.PublicKeyPath(k.Name), publicKey, 0644); err != nil {
+		kr.removeFiles(k.Name)
+		return err
+	}
+	k.ID = 0
+	if err := kr.store.Save(ctx, k); err != nil {
+		kr.removeFiles(k.Name)
+		return err
+	}
+	return nil
+}
+
+// Find finds the key of the given name. It returns gorm.ErrRecordNotFound if not exists.
+func (kr *Keyring) Find(ctx context.Context, name string) (*Key, error) {
+	return kr.store.FindByName(ctx, name)
+}
+
+func (kr *Keyring) FindAll(ctx context.Context) ([]*Key, error) {
+	return kr.store.FindAll(ctx)
+}
+
+// Delete deletes the key of the given name and its files.
+func (kr *Keyring) Delete(ctx context.Context, name string) error {
+	deleted, err := kr.store.DeleteByName(ctx, name)
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return kr.removeFiles(name)
+}
+
+func (kr *Keyring) removeFiles(name string) error {
+	for _, path := range []string{kr.PrivateKeyPath(name), kr.PublicKeyPath(name)} {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// keyBits returns the bits of the key type or an error if the type or bits are not supported.
+func keyBits(keyType string, bits int) (int, error) {
+	switch keyType {
+	case TypeED25519:
+		if bits != 0 && bits != 256 {
+			return 0, fmt.Errorf("ed25519 keys have a fixed length")
+		}
+		return 256, nil
+	case TypeRSA:
+		if bits == 0 {
+			return DefaultRSABits, nil
+		}
+		if bits < 2048 {
+			return 0, fmt.Errorf("rsa keys must be at least 2048 bits: %d", bits)
+		}
+		return bits, nil
+	case TypeECDSA:
+		if bits == 0 {
+			return DefaultECDSABits, nil
+		}
+		if _, ok := curves[bits]; !ok {
+			return 0, fmt.Errorf("ecdsa keys must be 256, 384 or 521 bits: %d", bits)
+		}
+		return bits, nil
+	}
+	return 0, fmt.Errorf("unsupported key type: %s (one of %s, %s, %s)", keyType, TypeED25519, TypeRSA, TypeECDSA)
+}
+
+var curves = map[int]elliptic.Curve{
+	256: elliptic.P256(),
+	384: elliptic.P384(),
+	521: elliptic.P521(),
+}
+
+func generatePrivateKey(keyType string, bits int) (crypto.PrivateKey, error) {
+	switch keyType {
+	case TypeED25519:
+		_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+		return privateKey, err
+	case TypeRSA:
+		return rsa.GenerateKey(rand.Reader, bits)
+	default:
+		return ecdsa.GenerateKey(curves[bits], rand.Reader)
+	}
+}
+
+// keyPair is a generated key pair encoded in the OpenSSH formats.
+type keyPair struct {
+	bits          int
+	privateKey    []byte
+	publicKey     ssh.PublicKey
+	authorizedKey string
+}
+
+// generateKeyPair generates a new key pair of the type, bits, comment and passphrase of the given options.
+func generateKeyPair(opts *GenerateOptions) (*keyPair, error) {
+	bits, err := keyBits(opts.Type, opts.Bits)
+	if err != nil {
+		return nil, err
+	}
+	privateKey, err := generatePrivateKey(opts.Type, bits)
+	if err != nil {
+		return nil, err
+	}
+	var block *pem.Block
+	if opts.Passphrase == "" {
+		block, err = ssh.MarshalPrivateKey(privateKey, opts.Comment)
+	} else {
+		block, err = ssh.MarshalPrivateKeyWithPassphrase(privateKey, opts.Comment, []byte(opts.Passphrase))
+	}
+	if err != nil {
+		return nil, err
+	}
+	publicKey, err := ssh.NewPublicKey(privateKey.(crypto.Signer).Public())
+	if err != nil {
+		return nil, err
+	}
+	authorizedKey := AuthorizedKey(publicKey)
+	if opts.Comment != "" {
+		authorizedKey += " " + opts.Comment
+	}
+	return &keyPair{
+		bits:          bits,
+		privateKey:    pem.EncodeToMemory(block),
+		publicKey:     publicKey,
+		authorizedKey: authorizedKey,
+	}, nil
+}
+
+// write writes the private key and the public key to the given paths, creating the directory of them.
+func (p *keyPair) write(privateKeyPath, publicKeyPath string) error {
+	if err := os.MkdirAll(filepath.Dir(privateKeyPath), 0700); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(privateKeyPath, p.privateKey, 0600); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(publicKeyPath, []byte(p.authorizedKey+"\n"), 0644)
+}
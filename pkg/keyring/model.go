@@ -0,0 +1,66 @@
+package keyring
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+const (
+	TableNameKey = "keys"
+)
+
+// Types of keys.
+const (
+	TypeED25519 = "ed25519"
+	TypeRSA     = "rsa"
+	TypeECDSA   = "ecdsa"
+)
+
+// Key is a key pair managed in the key directory of the workspace.
+type Key struct {
+	ID   uint   `json:"id" gorm:"column:id;primarykey"`
+	Name string `json:"name" gorm:"column:name;unique"`
+	Type string `json:"type" gorm:"column:type"`
+	// Bits is the size of rsa keys or the curve size of ecdsa keys.
+	Bits int `json:"bits" gorm:"column:bits"`
+	// Fingerprint is the SHA256 fingerprint of the public key like ssh-keygen -l.
+	Fingerprint string `json:"fingerprint" gorm:"column:fingerprint"`
+	Comment     string `json:"comment" gorm:"column:comment"`
+	// PublicKey is the public key in the authorized_keys format.
+	PublicKey string `json:"publicKey" gorm:"column:public_key"`
+	// Encrypted is true if the private key is protected with a passphrase.
+	Encrypted bool      `json:"encrypted" gorm:"column:encrypted"`
+	CreatedAt time.Time `json:"createdAt" gorm:"column:created_at"`
+}
+
+func (k Key) TableName() string {
+	return TableNameKey
+}
+
+func (k *Key) String() string {
+	s := fmt.Sprintf("%s %s(%d) %s", k.Name, k.Type, k.Bits, k.Fingerprint)
+	if k.Comment != "" {
+		s += " " + k.Comment
+	}
+	if k.Encrypted {
+		s += " [encrypted]"
+	}
+	return s
+}
+
+func (k *Key) ToJSON(pretty bool) string {
+	var (
+		b   []byte
+		err error
+	)
+	if pretty {
+		b, err = json.MarshalIndent(k, "", "  ")
+	} else {
+		b, err = json.Marshal(k)
+	}
+	if err != nil {
+		return err.Error()
+	}
+	return string(b)
+}
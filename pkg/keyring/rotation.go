@@ -0,0 +1,159 @@
+package keyring
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Steps of a rotation of a host in the order. Each step is recorded after it is completed.
+const (
+	StepPending   = "pending"
+	StepInstalled = "installed"
+	StepVerified  = "verified"
+	StepRemoved   = "removed"
+	StepDone      = "done"
+)
+
+var steps = []string{StepPending, StepInstalled, StepVerified, StepRemoved, StepDone}
+
+// Rotation is the state of a key rotation from a key to another key across hosts, which is saved to
+// the file after each step so that a failed rotation is resumed from the last completed step of each host.
+type Rotation struct {
+	From      string                   `json:"from"`
+	To        string                   `json:"to"`
+	StartedAt time.Time                `json:"startedAt"`
+	Hosts     map[string]*RotationHost `json:"hosts"`
+
+	mu   sync.Mutex
+	path string
+}
+
+// RotationHost is the state of a host in a Rotation.
+type RotationHost struct {
+	Name      string    `json:"host"`
+	Step      string    `json:"step"`
+	Error     string    `json:"error"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// Done returns true if the rotation of the host is completed.
+func (h *RotationHost) Done() bool {
+	return h.Step == StepDone
+}
+
+// Completed returns true if the host has completed the given step.
+func (h *RotationHost) Completed(step string) bool {
+	return stepIndex(h.Step) >= stepIndex(step)
+}
+
+// LoadRotation loads the Rotation of the file in the path or creates a new one if the file does not exist.
+func LoadRotation(path, from, to string) (*Rotation, error) {
+	r := Rotation{From: from, To: to, StartedAt: time.Now(), Hosts: make(map[string]*RotationHost), path: path}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &r, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &r); err != nil {
+		return nil, fmt.Errorf("parse the rotation state %s: %v", path, err)
+	}
+	if r.From != from || r.To != to {
+		return nil, fmt.Errorf("the rotation state %s is the rotation from %s to %s", path, r.From, r.To)
+	}
+	if r.Hosts == nil {
+		r.Hosts = make(map[string]*RotationHost)
+	}
+	for name, h := range r.Hosts {
+		h.Name = name
+	}
+	return &r, nil
+}
+
+// Host returns the state of the host of the given name, which is added as pending if not exists.
+func (r *Rotation) Host(name string) *RotationHost {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	h, ok := r.Hosts[name]
+	if !ok {
+		h = &RotationHost{Name: name, Step: StepPending, UpdatedAt: time.Now()}
+		r.Hosts[name] = h
+	}
+	c := *h
+	return &c
+}
+
+// Record records the result of the step of the host and saves the Rotation to the file.
+// The step of the host is kept if err is not nil.
+func (r *Rotation) Record(name, step string, err error) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	h, ok := r.Hosts[name]
+	if !ok {
+		h = &RotationHost{Name: name}
+		r.Hosts[name] = h
+	}
+	h.UpdatedAt = time.Now()
+	if err != nil {
+		h.Error = err.Error()
+	} else {
+		h.Step = step
+		h.Error = ""
+	}
+	return r.save()
+}
+
+// Results returns the states of hosts in the order of names.
+func (r *Rotation) Results() []*RotationHost {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	results := make([]*RotationHost, 0, len(r.Hosts))
+	for _, h := range r.Hosts {
+		c := *h
+		results = append(results, &c)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Name < results[j].Name
+	})
+	return results
+}
+
+// save writes the Rotation to the file through a temporary file.
+func (r *Rotation) save() error {
+	b, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(r.path), 0700); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(r.path), "."+filepath.Base(r.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), r.path)
+}
+
+func stepIndex(step string) int {
+	for i, s := range steps {
+		if s == step {
+			return i
+		}
+	}
+	return 0
+}
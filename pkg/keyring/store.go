@@ -0,0 +1,48 @@
+package keyring
+
+import (
+	"context"
+	"gorm.io/gorm"
+)
+
+type Store interface {
+	Save(ctx context.Context, k *Key) error
+	FindByName(ctx context.Context, name string) (*Key, error)
+	FindAll(ctx context.Context) ([]*Key, error)
+	DeleteByName(ctx context.Context, name string) (int64, error)
+}
+
+// NewStore creates a new Store from given gorm.DB.
+func NewStore(db *gorm.DB) Store {
+	return &store{db: db}
+}
+
+type store struct {
+	db *gorm.DB
+}
+
+func (s *store) Save(ctx context.Context, k *Key) error {
+	return s.db.WithContext(ctx).Create(k).Error
+}
+
+func (s *store) FindByName(ctx context.Context, name string) (*Key, error) {
+	var k Key
+	if err := s.db.WithContext(ctx).Take(&k, "name = ?", name).Error; err != nil {
+		return nil, err
+	}
+	return &k, nil
+}
+
+// FindAll returns all keys in the order of names.
+func (s *store) FindAll(ctx context.Context) ([]*Key, error) {
+	var keys []*Key
+	if err := s.db.WithContext(ctx).Order("name").Find(&keys).Error; err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+func (s *store) DeleteByName(ctx context.Context, name string) (int64, error) {
+	result := s.db.WithContext(ctx).Where("name = ?", name).Delete(new(Key))
+	return result.RowsAffected, result.Error
+}
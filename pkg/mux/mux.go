@@ -0,0 +1,511 @@
+package mux
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	zssh "github.com/zacscoding/zssh/pkg/ssh"
+	"golang.org/x/crypto/ssh"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	defaultIdleTimeout = 10 * time.Minute
+	defaultBackoff     = time.Second
+	defaultMaxBackoff  = time.Minute
+	controlTimeout     = 5 * time.Second
+)
+
+// Dialer connects to the host of the given name. The Client should send keepalive requests to detect the lost
+// connection, which is redialed by the Server.
+type Dialer func(name string) (*zssh.Client, error)
+
+// Options are options of the Server.
+type Options struct {
+	Dial Dialer
+	// IdleTimeout closes the connection to a host which has no sessions for it. Default is 10 minutes.
+	IdleTimeout time.Duration
+	// ReconnectBackoff is the delay before redialing a host whose connection is lost, and it doubles
+	// after each failure up to MaxReconnectBackoff. Defaults are 1 second and 1 minute.
+	ReconnectBackoff    time.Duration
+	MaxReconnectBackoff time.Duration
+}
+
+// Status is the status of the daemon.
+type Status struct {
+	PID       int           `json:"pid"`
+	StartedAt time.Time     `json:"startedAt"`
+	Hosts     []*HostStatus `json:"hosts"`
+}
+
+// HostStatus is the status of the connection to a host.
+type HostStatus struct {
+	Name        string    `json:"name"`
+	Address     string    `json:"address"`
+	Sessions    int       `json:"sessions"`
+	ConnectedAt time.Time `json:"connectedAt"`
+	LastUsedAt  time.Time `json:"lastUsedAt"`
+	Reconnects  int       `json:"reconnects"`
+}
+
+func (s *HostStatus) String() string {
+	return fmt.Sprintf("%s (%s) sessions: %d, connected: %s, last used: %s, reconnects: %d", s.Name, s.Address,
+		s.Sessions, s.ConnectedAt.Format(time.RFC3339), s.LastUsedAt.Format(time.RFC3339), s.Reconnects)
+}
+
+// Server keeps connections to hosts and serves sessions of local clients over them. Clients connect to
+// the Server with the ssh protocol, and channels of clients are proxied to the connection of the host
+// named by the user name of the client.
+type Server struct {
+	opts      Options
+	config    *ssh.ServerConfig
+	startedAt time.Time
+
+	mu        sync.Mutex
+	upstreams map[string]*upstream
+	dials     map[string]*dialCall
+	listener  net.Listener
+	closed    bool
+	done      chan struct{}
+}
+
+type upstream struct {
+	name        string
+	address     string
+	conn        ssh.Conn
+	cli         *zssh.Client
+	connectedAt time.Time
+	lastUsedAt  time.Time
+	sessions    int
+	reconnects  int
+	idle        *time.Timer
+	// closing is set when the connection is closed on purpose, so that it is not reconnected.
+	closing bool
+}
+
+type dialCall struct {
+	done chan struct{}
+	up   *upstream
+	err  error
+}
+
+// NewServer creates a new Server with an ephemeral host key.
+func NewServer(opts Options) (*Server, error) {
+	if opts.Dial == nil {
+		return nil, errors.New("mux: no dialer")
+	}
+	if opts.IdleTimeout <= 0 {
+		opts.IdleTimeout = defaultIdleTimeout
+	}
+	if opts.ReconnectBackoff <= 0 {
+		opts.ReconnectBackoff = defaultBackoff
+	}
+	if opts.MaxReconnectBackoff < opts.ReconnectBackoff {
+		opts.MaxReconnectBackoff = defaultMaxBackoff
+		if opts.MaxReconnectBackoff < opts.ReconnectBackoff {
+			opts.MaxReconnectBackoff = opts.ReconnectBackoff
+		}
+	}
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := ssh.NewSignerFromKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
+		opts:      opts,
+		startedAt: time.Now(),
+		upstreams: make(map[string]*upstream),
+		dials:     make(map[string]*dialCall),
+		done:      make(chan struct{}),
+	}
+	s.config = &ssh.ServerConfig{
+		NoClientAuth: true,
+		// connects to the host while authenticating the client, so that the client falls back to dial
+		// directly if the host is not available.
+		NoClientAuthCallback: func(meta ssh.ConnMetadata) (*ssh.Permissions, error) {
+			if meta.User() == "" {
+				return nil, nil
+			}
+			_, err := s.upstream(meta.User())
+			return nil, err
+		},
+	}
+	s.config.AddHostKey(signer)
+	return s, nil
+}
+
+// Listen listens on the unix socket of the given path which only the user can access.
+// A stale socket is removed, and it returns an error if a daemon is listening on it.
+func Listen(socket string) (net.Listener, error) {
+	if conn, err := net.Dial("unix", socket); err == nil {
+		conn.Close()
+		return nil, fmt.Errorf("a mux daemon is already listening on %s", socket)
+	}
+	if err := os.Remove(socket); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(socket), 0700); err != nil {
+		return nil, err
+	}
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(socket, 0600); err != nil {
+		l.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// Serve accepts clients of the listener until the Server is closed.
+func (s *Server) Serve(l net.Listener) error {
+	s.mu.Lock()
+	s.listener = l
+	s.mu.Unlock()
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			select {
+			case <-s.done:
+				return nil
+			default:
+				return err
+			}
+		}
+		go s.handle(c)
+	}
+}
+
+// Done returns the channel which is closed when the Server is closed.
+func (s *Server) Done() <-chan struct{} {
+	return s.done
+}
+
+// Close stops accepting clients and closes all connections to hosts.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	close(s.done)
+	if s.listener != nil {
+		s.listener.Close()
+	}
+	for name, up := range s.upstreams {
+		up.cli.Close()
+		delete(s.upstreams, name)
+	}
+	return nil
+}
+
+// Status returns the status of the Server.
+func (s *Server) Status() *Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	status := Status{PID: os.Getpid(), StartedAt: s.startedAt, Hosts: make([]*HostStatus, 0, len(s.upstreams))}
+	for _, up := range s.upstreams {
+		status.Hosts = append(status.Hosts, &HostStatus{
+			Name:        up.name,
+			Address:     up.address,
+			Sessions:    up.sessions,
+			ConnectedAt: up.connectedAt,
+			LastUsedAt:  up.lastUsedAt,
+			Reconnects:  up.reconnects,
+		})
+	}
+	sort.Slice(status.Hosts, func(i, j int) bool {
+		return status.Hosts[i].Name < status.Hosts[j].Name
+	})
+	return &status
+}
+
+func (s *Server) handle(c net.Conn) {
+	sconn, chans, reqs, err := ssh.NewServerConn(c, s.config)
+	if err != nil {
+		c.Close()
+		return
+	}
+	defer sconn.Close()
+	name := sconn.User()
+	go s.handleRequests(name, reqs)
+	for nc := range chans {
+		if name == "" {
+			nc.Reject(ssh.Prohibited, "no host")
+			continue
+		}
+		up, err := s.upstream(name)
+		if err != nil {
+			nc.Reject(ssh.ConnectionFailed, err.Error())
+			continue
+		}
+		go s.proxy(up, nc)
+	}
+}
+
+func (s *Server) handleRequests(name string, reqs <-chan *ssh.Request) {
+	for req := range reqs {
+		switch {
+		case req.Type == zssh.MuxRequestAddress && name != "":
+			up, err := s.upstream(name)
+			if err != nil {
+				req.Reply(false, nil)
+				continue
+			}
+			req.Reply(true, []byte(up.address))
+		case req.Type == zssh.MuxRequestStatus && name == "":
+			b, _ := json.Marshal(s.Status())
+			req.Reply(true, b)
+		case req.Type == zssh.MuxRequestStop && name == "":
+			req.Reply(true, nil)
+			s.Close()
+		default:
+			if req.WantReply {
+				req.Reply(false, nil)
+			}
+		}
+	}
+}
+
+// upstream returns the connection to the host, and connects to it if there is no connection.
+// Concurrent calls for the same host share one dial.
+func (s *Server) upstream(name string) (*upstream, error) {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil, errors.New("mux: closed")
+	}
+	if up, ok := s.upstreams[name]; ok {
+		s.mu.Unlock()
+		return up, nil
+	}
+	if call, ok := s.dials[name]; ok {
+		s.mu.Unlock()
+		<-call.done
+		return call.up, call.err
+	}
+	call := &dialCall{done: make(chan struct{})}
+	s.dials[name] = call
+	s.mu.Unlock()
+
+	cli, err := s.opts.Dial(name)
+	s.mu.Lock()
+	delete(s.dials, name)
+	switch {
+	case err != nil:
+		call.err = err
+	case s.closed:
+		cli.Close()
+		call.err = errors.New("mux: closed")
+	default:
+		now := time.Now()
+		call.up = &upstream{name: name, address: cli.Address, conn: cli.Conn(), cli: cli, connectedAt: now, lastUsedAt: now}
+		s.upstreams[name] = call.up
+		s.resetIdle(call.up)
+		go s.wait(call.up)
+	}
+	s.mu.Unlock()
+	close(call.done)
+	return call.up, call.err
+}
+
+// wait removes the upstream when the connection is closed, and reconnects to the host if the
+// connection is lost.
+func (s *Server) wait(up *upstream) {
+	_ = up.conn.Wait()
+	up.cli.Close()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.upstreams[up.name] == up {
+		delete(s.upstreams, up.name)
+	}
+	if up.idle != nil {
+		up.idle.Stop()
+	}
+	if !s.closed && !up.closing {
+		// keeps redialing as long as the idle connection would have been kept.
+		go s.reconnect(up.name, up.reconnects, time.Now().Add(s.opts.IdleTimeout))
+	}
+}
+
+// reconnect redials the host of the lost connection with exponential backoff until it is connected,
+// the deadline passes or the Server is closed. Sessions of the lost connection are not restored,
+// but new sessions of clients use the new connection.
+func (s *Server) reconnect(name string, reconnects int, deadline time.Time) {
+	backoff := s.opts.ReconnectBackoff
+	for time.Now().Add(backoff).Before(deadline) {
+		timer := time.NewTimer(backoff)
+		select {
+		case <-s.done:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		s.mu.Lock()
+		_, connected := s.upstreams[name]
+		s.mu.Unlock()
+		if connected {
+			// a client connected to the host again.
+			return
+		}
+		if up, err := s.upstream(name); err == nil {
+			s.mu.Lock()
+			up.reconnects = reconnects + 1
+			s.mu.Unlock()
+			return
+		}
+		backoff *= 2
+		if backoff > s.opts.MaxReconnectBackoff {
+			backoff = s.opts.MaxReconnectBackoff
+		}
+	}
+}
+
+// resetIdle starts the idle timer of the upstream if it has no sessions. s.mu must be held.
+func (s *Server) resetIdle(up *upstream) {
+	if up.idle != nil {
+		up.idle.Stop()
+		up.idle = nil
+	}
+	if up.sessions > 0 {
+		return
+	}
+	up.idle = time.AfterFunc(s.opts.IdleTimeout, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if up.sessions == 0 && s.upstreams[up.name] == up {
+			delete(s.upstreams, up.name)
+			up.closing = true
+			up.cli.Close()
+		}
+	})
+}
+
+// proxy proxies the channel of the client to a new channel of the upstream.
+func (s *Server) proxy(up *upstream, nc ssh.NewChannel) {
+	upCh, upReqs, err := up.conn.OpenChannel(nc.ChannelType(), nc.ExtraData())
+	if err != nil {
+		var openErr *ssh.OpenChannelError
+		if errors.As(err, &openErr) {
+			nc.Reject(openErr.Reason, openErr.Message)
+		} else {
+			nc.Reject(ssh.ConnectionFailed, err.Error())
+		}
+		return
+	}
+	ch, reqs, err := nc.Accept()
+	if err != nil {
+		upCh.Close()
+		return
+	}
+
+	s.mu.Lock()
+	up.sessions++
+	up.lastUsedAt = time.Now()
+	s.resetIdle(up)
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		up.sessions--
+		up.lastUsedAt = time.Now()
+		s.resetIdle(up)
+		s.mu.Unlock()
+	}()
+
+	// the channel of the client is closed after the outputs and the requests of the host such as
+	// exit-status are relayed.
+	var wg sync.WaitGroup
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
+		_, _ = io.Copy(ch, upCh)
+		_ = ch.CloseWrite()
+	}()
+	go func() {
+		defer wg.Done()
+		_, _ = io.Copy(ch.Stderr(), upCh.Stderr())
+	}()
+	go func() {
+		defer wg.Done()
+		forwardRequests(upReqs, ch)
+	}()
+	go func() {
+		_, _ = io.Copy(upCh, ch)
+		_ = upCh.CloseWrite()
+	}()
+	go func() {
+		_, _ = io.Copy(upCh.Stderr(), ch.Stderr())
+	}()
+	go func() {
+		forwardRequests(reqs, upCh)
+		// the client closed the channel.
+		upCh.Close()
+	}()
+	wg.Wait()
+	ch.Close()
+}
+
+func forwardRequests(reqs <-chan *ssh.Request, ch ssh.Channel) {
+	for req := range reqs {
+		ok, err := ch.SendRequest(req.Type, req.WantReply, req.Payload)
+		if req.WantReply {
+			req.Reply(ok && err == nil, nil)
+		}
+	}
+}
+
+// ReadStatus returns the status of the daemon listening on the socket.
+func ReadStatus(socket string) (*Status, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), controlTimeout)
+	defer cancel()
+	conn, err := zssh.DialMux(ctx, socket, "")
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	ok, b, err := conn.SendRequest(zssh.MuxRequestStatus, true, nil)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errors.New("mux: the status request is rejected")
+	}
+	var status Status
+	if err := json.Unmarshal(b, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// Stop stops the daemon listening on the socket.
+func Stop(socket string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), controlTimeout)
+	defer cancel()
+	conn, err := zssh.DialMux(ctx, socket, "")
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	ok, _, err := conn.SendRequest(zssh.MuxRequestStop, true, nil)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New("mux: the stop request is rejected")
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package profile
+
+import (
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+)
+
+const (
+	// DefaultName is the name of the builtin profile which uses the root directory as a workspace.
+	DefaultName = "default"
+
+	fileName     = "profiles.yaml"
+	workspaceDir = "profiles"
+)
+
+var (
+	ErrNotFound      = errors.New("profile not found")
+	ErrAlreadyExists = errors.New("profile already exists")
+
+	namePattern = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+)
+
+// Profile is a named workspace.
+type Profile struct {
+	Name      string `json:"name" yaml:"name"`
+	Workspace string `json:"workspace" yaml:"workspace"`
+}
+
+// Registry is the profiles registered in the profiles.yaml file of the root directory.
+type Registry struct {
+	Current  string     `yaml:"current,omitempty"`
+	Profiles []*Profile `yaml:"profiles,omitempty"`
+
+	rootDir string
+}
+
+// Load loads the Registry from the given root directory. It returns an empty Registry if no profiles file exists.
+func Load(rootDir string) (*Registry, error) {
+	r := Registry{rootDir: rootDir}
+	b, err := ioutil.ReadFile(filepath.Join(rootDir, fileName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &r, nil
+		}
+		return nil, err
+	}
+	if err := yaml.Unmarshal(b, &r); err != nil {
+		return nil, fmt.Errorf("parse %s: %v", fileName, err)
+	}
+	return &r, nil
+}
+
+// Save writes the Registry to the profiles file in the root directory.
+func (r *Registry) Save() error {
+	b, err := yaml.Marshal(r)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(r.rootDir, 0700); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(r.rootDir, fileName), b, 0600)
+}
+
+// List returns all profiles including the default profile.
+func (r *Registry) List() []*Profile {
+	return append([]*Profile{r.defaultProfile()}, r.Profiles...)
+}
+
+// Find returns the profile with the given name.
+func (r *Registry) Find(name string) (*Profile, error) {
+	if name == DefaultName {
+		return r.defaultProfile(), nil
+	}
+	for _, p := range r.Profiles {
+		if p.Name == name {
+			return p, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// Create registers a new profile. The workspace is "profiles/{name}" in the root directory if empty.
+func (r *Registry) Create(name, workspace string) (*Profile, error) {
+	if !namePattern.MatchString(name) {
+		return nil, fmt.Errorf("invalid profile name: %s", name)
+	}
+	if _, err := r.Find(name); err == nil {
+		return nil, ErrAlreadyExists
+	}
+	if workspace == "" {
+		workspace = filepath.Join(r.rootDir, workspaceDir, name)
+	}
+	workspace, err := filepath.Abs(workspace)
+	if err != nil {
+		return nil, err
+	}
+	p := Profile{Name: name, Workspace: workspace}
+	r.Profiles = append(r.Profiles, &p)
+	return &p, nil
+}
+
+// Use sets the profile with the given name to the current profile.
+func (r *Registry) Use(name string) error {
+	if _, err := r.Find(name); err != nil {
+		return err
+	}
+	r.Current = name
+	return nil
+}
+
+// CurrentName returns the name of the current profile.
+func (r *Registry) CurrentName() string {
+	if r.Current == "" {
+		return DefaultName
+	}
+	return r.Current
+}
+
+func (r *Registry) defaultProfile() *Profile {
+	return &Profile{Name: DefaultName, Workspace: r.rootDir}
+}
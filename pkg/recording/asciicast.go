@@ -0,0 +1,221 @@
+package recording
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Extension is the file extension of recordings.
+const Extension = ".cast"
+
+const (
+	// EventOutput is the type of events of the data written to the terminal.
+	EventOutput = "o"
+	// EventResize is the type of events of the size changes of the terminal. The data is "{width}x{height}".
+	EventResize = "r"
+)
+
+// Header is the first line of an asciicast v2 file.
+type Header struct {
+	Version   int               `json:"version"`
+	Width     int               `json:"width"`
+	Height    int               `json:"height"`
+	Timestamp int64             `json:"timestamp,omitempty"`
+	Title     string            `json:"title,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+}
+
+// Event is an event line of an asciicast v2 file which is encoded as [time, type, data].
+type Event struct {
+	// Time is the seconds since the start of the recording.
+	Time float64
+	Type string
+	Data string
+}
+
+func (e Event) MarshalJSON() ([]byte, error) {
+	return json.Marshal([]interface{}{e.Time, e.Type, e.Data})
+}
+
+func (e *Event) UnmarshalJSON(b []byte) error {
+	var fields []json.RawMessage
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return err
+	}
+	if len(fields) != 3 {
+		return fmt.Errorf("invalid event: %s", b)
+	}
+	if err := json.Unmarshal(fields[0], &e.Time); err != nil {
+		return fmt.Errorf("invalid event time: %v", err)
+	}
+	if err := json.Unmarshal(fields[1], &e.Type); err != nil {
+		return fmt.Errorf("invalid event type: %v", err)
+	}
+	return json.Unmarshal(fields[2], &e.Data)
+}
+
+// Recorder writes the output and the size changes of a terminal to an asciicast v2 file.
+// Errors while recording do not fail writes, and are returned by Close instead.
+type Recorder struct {
+	Path string
+
+	mu      sync.Mutex
+	f       *os.File
+	enc     *json.Encoder
+	title   string
+	env     map[string]string
+	start   time.Time
+	pending []byte
+	err     error
+}
+
+// NewRecorder creates the recording file of the given path. The header is written when Start is called.
+func NewRecorder(path, title string, env map[string]string) (*Recorder, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &Recorder{Path: path, f: f, enc: json.NewEncoder(f), title: title, env: env}, nil
+}
+
+// Start writes the header with the initial size of the terminal and starts the clock of events.
+func (r *Recorder) Start(width, height int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.start = time.Now()
+	return r.encode(&Header{
+		Version:   2,
+		Width:     width,
+		Height:    height,
+		Timestamp: r.start.Unix(),
+		Title:     r.title,
+		Env:       r.env,
+	})
+}
+
+// Write records the output of the terminal. An incomplete UTF-8 sequence at the end is kept
+// until the next write so that events are valid strings.
+func (r *Recorder) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	data := append(r.pending, p...)
+	n := completeUTF8(data)
+	r.pending = append([]byte(nil), data[n:]...)
+	if n > 0 {
+		_ = r.event(EventOutput, string(data[:n]))
+	}
+	return len(p), nil
+}
+
+// Resize records the size change of the terminal.
+func (r *Recorder) Resize(width, height int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.event(EventResize, fmt.Sprintf("%dx%d", width, height))
+}
+
+// Close writes the pending output and closes the file. It returns the first error while recording.
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.pending) > 0 {
+		_ = r.event(EventOutput, string(r.pending))
+		r.pending = nil
+	}
+	if err := r.f.Close(); err != nil && r.err == nil {
+		r.err = err
+	}
+	return r.err
+}
+
+func (r *Recorder) event(typ, data string) error {
+	return r.encode(Event{Time: time.Since(r.start).Seconds(), Type: typ, Data: data})
+}
+
+func (r *Recorder) encode(v interface{}) error {
+	if r.err != nil {
+		return r.err
+	}
+	r.err = r.enc.Encode(v)
+	return r.err
+}
+
+// completeUTF8 returns the length of the given bytes without an incomplete UTF-8 sequence at the end.
+func completeUTF8(b []byte) int {
+	for i := len(b) - 1; i >= 0 && i >= len(b)-utf8.UTFMax; i-- {
+		if !utf8.RuneStart(b[i]) {
+			continue
+		}
+		if utf8.FullRune(b[i:]) {
+			return len(b)
+		}
+		return i
+	}
+	return len(b)
+}
+
+// Cast is a recording read from an asciicast v2 file.
+type Cast struct {
+	Header Header
+	Events []Event
+}
+
+// Duration returns the time of the last event.
+func (c *Cast) Duration() time.Duration {
+	if len(c.Events) == 0 {
+		return 0
+	}
+	return seconds(c.Events[len(c.Events)-1].Time)
+}
+
+// Read reads the asciicast v2 file of the given path.
+func Read(path string) (*Cast, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var c Cast
+	s := bufio.NewScanner(f)
+	s.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	if !s.Scan() {
+		if err := s.Err(); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%s: empty recording", path)
+	}
+	if err := json.Unmarshal(s.Bytes(), &c.Header); err != nil {
+		return nil, fmt.Errorf("%s: invalid header: %v", path, err)
+	}
+	if c.Header.Version != 2 {
+		return nil, fmt.Errorf("%s: unsupported asciicast version: %d", path, c.Header.Version)
+	}
+	for line := 2; s.Scan(); line++ {
+		if len(s.Bytes()) == 0 {
+			continue
+		}
+		var e Event
+		if err := json.Unmarshal(s.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, line, err)
+		}
+		c.Events = append(c.Events, e)
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
@@ -0,0 +1,150 @@
+package recording
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Info is the summary of a recording file in the directory of recordings.
+type Info struct {
+	// Name is the path relative to the directory such as "{escaped host}/{time}.cast".
+	Name      string    `json:"name"`
+	Host      string    `json:"host"`
+	Title     string    `json:"title"`
+	Path      string    `json:"path"`
+	Width     int       `json:"width"`
+	Height    int       `json:"height"`
+	StartedAt time.Time `json:"startedAt"`
+	// Duration is the seconds of the recording.
+	Duration float64 `json:"duration"`
+	Size     int64   `json:"size"`
+}
+
+func (i *Info) String() string {
+	return fmt.Sprintf("%s (started: %s, duration: %s, size: %dx%d, %d bytes)", i.Name,
+		i.StartedAt.Format(time.RFC3339), seconds(i.Duration).Round(time.Second), i.Width, i.Height, i.Size)
+}
+
+// FileName returns the path of a new recording of the host in the directory.
+func FileName(dir, hostName string, startedAt time.Time) string {
+	return filepath.Join(dir, hostDir(hostName), startedAt.Format("20060102-150405")+Extension)
+}
+
+// hostDir returns the escaped name of the directory of the host, so that the name cannot refer to
+// other directories.
+func hostDir(hostName string) string {
+	escaped := url.PathEscape(hostName)
+	if escaped == "." || escaped == ".." {
+		return strings.ReplaceAll(escaped, ".", "%2E")
+	}
+	return escaped
+}
+
+// hostOfDir returns the name of the host of the directory escaped by hostDir.
+func hostOfDir(dir string) string {
+	if hostName, err := url.PathUnescape(dir); err == nil {
+		return hostName
+	}
+	return dir
+}
+
+// List returns recordings in the directory of the given host, or all hosts if empty, sorted by the start time.
+// Files which are not valid recordings are skipped.
+func List(dir, hostName string) ([]*Info, error) {
+	pattern := filepath.Join(dir, "*", "*"+Extension)
+	if hostName != "" {
+		pattern = filepath.Join(dir, hostDir(hostName), "*"+Extension)
+	}
+	paths, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]*Info, 0, len(paths))
+	for _, path := range paths {
+		stat, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		c, err := Read(path)
+		if err != nil {
+			continue
+		}
+		name, _ := filepath.Rel(dir, path)
+		infos = append(infos, &Info{
+			Name:      filepath.ToSlash(name),
+			Host:      hostOfDir(filepath.Base(filepath.Dir(path))),
+			Title:     c.Header.Title,
+			Path:      path,
+			Width:     c.Header.Width,
+			Height:    c.Header.Height,
+			StartedAt: time.Unix(c.Header.Timestamp, 0),
+			Duration:  c.Duration().Seconds(),
+			Size:      stat.Size(),
+		})
+	}
+	sort.SliceStable(infos, func(i, j int) bool {
+		return infos[i].StartedAt.Before(infos[j].StartedAt)
+	})
+	return infos, nil
+}
+
+// Resolve returns the path of the given recording name relative to the directory, or the name itself
+// if it is a path of an existing file.
+func Resolve(dir, name string) string {
+	if _, err := os.Stat(name); err == nil {
+		return name
+	}
+	if !strings.HasSuffix(name, Extension) {
+		name += Extension
+	}
+	return filepath.Join(dir, filepath.FromSlash(name))
+}
+
+// PlayOptions are options of Play.
+type PlayOptions struct {
+	// Speed is the multiplier of the playback speed. Default is 1.
+	Speed float64
+	// IdleLimit is the maximum wait between events. Zero means no limit.
+	IdleLimit time.Duration
+}
+
+// Play writes the output events of the recording to the writer with the recorded timing
+// until the end or the context is done.
+func Play(ctx context.Context, w io.Writer, c *Cast, opts *PlayOptions) error {
+	speed := opts.Speed
+	if speed <= 0 {
+		speed = 1
+	}
+	var last time.Duration
+	for _, e := range c.Events {
+		at := seconds(e.Time)
+		wait := at - last
+		last = at
+		if opts.IdleLimit > 0 && wait > opts.IdleLimit {
+			wait = opts.IdleLimit
+		}
+		if wait > 0 {
+			timer := time.NewTimer(time.Duration(float64(wait) / speed))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return ctx.Err()
+			case <-timer.C:
+			}
+		}
+		if e.Type != EventOutput {
+			continue
+		}
+		if _, err := io.WriteString(w, e.Data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
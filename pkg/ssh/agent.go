@@ -0,0 +1,84 @@
+package ssh
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"io/ioutil"
+	"net"
+	"os"
+)
+
+// ErrNoAgent is returned if the agent forwarding is requested without the local ssh agent.
+var ErrNoAgent = errors.New("no ssh agent. SSH_AUTH_SOCK is not set")
+
+// forwardAgent connects to the local ssh agent of SSH_AUTH_SOCK and serves agent requests of the remote
+// host on the given connection with it. The returned connection of the agent should be closed.
+func forwardAgent(conn *ssh.Client) (net.Conn, error) {
+	socket := os.Getenv("SSH_AUTH_SOCK")
+	if socket == "" {
+		return nil, ErrNoAgent
+	}
+	agentConn, err := net.Dial("unix", socket)
+	if err != nil {
+		return nil, err
+	}
+	if err := agent.ForwardToAgent(conn, agent.NewClient(agentConn)); err != nil {
+		agentConn.Close()
+		return nil, err
+	}
+	return agentConn, nil
+}
+
+// requestAgentForwarding requests the agent forwarding on the session if the Client forwards the agent.
+func (c *Client) requestAgentForwarding(session *ssh.Session) error {
+	if c.agentConn == nil {
+		return nil
+	}
+	return agent.RequestAgentForwarding(session)
+}
+
+// agentAuthMethod returns the auth method which signs with the keys of the agent listening on the socket.
+// Only the key of the public key file is used if it exists. The returned connection should be closed.
+func agentAuthMethod(socket, publicKeyPath string) (ssh.AuthMethod, net.Conn, error) {
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return nil, nil, fmt.Errorf("connect to the agent %s: %v", socket, err)
+	}
+	signers, err := agent.NewClient(conn).Signers()
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	if b, err := ioutil.ReadFile(publicKeyPath); err == nil {
+		if publicKey, _, _, _, err := ssh.ParseAuthorizedKey(b); err == nil {
+			signers = filterSigners(signers, publicKey)
+		}
+	}
+	if len(signers) == 0 {
+		conn.Close()
+		return nil, nil, fmt.Errorf("no keys of %s in the agent %s", publicKeyPath, socket)
+	}
+	return ssh.PublicKeys(signers...), conn, nil
+}
+
+// filterSigners returns signers of the public key or certificates of it.
+func filterSigners(signers []ssh.Signer, publicKey ssh.PublicKey) []ssh.Signer {
+	var filtered []ssh.Signer
+	for _, signer := range signers {
+		// keys of agent clients are *agent.Key, so parses the blob to find certificates.
+		key, err := ssh.ParsePublicKey(signer.PublicKey().Marshal())
+		if err != nil {
+			continue
+		}
+		if cert, ok := key.(*ssh.Certificate); ok {
+			key = cert.Key
+		}
+		if bytes.Equal(key.Marshal(), publicKey.Marshal()) {
+			filtered = append(filtered, signer)
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,96 @@
+package ssh
+
+import (
+	"fmt"
+	"golang.org/x/crypto/ssh"
+	"strings"
+)
+
+const (
+	authorizedKeysFile = "~/.ssh/authorized_keys"
+
+	authorizedKeyAdded   = "added"
+	authorizedKeyExists  = "exists"
+	authorizedKeyRemoved = "removed"
+	authorizedKeyAbsent  = "absent"
+)
+
+// AddAuthorizedKey appends the given public key in the authorized_keys format to ~/.ssh/authorized_keys
+// of the remote user unless it exists. The .ssh directory and the file are created with the permissions
+// required by sshd. It returns true if the key is added, or false if the key exists regardless of its comment.
+func (c *Client) AddAuthorizedKey(authorizedKey string) (bool, error) {
+	line, match, err := authorizedKeyMatch(authorizedKey)
+	if err != nil {
+		return false, err
+	}
+	script := fmt.Sprintf(`set -e
+umask 077
+mkdir -p ~/.ssh
+chmod 700 ~/.ssh
+touch %[1]s
+chmod 600 %[1]s
+if grep -qF %[2]s %[1]s; then
+  echo %[4]s
+else
+  if [ -s %[1]s ] && [ -n "$(tail -c 1 %[1]s)" ]; then echo >> %[1]s; fi
+  echo %[3]s >> %[1]s
+  echo %[5]s
+fi`, authorizedKeysFile, shellQuote(match), shellQuote(line), authorizedKeyExists, authorizedKeyAdded)
+	result, err := c.runScript(script)
+	if err != nil {
+		return false, err
+	}
+	return result == authorizedKeyAdded, nil
+}
+
+// RemoveAuthorizedKey removes lines of the given public key from ~/.ssh/authorized_keys of the remote user.
+// Other lines and the permission of the file are kept. It returns false if the key does not exist.
+func (c *Client) RemoveAuthorizedKey(authorizedKey string) (bool, error) {
+	_, match, err := authorizedKeyMatch(authorizedKey)
+	if err != nil {
+		return false, err
+	}
+	script := fmt.Sprintf(`set -e
+if [ -f %[1]s ] && grep -qF %[2]s %[1]s; then
+  tmp=$(mktemp ~/.ssh/authorized_keys.XXXXXX)
+  grep -vF %[2]s %[1]s > "$tmp" || true
+  cat "$tmp" > %[1]s
+  rm -f "$tmp"
+  echo %[3]s
+else
+  echo %[4]s
+fi`, authorizedKeysFile, shellQuote(match), authorizedKeyRemoved, authorizedKeyAbsent)
+	result, err := c.runScript(script)
+	if err != nil {
+		return false, err
+	}
+	return result == authorizedKeyRemoved, nil
+}
+
+func (c *Client) runScript(script string) (string, error) {
+	out, err := c.Output(script)
+	if err != nil {
+		return "", fmt.Errorf("%v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// authorizedKeyMatch parses the given public key and returns its line and "type base64" of it,
+// which matches the key in authorized_keys regardless of options and comments.
+func authorizedKeyMatch(authorizedKey string) (string, string, error) {
+	publicKey, comment, _, _, err := ssh.ParseAuthorizedKey([]byte(authorizedKey))
+	if err != nil {
+		return "", "", fmt.Errorf("invalid public key: %v", err)
+	}
+	match := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(publicKey)))
+	line := match
+	if comment != "" {
+		line += " " + comment
+	}
+	return line, match, nil
+}
+
+// shellQuote quotes the given value with single quotes for the posix shell.
+func shellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'"'"'`) + "'"
+}
@@ -0,0 +1,135 @@
+package ssh
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/zacscoding/zssh/pkg/host"
+	"golang.org/x/crypto/ssh"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// certSuffix is the suffix of the certificate file next to the private key, which is the same as OpenSSH.
+const certSuffix = "-cert.pub"
+
+// CertificateInfo is the details of an OpenSSH user certificate.
+type CertificateInfo struct {
+	Path        string    `json:"path"`
+	Type        string    `json:"type"`
+	KeyID       string    `json:"keyId"`
+	Serial      uint64    `json:"serial"`
+	Principals  []string  `json:"principals"`
+	ValidAfter  time.Time `json:"validAfter"`
+	ValidBefore time.Time `json:"validBefore"`
+	// CA is the fingerprint of the key which signed the certificate.
+	CA         string   `json:"ca"`
+	Extensions []string `json:"extensions"`
+}
+
+// CertificatePath returns the certificate path of the given host, which is the CertPath of the host or
+// "{KeyPath}-cert.pub" if it exists. It returns an empty string if the host does not have a certificate.
+func CertificatePath(info *host.ServerInfo) string {
+	if info.CertPath != "" {
+		return info.CertPath
+	}
+	if info.KeyPath == "" {
+		return ""
+	}
+	path := info.KeyPath + certSuffix
+	if _, err := os.Stat(path); err != nil {
+		return ""
+	}
+	return path
+}
+
+// ReadCertificate reads the OpenSSH certificate in the authorized_keys format from the given path.
+func ReadCertificate(path string) (*ssh.Certificate, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	publicKey, _, _, _, err := ssh.ParseAuthorizedKey(b)
+	if err != nil {
+		return nil, fmt.Errorf("parse the certificate %s: %v", path, err)
+	}
+	cert, ok := publicKey.(*ssh.Certificate)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a certificate but a public key", path)
+	}
+	return cert, nil
+}
+
+// NewCertificateInfo returns the details of the given certificate read from the path.
+func NewCertificateInfo(path string, cert *ssh.Certificate) *CertificateInfo {
+	info := CertificateInfo{
+		Path:        path,
+		Type:        cert.Key.Type(),
+		KeyID:       cert.KeyId,
+		Serial:      cert.Serial,
+		Principals:  cert.ValidPrincipals,
+		ValidAfter:  certTime(cert.ValidAfter),
+		ValidBefore: certTime(cert.ValidBefore),
+		CA:          ssh.FingerprintSHA256(cert.SignatureKey),
+	}
+	if info.Principals == nil {
+		info.Principals = []string{}
+	}
+	info.Extensions = make([]string, 0, len(cert.Extensions))
+	for name := range cert.Extensions {
+		info.Extensions = append(info.Extensions, name)
+	}
+	sort.Strings(info.Extensions)
+	return &info
+}
+
+// ValidateCertificate checks the given certificate is a user certificate which is valid at now for the user.
+// A certificate without principals is valid for any user.
+func ValidateCertificate(cert *ssh.Certificate, user string, now time.Time) error {
+	if cert.CertType != ssh.UserCert {
+		return fmt.Errorf("the certificate(%s) is not a user certificate", cert.KeyId)
+	}
+	unix := uint64(now.Unix())
+	if unix < cert.ValidAfter {
+		return fmt.Errorf("the certificate(%s) is not valid until %s", cert.KeyId, certTime(cert.ValidAfter).Format(time.RFC3339))
+	}
+	if cert.ValidBefore != ssh.CertTimeInfinity && unix >= cert.ValidBefore {
+		return fmt.Errorf("the certificate(%s) expired at %s", cert.KeyId, certTime(cert.ValidBefore).Format(time.RFC3339))
+	}
+	if len(cert.ValidPrincipals) == 0 {
+		return nil
+	}
+	for _, principal := range cert.ValidPrincipals {
+		if principal == user {
+			return nil
+		}
+	}
+	return fmt.Errorf("the certificate(%s) is not valid for the user %s. principals: %s",
+		cert.KeyId, user, strings.Join(cert.ValidPrincipals, ","))
+}
+
+// newCertSigner returns the signer of the certificate in the given path with the private key signer
+// after validating the certificate for the user.
+func newCertSigner(path string, signer ssh.Signer, user string) (ssh.Signer, error) {
+	cert, err := ReadCertificate(path)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(cert.Key.Marshal(), signer.PublicKey().Marshal()) {
+		return nil, fmt.Errorf("the certificate %s is not issued for the private key", path)
+	}
+	if err := ValidateCertificate(cert, user, time.Now()); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return ssh.NewCertSigner(cert, signer)
+}
+
+// certTime converts the given time of a certificate, and returns the zero time for 0 and the infinity.
+func certTime(t uint64) time.Time {
+	if t == 0 || t > uint64(1<<63-1) {
+		return time.Time{}
+	}
+	return time.Unix(int64(t), 0)
+}
@@ -0,0 +1,99 @@
+package ssh
+
+import (
+	"context"
+	"github.com/zacscoding/zssh/pkg/host"
+	"io"
+	"time"
+)
+
+// Option configures the Client created by Dial.
+type Option func(params *ClientParams)
+
+// Dial connects to the given host and returns the Client. Connecting to the host is aborted when the
+// context is done, and the context does not affect the returned Client.
+func Dial(ctx context.Context, info *host.ServerInfo, opts ...Option) (*Client, error) {
+	params := ClientParams{ServerInfo: info}
+	for _, opt := range opts {
+		opt(&params)
+	}
+	return NewClientContext(ctx, &params)
+}
+
+// WithConnectTimeout sets the maximum amount of time for each address of the host to connect.
+func WithConnectTimeout(timeout time.Duration) Option {
+	return func(params *ClientParams) {
+		params.ConnectTimeout = timeout
+	}
+}
+
+// WithAuthTimeout sets the maximum amount of time for the ssh handshake and the authentication.
+func WithAuthTimeout(timeout time.Duration) Option {
+	return func(params *ClientParams) {
+		params.AuthTimeout = timeout
+	}
+}
+
+// WithKnownHosts verifies the host key with the given known_hosts files. The strict verification
+// rejects the host which is not in the files.
+func WithKnownHosts(strict bool, files ...string) Option {
+	return func(params *ClientParams) {
+		params.KnownHosts = files
+		params.StrictHostKey = strict
+	}
+}
+
+// WithAgentSocket signs with the key of the host in the ssh agent listening on the given socket.
+func WithAgentSocket(socket string) Option {
+	return func(params *ClientParams) {
+		params.AgentSocket = socket
+	}
+}
+
+// WithForwardAgent forwards the local ssh agent of SSH_AUTH_SOCK to sessions of the Client.
+func WithForwardAgent() Option {
+	return func(params *ClientParams) {
+		params.ForwardAgent = true
+	}
+}
+
+// WithMuxSocket opens sessions over the connection of the mux daemon listening on the given socket if it is running.
+func WithMuxSocket(socket string) Option {
+	return func(params *ClientParams) {
+		params.MuxSocket = socket
+	}
+}
+
+// WithKeepAlive sends keepalive requests every interval and closes the connection if maxMissed
+// requests in a row are not replied.
+func WithKeepAlive(interval time.Duration, maxMissed int) Option {
+	return func(params *ClientParams) {
+		params.KeepAliveInterval = interval
+		params.KeepAliveMaxMissed = maxMissed
+	}
+}
+
+// WithStdio sets the standard input and outputs of Client.Run and Client.OpenShell. Nil values
+// keep the standard input and outputs of the process.
+func WithStdio(stdin io.Reader, stdout, stderr io.Writer) Option {
+	return func(params *ClientParams) {
+		params.StdIn = stdin
+		params.Stdout = stdout
+		params.Stderr = stderr
+	}
+}
+
+// WithTerminal sets the type and the baud rates of the pseudo terminal requested by Client.OpenShell.
+func WithTerminal(terminalType string, speed uint32) Option {
+	return func(params *ClientParams) {
+		params.TerminalType = terminalType
+		params.TerminalSpeed = speed
+	}
+}
+
+// WithRecorder records the shell opened by Client.OpenShell.
+func WithRecorder(recorder TerminalRecorder) Option {
+	return func(params *ClientParams) {
+		params.Recorder = recorder
+	}
+}
@@ -0,0 +1,175 @@
+package ssh
+
+import (
+	"bytes"
+	"context"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testRecorder struct{}
+
+func (testRecorder) Start(width, height int) error  { return nil }
+func (testRecorder) Write(p []byte) (int, error)    { return len(p), nil }
+func (testRecorder) Resize(width, height int) error { return nil }
+
+func TestOptions(t *testing.T) {
+	var stdin bytes.Buffer
+	var stdout, stderr bytes.Buffer
+	recorder := testRecorder{}
+	opts := []Option{
+		WithConnectTimeout(time.Second),
+		WithAuthTimeout(2 * time.Second),
+		WithKnownHosts(true, "a", "b"),
+		WithAgentSocket("agent.sock"),
+		WithForwardAgent(),
+		WithMuxSocket("mux.sock"),
+		WithKeepAlive(3*time.Second, 4),
+		WithStdio(&stdin, &stdout, &stderr),
+		WithTerminal("vt100", 9600),
+		WithRecorder(recorder),
+	}
+	var params ClientParams
+	for _, opt := range opts {
+		opt(&params)
+	}
+	want := ClientParams{
+		StdIn:              &stdin,
+		Stdout:             &stdout,
+		Stderr:             &stderr,
+		TerminalType:       "vt100",
+		TerminalSpeed:      9600,
+		ConnectTimeout:     time.Second,
+		AuthTimeout:        2 * time.Second,
+		KnownHosts:         []string{"a", "b"},
+		StrictHostKey:      true,
+		ForwardAgent:       true,
+		AgentSocket:        "agent.sock",
+		Recorder:           recorder,
+		MuxSocket:          "mux.sock",
+		KeepAliveInterval:  3 * time.Second,
+		KeepAliveMaxMissed: 4,
+	}
+	if !reflect.DeepEqual(params, want) {
+		t.Errorf("got %+v, want %+v", params, want)
+	}
+}
+
+func TestDial(t *testing.T) {
+	s := newTestServer(t)
+	cli := dialTestServer(t, s,
+		WithConnectTimeout(time.Second),
+		WithAuthTimeout(time.Second),
+		WithKeepAlive(time.Minute, 3),
+		// falls back to dial directly without the mux daemon.
+		WithMuxSocket(filepath.Join(t.TempDir(), "mux.sock")))
+	if cli.Address != s.addr || cli.Multiplexed {
+		t.Errorf("got address %s(multiplexed: %v), want %s", cli.Address, cli.Multiplexed, s.addr)
+	}
+	if cli.Conn() == nil {
+		t.Error("got no connection")
+	}
+
+	info := s.info()
+	info.Password = "wrong"
+	if _, err := Dial(context.Background(), info); err == nil {
+		t.Error("dialed with a wrong password")
+	}
+}
+
+// silentListener accepts connections and never replies to them.
+func silentListener(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		l.Close()
+	})
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			t.Cleanup(func() {
+				c.Close()
+			})
+		}
+	}()
+	return l.Addr().String()
+}
+
+func TestDialAuthTimeout(t *testing.T) {
+	s := &testServer{addr: silentListener(t)}
+	started := time.Now()
+	_, err := Dial(context.Background(), s.info(), WithAuthTimeout(200*time.Millisecond))
+	if err == nil || !strings.Contains(err.Error(), "ssh handshake timed out after 200ms") {
+		t.Fatalf("got %v, want the handshake timeout", err)
+	}
+	if elapsed := time.Since(started); elapsed > 2*time.Second {
+		t.Errorf("timed out after %s", elapsed)
+	}
+}
+
+func TestDialCanceled(t *testing.T) {
+	s := &testServer{addr: silentListener(t)}
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	if _, err := Dial(ctx, s.info()); err != context.DeadlineExceeded {
+		t.Fatalf("got %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestDialKnownHosts(t *testing.T) {
+	s := newTestServer(t)
+	dir := t.TempDir()
+	writeKnownHosts := func(name string, key ssh.PublicKey) string {
+		path := filepath.Join(dir, name)
+		content := ""
+		if key != nil {
+			content = knownhosts.Line([]string{knownhosts.Normalize(s.addr)}, key) + "\n"
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	other, err := ssh.NewSignerFromKey(mustEd25519Key(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	empty := writeKnownHosts("empty", nil)
+	known := writeKnownHosts("known", s.hostKey.PublicKey())
+	changed := writeKnownHosts("changed", other.PublicKey())
+
+	for _, tc := range []struct {
+		name    string
+		strict  bool
+		file    string
+		success bool
+	}{
+		{"unknown host", false, empty, true},
+		{"unknown host in strict", true, empty, false},
+		{"known host in strict", true, known, true},
+		{"changed host key", false, changed, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cli, err := Dial(context.Background(), s.info(), WithKnownHosts(tc.strict, tc.file))
+			if err == nil {
+				cli.Close()
+			}
+			if (err == nil) != tc.success {
+				t.Errorf("got %v, want success: %v", err, tc.success)
+			}
+		})
+	}
+}
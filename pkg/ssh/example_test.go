@@ -0,0 +1,73 @@
+package ssh_test
+
+import (
+	"context"
+	"fmt"
+	"github.com/zacscoding/zssh/pkg/host"
+	"github.com/zacscoding/zssh/pkg/ssh"
+	"log"
+	"time"
+)
+
+func ExampleDial() {
+	info := &host.ServerInfo{
+		Name:    "web",
+		User:    "ubuntu",
+		Address: "10.0.0.1",
+		Port:    22,
+		KeyPath: "/home/me/.ssh/id_ed25519",
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	cli, err := ssh.Dial(ctx, info,
+		ssh.WithConnectTimeout(5*time.Second),
+		ssh.WithKnownHosts(true, "/home/me/.ssh/known_hosts"),
+		ssh.WithKeepAlive(30*time.Second, 3))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer cli.Close()
+	fmt.Println("connected to", cli.Address)
+}
+
+func ExampleSession_Output() {
+	info := &host.ServerInfo{Name: "web", User: "ubuntu", Address: "10.0.0.1", Port: 22, Password: "secret"}
+	cli, err := ssh.Dial(context.Background(), info)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer cli.Close()
+
+	session, err := cli.NewSession()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer session.Close()
+
+	// the command receives SIGTERM if it does not exit in 10 seconds.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	out, err := session.Output(ctx, "uname -a")
+	if err != nil {
+		log.Fatalf("exit status %d: %v", ssh.ExitStatus(err), err)
+	}
+	fmt.Print(string(out))
+}
+
+func ExampleClient_Conn() {
+	info := &host.ServerInfo{Name: "db", User: "ubuntu", Address: "10.0.0.2", Port: 22, Password: "secret"}
+	cli, err := ssh.Dial(context.Background(), info)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer cli.Close()
+
+	// connects to the database which listens on the loopback of the host.
+	conn, err := cli.Conn().Dial("tcp", "127.0.0.1:5432")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer conn.Close()
+	fmt.Println("forwarded to", conn.RemoteAddr())
+}
@@ -0,0 +1,73 @@
+package ssh
+
+import (
+	"errors"
+	"time"
+)
+
+const keepAliveRequest = "keepalive@openssh.com"
+
+// ErrConnectionLost is returned by sessions of the Client whose connection is closed because the host
+// did not reply to keepalive requests.
+var ErrConnectionLost = errors.New("connection lost. no replies to keepalive requests")
+
+// keepAlive sends keepalive requests to the host every interval, and closes the connection if maxMissed
+// requests in a row are not replied. Any reply, even a failure, means the host is alive.
+func (c *Client) keepAlive(interval time.Duration, maxMissed int) {
+	if maxMissed < 1 {
+		maxMissed = 1
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	// at most one request is in flight, so the buffered channel never blocks the sender.
+	replies := make(chan error, 1)
+	pending, missed := false, 0
+	for {
+		select {
+		case <-c.closed:
+			return
+		case err := <-replies:
+			pending = false
+			if err != nil {
+				// the connection is already closed.
+				return
+			}
+			missed = 0
+		case <-ticker.C:
+			if pending {
+				missed++
+				if missed >= maxMissed {
+					c.connectionLost()
+					return
+				}
+				continue
+			}
+			pending = true
+			go func() {
+				_, _, err := c.conn.SendRequest(keepAliveRequest, true, nil)
+				replies <- err
+			}()
+		}
+	}
+}
+
+// connectionLost marks the connection as lost and closes it so that sessions return.
+func (c *Client) connectionLost() {
+	c.lostOnce.Do(func() {
+		close(c.lost)
+	})
+	c.conn.Close()
+}
+
+// sessionError returns ErrConnectionLost if the connection is lost, otherwise the given error.
+func (c *Client) sessionError(err error) error {
+	if err == nil {
+		return nil
+	}
+	select {
+	case <-c.lost:
+		return ErrConnectionLost
+	default:
+		return err
+	}
+}
@@ -0,0 +1,48 @@
+package ssh
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestKeepAlive(t *testing.T) {
+	cli := dialTestServer(t, newTestServer(t), WithKeepAlive(20*time.Millisecond, 1))
+
+	// replies to keepalives keep the connection.
+	time.Sleep(200 * time.Millisecond)
+	out, err := cli.OutputContext(context.Background(), "echo alive")
+	if err != nil || string(out) != "alive\n" {
+		t.Fatalf("got %q, %v", out, err)
+	}
+}
+
+func TestKeepAliveConnectionLost(t *testing.T) {
+	s := newTestServer(t)
+	cli := dialTestServer(t, s, WithKeepAlive(50*time.Millisecond, 2))
+
+	// the session is closed with the connection.
+	session, err := cli.NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := session.Start("sleep"); err != nil {
+		t.Fatal(err)
+	}
+	s.setBlackhole(true)
+	done := make(chan error, 1)
+	go func() {
+		done <- session.Wait(context.Background())
+	}()
+	select {
+	case err := <-done:
+		if err != ErrConnectionLost {
+			t.Fatalf("got %v, want %v", err, ErrConnectionLost)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the lost connection is not detected")
+	}
+	if _, err := cli.NewSession(); err != ErrConnectionLost {
+		t.Errorf("new session: got %v, want %v", err, ErrConnectionLost)
+	}
+}
@@ -0,0 +1,155 @@
+package ssh
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+)
+
+const markerCertAuthority = "@cert-authority"
+
+// certAuthority is a @cert-authority entry of known_hosts files.
+type certAuthority struct {
+	patterns []string
+	key      ssh.PublicKey
+}
+
+// NewHostKeyCallback returns a callback which verifies host keys with the given known_hosts files.
+// Host certificates signed by the keys of @cert-authority entries are trusted, and files which do not exist
+// are skipped. A host key which differs from the known key is always rejected, while unknown hosts are
+// accepted unless strict is true.
+func NewHostKeyCallback(files []string, strict bool) (ssh.HostKeyCallback, error) {
+	var existing []string
+	for _, file := range files {
+		if _, err := os.Stat(file); err == nil {
+			existing = append(existing, file)
+		}
+	}
+	if len(existing) == 0 {
+		if strict {
+			return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+				return fmt.Errorf("the host key of %s is unknown. no known_hosts files", hostname)
+			}, nil
+		}
+		return ssh.InsecureIgnoreHostKey(), nil
+	}
+	callback, err := knownhosts.New(existing...)
+	if err != nil {
+		return nil, err
+	}
+	authorities, err := readCertAuthorities(existing)
+	if err != nil {
+		return nil, err
+	}
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		if cert, ok := key.(*ssh.Certificate); ok {
+			if trustsCertificate(authorities, hostname, cert) {
+				checker := ssh.CertChecker{
+					IsHostAuthority: func(auth ssh.PublicKey, address string) bool {
+						return true
+					},
+				}
+				return checker.CheckHostKey(hostname, remote, key)
+			}
+			// checks the key of an untrusted certificate as a plain host key like OpenSSH.
+			key = cert.Key
+		}
+		err := callback(hostname, remote, key)
+		var keyErr *knownhosts.KeyError
+		if errors.As(err, &keyErr) && len(keyErr.Want) == 0 {
+			if strict {
+				return fmt.Errorf("the host key of %s is unknown. %s", hostname, ssh.FingerprintSHA256(key))
+			}
+			return nil
+		}
+		return err
+	}, nil
+}
+
+// readCertAuthorities reads @cert-authority entries of the given known_hosts files.
+func readCertAuthorities(files []string) ([]*certAuthority, error) {
+	var authorities []*certAuthority
+	for _, file := range files {
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		s := bufio.NewScanner(bytes.NewReader(b))
+		for s.Scan() {
+			fields := strings.Fields(s.Text())
+			if len(fields) < 3 || fields[0] != markerCertAuthority {
+				continue
+			}
+			key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(strings.Join(fields[2:], " ")))
+			if err != nil {
+				return nil, fmt.Errorf("%s: invalid %s entry: %v", file, markerCertAuthority, err)
+			}
+			authorities = append(authorities, &certAuthority{patterns: strings.Split(fields[1], ","), key: key})
+		}
+		if err := s.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return authorities, nil
+}
+
+// trustsCertificate returns true if the certificate is signed by an authority of the host.
+func trustsCertificate(authorities []*certAuthority, hostname string, cert *ssh.Certificate) bool {
+	name := knownhosts.Normalize(hostname)
+	for _, authority := range authorities {
+		if bytes.Equal(authority.key.Marshal(), cert.SignatureKey.Marshal()) && matchHostPatterns(authority.patterns, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchHostPatterns matches the normalized host name with the patterns of known_hosts like OpenSSH,
+// where a negated pattern excludes the host even if the other patterns match.
+func matchHostPatterns(patterns []string, name string) bool {
+	matched := false
+	for _, pattern := range patterns {
+		if strings.HasPrefix(pattern, "!") {
+			if wildcardMatch(pattern[1:], name) {
+				return false
+			}
+			continue
+		}
+		if wildcardMatch(pattern, name) {
+			matched = true
+		}
+	}
+	return matched
+}
+
+// wildcardMatch matches the string with the pattern of '*' and '?' wildcards.
+func wildcardMatch(pattern, s string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for i := len(s); i >= 0; i-- {
+				if wildcardMatch(pattern[1:], s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(s) == 0 {
+				return false
+			}
+		default:
+			if len(s) == 0 || pattern[0] != s[0] {
+				return false
+			}
+		}
+		pattern, s = pattern[1:], s[1:]
+	}
+	return len(s) == 0
+}
@@ -0,0 +1,62 @@
+package ssh
+
+import (
+	"context"
+	"fmt"
+	"github.com/zacscoding/zssh/pkg/host"
+	"golang.org/x/crypto/ssh"
+	"net"
+)
+
+// Global requests of the mux daemon. Connections to the daemon use the host name as the user name,
+// and the empty user name for the control requests.
+const (
+	// MuxRequestAddress replies the address of the host which the connection is multiplexed to.
+	MuxRequestAddress = "address@zssh"
+	// MuxRequestStatus replies the status of the daemon in json.
+	MuxRequestStatus = "status@zssh"
+	// MuxRequestStop stops the daemon.
+	MuxRequestStop = "stop@zssh"
+)
+
+// DialMux connects to the mux daemon listening on the socket as the given user. The socket is only
+// accessible by the user, so the host key of the daemon is not verified.
+func DialMux(ctx context.Context, socket, user string) (*ssh.Client, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "unix", socket)
+	if err != nil {
+		return nil, err
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+	c, chans, reqs, err := ssh.NewClientConn(conn, socket, &ssh.ClientConfig{
+		User:            user,
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	})
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return ssh.NewClient(c, chans, reqs), nil
+}
+
+// dialMux opens the connection to the host through the mux daemon and returns it with the address of the host.
+func dialMux(ctx context.Context, socket string, info *host.ServerInfo) (*ssh.Client, string, error) {
+	conn, err := DialMux(ctx, socket, info.Name)
+	if err != nil {
+		return nil, "", err
+	}
+	ok, addr, err := conn.SendRequest(MuxRequestAddress, true, nil)
+	if err != nil || !ok {
+		conn.Close()
+		return nil, "", fmt.Errorf("get the address of %s from the mux: %v", info.Name, err)
+	}
+	return conn, string(addr), nil
+}
@@ -0,0 +1,11 @@
+//go:build windows
+// +build windows
+
+package ssh
+
+import (
+	"os"
+)
+
+// notifyResize does nothing because windows does not signal the size changes of the console.
+func notifyResize(c chan<- os.Signal) {}
@@ -0,0 +1,227 @@
+package ssh
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"fmt"
+	"github.com/zacscoding/zssh/pkg/host"
+	"golang.org/x/crypto/ssh"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const (
+	testUser     = "tester"
+	testPassword = "secret"
+)
+
+// testServer is an in-process ssh server which runs fake commands:
+//
+//	echo [words]  prints the words
+//	fail          prints "out" to stdout, "err" to stderr and exits with 3
+//	cat           copies stdin to stdout
+//	env [name]    prints the environment variable set by the session
+//	sleep         waits for a signal and exits with 128+15 on SIGTERM
+//	ignore        ignores signals and waits until the session is closed
+type testServer struct {
+	addr    string
+	hostKey ssh.Signer
+
+	mu        sync.Mutex
+	signals   []string
+	blackhole bool
+	// closed receives when a session is closed by the client.
+	closed chan struct{}
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	hostKey, err := ssh.NewSignerFromKey(mustEd25519Key(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if conn.User() == testUser && string(password) == testPassword {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("permission denied")
+		},
+	}
+	config.AddHostKey(hostKey)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &testServer{addr: l.Addr().String(), hostKey: hostKey, closed: make(chan struct{}, 16)}
+	var (
+		connsMu sync.Mutex
+		conns   []net.Conn
+	)
+	t.Cleanup(func() {
+		l.Close()
+		connsMu.Lock()
+		defer connsMu.Unlock()
+		for _, c := range conns {
+			c.Close()
+		}
+	})
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			connsMu.Lock()
+			conns = append(conns, c)
+			connsMu.Unlock()
+			go s.serveConn(c, config)
+		}
+	}()
+	return s
+}
+
+func mustEd25519Key(t *testing.T) ed25519.PrivateKey {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// info returns the host of the server which logs in with the password.
+func (s *testServer) info() *host.ServerInfo {
+	address, port, _ := net.SplitHostPort(s.addr)
+	p, _ := strconv.Atoi(port)
+	return &host.ServerInfo{Name: "test", User: testUser, Password: testPassword, Address: address, Port: p}
+}
+
+// setBlackhole stops replying to global requests such as keepalives if true.
+func (s *testServer) setBlackhole(blackhole bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.blackhole = blackhole
+}
+
+// receivedSignals returns the signals received by sessions.
+func (s *testServer) receivedSignals() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.signals...)
+}
+
+func (s *testServer) serveConn(c net.Conn, config *ssh.ServerConfig) {
+	_, chans, reqs, err := ssh.NewServerConn(c, config)
+	if err != nil {
+		c.Close()
+		return
+	}
+	go func() {
+		for req := range reqs {
+			s.mu.Lock()
+			blackhole := s.blackhole
+			s.mu.Unlock()
+			if !blackhole && req.WantReply {
+				req.Reply(false, nil)
+			}
+		}
+	}()
+	for nc := range chans {
+		if nc.ChannelType() != "session" {
+			nc.Reject(ssh.UnknownChannelType, nc.ChannelType())
+			continue
+		}
+		ch, reqs, err := nc.Accept()
+		if err != nil {
+			continue
+		}
+		go s.serveSession(ch, reqs)
+	}
+}
+
+func (s *testServer) serveSession(ch ssh.Channel, reqs <-chan *ssh.Request) {
+	env := make(map[string]string)
+	signals := make(chan string, 1)
+	done := make(chan struct{})
+	for req := range reqs {
+		switch req.Type {
+		case "env":
+			var payload struct{ Name, Value string }
+			if err := ssh.Unmarshal(req.Payload, &payload); err == nil {
+				env[payload.Name] = payload.Value
+			}
+			req.Reply(true, nil)
+		case "exec":
+			var payload struct{ Command string }
+			if err := ssh.Unmarshal(req.Payload, &payload); err != nil {
+				req.Reply(false, nil)
+				continue
+			}
+			req.Reply(true, nil)
+			go s.run(ch, payload.Command, env, signals, done)
+		case "signal":
+			var payload struct{ Signal string }
+			if err := ssh.Unmarshal(req.Payload, &payload); err == nil {
+				s.mu.Lock()
+				s.signals = append(s.signals, payload.Signal)
+				s.mu.Unlock()
+				select {
+				case signals <- payload.Signal:
+				default:
+				}
+			}
+		default:
+			if req.WantReply {
+				req.Reply(false, nil)
+			}
+		}
+	}
+	close(done)
+	s.closed <- struct{}{}
+}
+
+func (s *testServer) run(ch ssh.Channel, command string, env map[string]string, signals <-chan string, done <-chan struct{}) {
+	exit := func(status int) {
+		_, _ = ch.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{uint32(status)}))
+		ch.Close()
+	}
+	fields := strings.Fields(command)
+	switch fields[0] {
+	case "echo":
+		fmt.Fprintln(ch, strings.Join(fields[1:], " "))
+		exit(0)
+	case "fail":
+		fmt.Fprintln(ch, "out")
+		fmt.Fprintln(ch.Stderr(), "err")
+		exit(3)
+	case "cat":
+		_, _ = io.Copy(ch, ch)
+		exit(0)
+	case "env":
+		fmt.Fprintln(ch, env[fields[1]])
+		exit(0)
+	case "sleep":
+		for {
+			select {
+			case sig := <-signals:
+				if sig == string(ssh.SIGTERM) {
+					exit(128 + 15)
+					return
+				}
+			case <-done:
+				return
+			}
+		}
+	case "ignore":
+		<-done
+	default:
+		fmt.Fprintf(ch.Stderr(), "%s: command not found\n", fields[0])
+		exit(127)
+	}
+}
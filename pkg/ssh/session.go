@@ -0,0 +1,133 @@
+package ssh
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"golang.org/x/crypto/ssh"
+	"io"
+	"sync"
+)
+
+// Session runs a command on the remote host. Set Stdin, Stdout and Stderr before the command starts.
+// Nil Stdout and Stderr discard the outputs, and nil Stdin reads nothing.
+type Session struct {
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+
+	client  *Client
+	session *ssh.Session
+}
+
+// NewSession opens a new Session on the connection of the Client. The agent forwarding is requested
+// on the session if the Client forwards the agent.
+func (c *Client) NewSession() (*Session, error) {
+	session, err := c.conn.NewSession()
+	if err != nil {
+		return nil, c.sessionError(err)
+	}
+	if err := c.requestAgentForwarding(session); err != nil {
+		session.Close()
+		return nil, err
+	}
+	return &Session{client: c, session: session}, nil
+}
+
+// Setenv sets the environment variable of the command. The host may reject it, e.g. by AcceptEnv of sshd.
+func (s *Session) Setenv(name, value string) error {
+	return s.session.Setenv(name, value)
+}
+
+// StdinPipe returns the pipe connected to the standard input of the command. It should be called before Start.
+func (s *Session) StdinPipe() (io.WriteCloser, error) {
+	return s.session.StdinPipe()
+}
+
+// StdoutPipe returns the pipe connected to the standard output of the command. It should be called before Start.
+func (s *Session) StdoutPipe() (io.Reader, error) {
+	return s.session.StdoutPipe()
+}
+
+// StderrPipe returns the pipe connected to the standard error of the command. It should be called before Start.
+func (s *Session) StderrPipe() (io.Reader, error) {
+	return s.session.StderrPipe()
+}
+
+// Start starts the given cmd without waiting for it to exit.
+func (s *Session) Start(cmd string) error {
+	if s.Stdin != nil {
+		s.session.Stdin = s.Stdin
+	}
+	if s.Stdout != nil {
+		s.session.Stdout = s.Stdout
+	}
+	if s.Stderr != nil {
+		s.session.Stderr = s.Stderr
+	}
+	return s.client.sessionError(s.session.Start(cmd))
+}
+
+// Wait waits for the started command to exit. If the context is done first, the command receives SIGTERM
+// and the session is closed after a grace period, and the error of the context is returned.
+// The error is *ssh.ExitError of golang.org/x/crypto/ssh if the command exits with a non-zero status,
+// and ErrConnectionLost if the connection is closed by keepalives. See ExitStatus.
+func (s *Session) Wait(ctx context.Context) error {
+	return s.client.sessionError(waitContext(ctx, s.session))
+}
+
+// Run runs the given cmd and waits for it to exit like Wait.
+func (s *Session) Run(ctx context.Context, cmd string) error {
+	if err := s.Start(cmd); err != nil {
+		return err
+	}
+	return s.Wait(ctx)
+}
+
+// Output runs the given cmd like Run and returns its standard output.
+func (s *Session) Output(ctx context.Context, cmd string) ([]byte, error) {
+	if s.Stdout != nil {
+		return nil, errors.New("stdout of the session is already set")
+	}
+	var stdout bytes.Buffer
+	s.Stdout = &stdout
+	err := s.Run(ctx, cmd)
+	return stdout.Bytes(), err
+}
+
+// CombinedOutput runs the given cmd like Run and returns its standard output and standard error.
+func (s *Session) CombinedOutput(ctx context.Context, cmd string) ([]byte, error) {
+	if s.Stdout != nil || s.Stderr != nil {
+		return nil, errors.New("stdout or stderr of the session is already set")
+	}
+	out := &lockedBuffer{}
+	s.Stdout, s.Stderr = out, out
+	err := s.Run(ctx, cmd)
+	return out.Bytes(), err
+}
+
+// Close closes the session. Closing the session of the exited command is not an error.
+func (s *Session) Close() error {
+	if err := s.session.Close(); err != nil && err != io.EOF {
+		return err
+	}
+	return nil
+}
+
+// lockedBuffer is the buffer written by both outputs of the command concurrently.
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) Bytes() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Bytes()
+}
@@ -0,0 +1,235 @@
+package ssh
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func dialTestServer(t *testing.T, s *testServer, opts ...Option) *Client {
+	t.Helper()
+	cli, err := Dial(context.Background(), s.info(), opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		cli.Close()
+	})
+	return cli
+}
+
+func newTestSession(t *testing.T, cli *Client) *Session {
+	t.Helper()
+	session, err := cli.NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := session.Close(); err != nil {
+			t.Errorf("close the session: %v", err)
+		}
+	})
+	return session
+}
+
+func TestSessionRun(t *testing.T) {
+	cli := dialTestServer(t, newTestServer(t))
+
+	session := newTestSession(t, cli)
+	var stdout bytes.Buffer
+	session.Stdout = &stdout
+	if err := session.Run(context.Background(), "echo hello world"); err != nil {
+		t.Fatal(err)
+	}
+	if got := stdout.String(); got != "hello world\n" {
+		t.Errorf("got stdout %q", got)
+	}
+
+	session = newTestSession(t, cli)
+	var stderr bytes.Buffer
+	session.Stderr = &stderr
+	err := session.Run(context.Background(), "fail")
+	if status := ExitStatus(err); status != 3 {
+		t.Errorf("got exit status %d(%v), want 3", status, err)
+	}
+	if got := stderr.String(); got != "err\n" {
+		t.Errorf("got stderr %q", got)
+	}
+}
+
+func TestSessionOutput(t *testing.T) {
+	cli := dialTestServer(t, newTestServer(t))
+
+	session := newTestSession(t, cli)
+	out, err := session.Output(context.Background(), "echo hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != "hello\n" {
+		t.Errorf("got %q", out)
+	}
+
+	session = newTestSession(t, cli)
+	session.Stdout = &bytes.Buffer{}
+	if _, err := session.Output(context.Background(), "echo hello"); err == nil {
+		t.Error("got no error with stdout already set")
+	}
+
+	session = newTestSession(t, cli)
+	if out, err = session.Output(context.Background(), "fail"); ExitStatus(err) != 3 || string(out) != "out\n" {
+		t.Errorf("got %q, %v, want stdout and exit status 3", out, err)
+	}
+}
+
+func TestSessionCombinedOutput(t *testing.T) {
+	cli := dialTestServer(t, newTestServer(t))
+
+	session := newTestSession(t, cli)
+	out, err := session.CombinedOutput(context.Background(), "fail")
+	if status := ExitStatus(err); status != 3 {
+		t.Errorf("got exit status %d(%v), want 3", status, err)
+	}
+	if !strings.Contains(string(out), "out\n") || !strings.Contains(string(out), "err\n") || len(out) != 8 {
+		t.Errorf("got %q, want stdout and stderr", out)
+	}
+
+	session = newTestSession(t, cli)
+	session.Stderr = &bytes.Buffer{}
+	if _, err := session.CombinedOutput(context.Background(), "fail"); err == nil {
+		t.Error("got no error with stderr already set")
+	}
+}
+
+func TestSessionStdinAndEnv(t *testing.T) {
+	cli := dialTestServer(t, newTestServer(t))
+
+	session := newTestSession(t, cli)
+	session.Stdin = strings.NewReader("from stdin")
+	out, err := session.Output(context.Background(), "cat")
+	if err != nil || string(out) != "from stdin" {
+		t.Errorf("got %q, %v", out, err)
+	}
+
+	session = newTestSession(t, cli)
+	if err := session.Setenv("ZSSH_TEST", "value"); err != nil {
+		t.Fatal(err)
+	}
+	out, err = session.Output(context.Background(), "env ZSSH_TEST")
+	if err != nil || string(out) != "value\n" {
+		t.Errorf("got %q, %v", out, err)
+	}
+}
+
+func TestSessionPipes(t *testing.T) {
+	cli := dialTestServer(t, newTestServer(t))
+
+	session := newTestSession(t, cli)
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := session.Start("cat"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stdin.Write([]byte("piped")); err != nil {
+		t.Fatal(err)
+	}
+	stdin.Close()
+	var out bytes.Buffer
+	if _, err := out.ReadFrom(stdout); err != nil {
+		t.Fatal(err)
+	}
+	if err := session.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "piped" {
+		t.Errorf("got %q", out.String())
+	}
+}
+
+func TestSessionWaitCanceled(t *testing.T) {
+	s := newTestServer(t)
+	cli := dialTestServer(t, s)
+
+	session := newTestSession(t, cli)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	started := time.Now()
+	err := session.Run(ctx, "sleep")
+	if err != context.DeadlineExceeded {
+		t.Fatalf("got %v, want %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(started); elapsed >= signalGracePeriod {
+		t.Errorf("waited %s for the command which exits on SIGTERM", elapsed)
+	}
+	if got := s.receivedSignals(); !reflect.DeepEqual(got, []string{"TERM"}) {
+		t.Errorf("got signals %v, want [TERM]", got)
+	}
+}
+
+func TestSessionWaitGracePeriod(t *testing.T) {
+	s := newTestServer(t)
+	cli := dialTestServer(t, s)
+
+	session := newTestSession(t, cli)
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := session.Start("ignore"); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	started := time.Now()
+	if err := session.Wait(ctx); err != context.Canceled {
+		t.Fatalf("got %v, want %v", err, context.Canceled)
+	}
+	if elapsed := time.Since(started); elapsed < signalGracePeriod {
+		t.Errorf("closed the session after %s, want the grace period %s", elapsed, signalGracePeriod)
+	}
+	select {
+	case <-s.closed:
+	case <-time.After(time.Second):
+		t.Error("the session is not closed after the grace period")
+	}
+	if got := s.receivedSignals(); !reflect.DeepEqual(got, []string{"TERM"}) {
+		t.Errorf("got signals %v, want [TERM]", got)
+	}
+}
+
+func TestClientRunAndOutput(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	cli := dialTestServer(t, newTestServer(t), WithStdio(nil, &stdout, &stderr))
+
+	if err := cli.Run("fail"); ExitStatus(err) != 3 {
+		t.Errorf("got %v, want exit status 3", err)
+	}
+	if stdout.String() != "out\n" || stderr.String() != "err\n" {
+		t.Errorf("got stdout %q and stderr %q", stdout.String(), stderr.String())
+	}
+
+	out, err := cli.Output("echo hello")
+	if err != nil || string(out) != "hello\n" {
+		t.Errorf("got %q, %v", out, err)
+	}
+	// the output of a failed command has stderr to report.
+	out, err = cli.Output("fail")
+	if ExitStatus(err) != 3 || string(out) != "out\nerr\n" {
+		t.Errorf("got %q, %v", out, err)
+	}
+}
+
+func TestClientRunStdin(t *testing.T) {
+	var stdout bytes.Buffer
+	cli := dialTestServer(t, newTestServer(t), WithStdio(strings.NewReader("input"), &stdout, nil))
+	if err := cli.Run("cat"); err != nil {
+		t.Fatal(err)
+	}
+	if stdout.String() != "input" {
+		t.Errorf("got %q, want the standard input of the client", stdout.String())
+	}
+}
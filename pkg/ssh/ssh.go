@@ -1,6 +1,27 @@
+// Package ssh connects to hosts of zssh and runs commands and shells on them.
+//
+// A Client is created by Dial with options and opens a Session for each command:
+//
+//	cli, err := ssh.Dial(ctx, info, ssh.WithConnectTimeout(5*time.Second))
+//	if err != nil {
+//		return err
+//	}
+//	defer cli.Close()
+//
+//	session, err := cli.NewSession()
+//	if err != nil {
+//		return err
+//	}
+//	defer session.Close()
+//	out, err := session.Output(ctx, "hostname")
+//	if err != nil {
+//		return fmt.Errorf("exit status %d: %v", ssh.ExitStatus(err), err)
+//	}
 package ssh
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"github.com/shiena/ansicolor"
 	"github.com/zacscoding/zssh/pkg/host"
@@ -8,7 +29,19 @@ import (
 	"golang.org/x/crypto/ssh/terminal"
 	"io"
 	"io/ioutil"
+	"net"
 	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultTerminalType  = "xterm-256color"
+	defaultTerminalSpeed = 115200
+	// signalGracePeriod is the time to wait for the command to exit after the signal before closing the session.
+	signalGracePeriod = 3 * time.Second
 )
 
 type ClientParams struct {
@@ -16,30 +49,111 @@ type ClientParams struct {
 	StdIn      io.Reader
 	Stdout     io.Writer
 	Stderr     io.Writer
+	// TerminalType is the TERM of the pseudo terminal requested by OpenShell. Default is "xterm-256color".
+	TerminalType string
+	// TerminalSpeed is the baud rates of the pseudo terminal requested by OpenShell. Default is 115200.
+	TerminalSpeed uint32
+	// ConnectTimeout is the maximum amount of time for each address to connect. Zero means no timeout.
+	ConnectTimeout time.Duration
+	// AuthTimeout is the maximum amount of time for the ssh handshake and the authentication
+	// of each address. Zero means no timeout.
+	AuthTimeout time.Duration
+	// KnownHosts are the known_hosts files to verify the host key of the remote host.
+	// Host keys are not verified if empty.
+	KnownHosts []string
+	// StrictHostKey rejects the host which is not in KnownHosts.
+	StrictHostKey bool
+	// ForwardAgent forwards the local ssh agent of SSH_AUTH_SOCK to sessions of the Client.
+	ForwardAgent bool
+	// AgentSocket is the socket of an ssh agent which has the key of the host. The agent signs
+	// with the key instead of reading KeyPath of the host if it is not empty.
+	AgentSocket string
+	// Recorder records the shell opened by OpenShell if not nil.
+	Recorder TerminalRecorder
+	// MuxSocket is the socket of the mux daemon. Sessions are opened over the connection of the daemon
+	// if it is running and can connect to the host, otherwise the Client dials the host directly.
+	// The daemon is not used if ForwardAgent is set.
+	MuxSocket string
+	// KeepAliveInterval is the interval of keepalive requests to the host. Zero disables keepalives.
+	KeepAliveInterval time.Duration
+	// KeepAliveMaxMissed closes the connection if the number of keepalive requests in a row are not replied.
+	KeepAliveMaxMissed int
+}
+
+// TerminalRecorder records the output and the size changes of the terminal of a shell.
+type TerminalRecorder interface {
+	// Start is called with the size of the terminal before the shell starts.
+	Start(width, height int) error
+	Write(p []byte) (int, error)
+	Resize(width, height int) error
 }
 
 type Client struct {
 	ServerInfo *host.ServerInfo
+	// Address is the "address:port" of ServerInfo which this Client is connected to.
+	Address string
+	// Multiplexed is true if the Client is connected through the mux daemon.
+	Multiplexed bool
 
-	conn   *ssh.Client
-	stdin  io.Reader
-	stdout io.Writer
-	stderr io.Writer
+	conn          *ssh.Client
+	agentConn     net.Conn
+	stdin         io.Reader
+	stdout        io.Writer
+	stderr        io.Writer
+	terminalType  string
+	terminalSpeed uint32
+	recorder      TerminalRecorder
+	closed        chan struct{}
+	closeOnce     sync.Once
+	lost          chan struct{}
+	lostOnce      sync.Once
 }
 
 // NewClient create a new Client for ssh from given params ClientParams.
 func NewClient(params *ClientParams) (*Client, error) {
-	sshCli, err := dial(params.ServerInfo)
-	if err != nil {
-		return nil, err
+	return NewClientContext(context.Background(), params)
+}
+
+// NewClientContext creates a new Client like NewClient. Connecting to the host is aborted when the context is done.
+func NewClientContext(ctx context.Context, params *ClientParams) (*Client, error) {
+	var (
+		sshCli      *ssh.Client
+		addr        string
+		multiplexed bool
+		err         error
+	)
+	if params.MuxSocket != "" && !params.ForwardAgent {
+		// falls back to dial directly if the daemon is not available.
+		sshCli, addr, err = dialMux(ctx, params.MuxSocket, params.ServerInfo)
+		multiplexed = err == nil
+	}
+	if !multiplexed {
+		hostKeyCallback := ssh.InsecureIgnoreHostKey()
+		if len(params.KnownHosts) != 0 {
+			hostKeyCallback, err = NewHostKeyCallback(params.KnownHosts, params.StrictHostKey)
+			if err != nil {
+				return nil, err
+			}
+		}
+		sshCli, addr, err = dial(ctx, params, hostKeyCallback)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	cli := &Client{
-		conn:       sshCli,
-		ServerInfo: params.ServerInfo,
-		stdin:      os.Stdin,
-		stdout:     os.Stdout,
-		stderr:     os.Stderr,
+		conn:          sshCli,
+		ServerInfo:    params.ServerInfo,
+		Address:       addr,
+		Multiplexed:   multiplexed,
+		stdin:         os.Stdin,
+		stdout:        os.Stdout,
+		stderr:        os.Stderr,
+		terminalType:  defaultTerminalType,
+		terminalSpeed: defaultTerminalSpeed,
+		recorder:      params.Recorder,
+		closed:        make(chan struct{}),
+		lost:          make(chan struct{}),
 	}
 
 	if params.StdIn != nil {
@@ -51,10 +165,27 @@ func NewClient(params *ClientParams) (*Client, error) {
 	if params.Stderr != nil {
 		cli.stderr = params.Stderr
 	}
+	if params.TerminalType != "" {
+		cli.terminalType = params.TerminalType
+	}
+	if params.TerminalSpeed != 0 {
+		cli.terminalSpeed = params.TerminalSpeed
+	}
+	if params.ForwardAgent {
+		cli.agentConn, err = forwardAgent(sshCli)
+		if err != nil {
+			sshCli.Close()
+			return nil, fmt.Errorf("forward the agent: %v", err)
+		}
+	}
+	if params.KeepAliveInterval > 0 {
+		go cli.keepAlive(params.KeepAliveInterval, params.KeepAliveMaxMissed)
+	}
 	return cli, nil
 }
 
-// OpenShell starts the shell on the remote host in Client.
+// OpenShell starts the shell on the remote host in Client and waits for it to exit.
+// The error is *ssh.ExitError of golang.org/x/crypto/ssh if the shell exits with a non-zero status.
 func (c *Client) OpenShell() error {
 	session, err := c.conn.NewSession()
 	if err != nil {
@@ -62,16 +193,23 @@ func (c *Client) OpenShell() error {
 	}
 	defer session.Close()
 
+	if err := c.requestAgentForwarding(session); err != nil {
+		return err
+	}
 	session.Stdin = c.stdin
-	session.Stdout = ansicolor.NewAnsiColorWriter(c.stdout)
-	session.Stderr = ansicolor.NewAnsiColorWriter(c.stderr)
+	stdout, stderr := ansicolor.NewAnsiColorWriter(c.stdout), ansicolor.NewAnsiColorWriter(c.stderr)
+	if c.recorder != nil {
+		stdout, stderr = io.MultiWriter(stdout, c.recorder), io.MultiWriter(stderr, c.recorder)
+	}
+	session.Stdout = stdout
+	session.Stderr = stderr
 
 	// copy from http://talks.rodaine.com/gosf-ssh/present.slide#9
 	modes := ssh.TerminalModes{
-		ssh.ECHO:          1,      // please print what I type
-		ssh.ECHOCTL:       0,      // please don't print control chars
-		ssh.TTY_OP_ISPEED: 115200, // baud in
-		ssh.TTY_OP_OSPEED: 115200, // baud out
+		ssh.ECHO:          1,               // please print what I type
+		ssh.ECHOCTL:       0,               // please don't print control chars
+		ssh.TTY_OP_ISPEED: c.terminalSpeed, // baud in
+		ssh.TTY_OP_OSPEED: c.terminalSpeed, // baud out
 	}
 
 	termFD := int(os.Stdin.Fd())
@@ -84,53 +222,213 @@ func (c *Client) OpenShell() error {
 	termState, _ := terminal.MakeRaw(termFD)
 	defer terminal.Restore(termFD, termState)
 
-	err = session.RequestPty("xterm-256color", height, width, modes)
+	err = session.RequestPty(c.terminalType, height, width, modes)
 	if err != nil {
 		return err
 	}
+	if c.recorder != nil {
+		if err := c.recorder.Start(width, height); err != nil {
+			return fmt.Errorf("start the recording: %v", err)
+		}
+	}
 	err = session.Shell()
 	if err != nil {
 		return err
 	}
-	err = session.Wait()
-	if err != nil {
-		switch err.(type) {
-		case *ssh.ExitError:
-			return nil
+	stopResize := c.watchResize(session, termFD)
+	defer stopResize()
+	return c.sessionError(session.Wait())
+}
+
+// watchResize changes the window size of the session and records it when the local terminal is resized.
+// The returned function stops watching.
+func (c *Client) watchResize(session *ssh.Session, termFD int) func() {
+	sigs := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	notifyResize(sigs)
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-sigs:
+				width, height, err := terminal.GetSize(termFD)
+				if err != nil {
+					continue
+				}
+				_ = session.WindowChange(height, width)
+				if c.recorder != nil {
+					_ = c.recorder.Resize(width, height)
+				}
+			}
 		}
-		return err
+	}()
+	return func() {
+		signal.Stop(sigs)
+		close(done)
 	}
-	return nil
 }
 
-// Run runs the given cmd on the remote host in Client.
+// Run runs the given cmd on the remote host in Client with the standard input and outputs of Client.
 func (c *Client) Run(cmd string) error {
-	session, err := c.conn.NewSession()
+	return c.RunContext(context.Background(), cmd)
+}
+
+// RunContext runs the given cmd like Run. If the context is done before the command exits, the command
+// receives SIGTERM and the session is closed after a grace period, and the error of the context is returned.
+func (c *Client) RunContext(ctx context.Context, cmd string) error {
+	session, err := c.NewSession()
 	if err != nil {
 		return err
 	}
 	defer session.Close()
 
+	session.Stdin = c.stdin
 	session.Stdout = ansicolor.NewAnsiColorWriter(c.stdout)
 	session.Stderr = ansicolor.NewAnsiColorWriter(c.stderr)
+	return session.Run(ctx, cmd)
+}
 
-	return session.Run(cmd)
+// Output runs the given cmd on the remote host in Client and returns its standard output.
+func (c *Client) Output(cmd string) ([]byte, error) {
+	return c.OutputContext(context.Background(), cmd)
 }
 
-func dial(info *host.ServerInfo) (*ssh.Client, error) {
-	auth, err := newAuthMethod(info)
+// OutputContext runs the given cmd like Output, and stops it like RunContext when the context is done.
+// The standard error is appended to the output if the command fails.
+func (c *Client) OutputContext(ctx context.Context, cmd string) ([]byte, error) {
+	session, err := c.NewSession()
 	if err != nil {
 		return nil, err
 	}
+	defer session.Close()
+
+	var stderr bytes.Buffer
+	session.Stderr = &stderr
+	out, err := session.Output(ctx, cmd)
+	if err != nil {
+		return append(out, stderr.Bytes()...), err
+	}
+	return out, nil
+}
+
+// waitContext waits for the command of the session. If the context is done first, it sends SIGTERM
+// to the command and closes the session if the command does not exit in signalGracePeriod.
+func waitContext(ctx context.Context, session *ssh.Session) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- session.Wait()
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+	}
+	_ = session.Signal(ssh.SIGTERM)
+	select {
+	case <-done:
+	case <-time.After(signalGracePeriod):
+		session.Close()
+	}
+	return ctx.Err()
+}
+
+// Conn returns the underlying ssh connection of the Client, e.g. to forward ports over it. The connection
+// is closed by Client.Close. If the Client is Multiplexed, the connection is to the mux daemon, which relays
+// channels such as Dial but rejects remote forwarding by Listen.
+func (c *Client) Conn() *ssh.Client {
+	return c.conn
+}
+
+// Close closes the connection of Client and the connection to the local agent if forwarded.
+func (c *Client) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.closed)
+	})
+	if c.agentConn != nil {
+		c.agentConn.Close()
+	}
+	return c.conn.Close()
+}
+
+// dial connects to the endpoints of the given host in order and returns the first established connection
+// with its address.
+func dial(ctx context.Context, params *ClientParams, hostKeyCallback ssh.HostKeyCallback) (*ssh.Client, string, error) {
+	info := params.ServerInfo
+	var (
+		auth ssh.AuthMethod
+		err  error
+	)
+	if params.AgentSocket != "" {
+		var agentConn net.Conn
+		auth, agentConn, err = agentAuthMethod(params.AgentSocket, info.KeyPath+".pub")
+		if err == nil {
+			defer agentConn.Close()
+		}
+	} else {
+		auth, err = newAuthMethod(info)
+	}
+	if err != nil {
+		return nil, "", err
+	}
 	config := &ssh.ClientConfig{
 		User: info.User,
 		Auth: []ssh.AuthMethod{
 			auth,
 		},
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		HostKeyCallback: hostKeyCallback,
 	}
-	addr := fmt.Sprintf("%s:%d", info.Address, info.Port)
-	return ssh.Dial("tcp", addr, config)
+	dialer := net.Dialer{Timeout: params.ConnectTimeout}
+	var errs []string
+	for _, addr := range info.Endpoints() {
+		conn, err := dialer.DialContext(ctx, "tcp", addr)
+		if err == nil {
+			var cli *ssh.Client
+			cli, err = handshake(ctx, conn, addr, config, params.AuthTimeout)
+			if err == nil {
+				return cli, addr, nil
+			}
+		}
+		if ctx.Err() != nil {
+			return nil, "", ctx.Err()
+		}
+		errs = append(errs, fmt.Sprintf("%s: %v", addr, err))
+	}
+	return nil, "", fmt.Errorf("failed to dial all addresses. %s", strings.Join(errs, ", "))
+}
+
+// handshake establishes the ssh connection over the given connection in the timeout, and closes
+// the connection if it fails or the context is done.
+func handshake(ctx context.Context, conn net.Conn, addr string, config *ssh.ClientConfig, timeout time.Duration) (*ssh.Client, error) {
+	var deadline time.Time
+	if timeout > 0 {
+		deadline = time.Now().Add(timeout)
+		_ = conn.SetDeadline(deadline)
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+	c, chans, reqs, err := ssh.NewClientConn(conn, addr, config)
+	if err != nil {
+		conn.Close()
+		// the error of the deadline is not wrapped by the ssh package.
+		if !deadline.IsZero() && !time.Now().Before(deadline) {
+			return nil, fmt.Errorf("ssh handshake timed out after %s", timeout)
+		}
+		return nil, err
+	}
+	if ctx.Err() != nil {
+		c.Close()
+		return nil, ctx.Err()
+	}
+	_ = conn.SetDeadline(time.Time{})
+	return ssh.NewClient(c, chans, reqs), nil
 }
 
 func newAuthMethod(info *host.ServerInfo) (ssh.AuthMethod, error) {
@@ -150,5 +448,23 @@ func newAuthMethod(info *host.ServerInfo) (ssh.AuthMethod, error) {
 	if err != nil {
 		return nil, err
 	}
+	if certPath := CertificatePath(info); certPath != "" {
+		signer, err = newCertSigner(certPath, signer, info.User)
+		if err != nil {
+			return nil, err
+		}
+	}
 	return ssh.PublicKeys(signer), nil
 }
+
+// ExitStatus returns the exit status of the remote command from the given error returned by Client.
+// It returns 0 if err is nil, and -1 if the command did not exit with a status.
+func ExitStatus(err error) int {
+	if err == nil {
+		return 0
+	}
+	if exitErr, ok := err.(*ssh.ExitError); ok {
+		return exitErr.ExitStatus()
+	}
+	return -1
+}